@@ -61,6 +61,13 @@ func (a *Address) Contains(id ID) bool {
 	return false
 }
 
+// IDs returns the (sorted) IDs.
+func (a *Address) IDs() []ID {
+	ids := make([]ID, len(a.ids))
+	copy(ids, a.ids)
+	return ids
+}
+
 // Strings returns IDs as strings.
 func (a *Address) Strings() []string {
 	s := make([]string, 0, len(a.ids))
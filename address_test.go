@@ -28,6 +28,7 @@ func TestAddress(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 3, len(addr2.Strings()))
 	require.Equal(t, fmt.Sprintf("%s:%s:%s", alice, charlie, bob), addr2.String())
+	require.Equal(t, []keys.ID{alice, charlie, bob}, addr2.IDs())
 
 	empty, err := keys.NewAddress()
 	require.EqualError(t, err, "no ids")
@@ -11,7 +11,9 @@ import (
 const keyBrand = "KEY"
 
 // EncodeKey a key with an optional password.
-func EncodeKey(key *Key, password string) (string, error) {
+// The password KDF parameters can be set with keys.WithArgon2id, and are
+// stored in the output so DecodeKey can use them.
+func EncodeKey(key *Key, password string, opt ...keys.KDFOption) (string, error) {
 	if key == nil {
 		return "", errors.Errorf("no key to encode")
 	}
@@ -19,7 +21,10 @@ func EncodeKey(key *Key, password string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	out := keys.EncryptWithPassword(marshaled, password)
+	out, err := keys.EncryptWithPasswordKDF(marshaled, password, opt...)
+	if err != nil {
+		return "", err
+	}
 	return encoding.EncodeSaltpack(out, keyBrand), nil
 }
 
@@ -35,6 +35,15 @@ func TestEncode(t *testing.T) {
 	_, err = api.DecodeKey(encoded, "invalidpassword")
 	require.EqualError(t, err, "failed to decode key")
 
+	// Custom KDF params
+	encoded, err = api.EncodeKey(key, "testpassword", keys.WithArgon2id(keys.Argon2idParams{Time: 2, Memory: 1024, Threads: 1}))
+	require.NoError(t, err)
+	out, err = api.DecodeKey(encoded, "testpassword")
+	require.NoError(t, err)
+	require.Equal(t, key, out)
+	_, err = api.EncodeKey(key, "testpassword", keys.WithArgon2id(keys.Argon2idParams{}))
+	require.EqualError(t, err, "invalid argon2id time 0")
+
 	_, err = api.DecodeKey("invaliddata", "")
 	require.EqualError(t, err, "failed to decode key")
 
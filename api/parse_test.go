@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/keys-pub/keys"
@@ -56,4 +57,25 @@ func TestParse(t *testing.T) {
 	key, err = api.ParseKey([]byte(ak), "")
 	require.NoError(t, err)
 	require.Equal(t, keys.ID("kex135n03rgjrenhac4r92y4stfcy84rcc3tcgpwm6yl55uc0hg7h4eq3ntlut"), key.ID)
+
+	// PGP
+	pgp, err := ioutil.ReadFile("../testdata/pgp/bob.sec.asc")
+	require.NoError(t, err)
+	key, err = api.ParseKey(pgp, "testpassword")
+	require.NoError(t, err)
+	require.Equal(t, keys.ID("kex1nkmr5cg0lu6cnhpnh32tyqmymwqesn8ta9lntjx8ywph8m4pqzfs80wreg"), key.ID)
+	require.NotEmpty(t, key.Private)
+
+	// PKCS8
+	for _, f := range []string{"ed25519.pem", "ed25519.pub.pem", "ed25519.enc.pem"} {
+		b, err := ioutil.ReadFile("../testdata/pem/" + f)
+		require.NoError(t, err)
+		password := ""
+		if f == "ed25519.enc.pem" {
+			password = "testpassword"
+		}
+		key, err = api.ParseKey(b, password)
+		require.NoError(t, err)
+		require.Equal(t, keys.ID("kex1hjwugcrsc39ku4r2na9ruyqj0k53xk9adxmfwe8x6yl7ne7cx24qk9v322"), key.ID)
+	}
 }
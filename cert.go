@@ -59,6 +59,16 @@ func (c CertificateKey) X509Certificate() (*x509.Certificate, error) {
 	return x509.ParseCertificate(block.Bytes)
 }
 
+// NeedsRenewal returns true if the certificate expires within the renewBefore
+// duration from now.
+func (c CertificateKey) NeedsRenewal(now time.Time, renewBefore time.Duration) bool {
+	cert, err := c.X509Certificate()
+	if err != nil {
+		return true
+	}
+	return !now.Add(renewBefore).Before(cert.NotAfter)
+}
+
 // GenerateCertificateKey creates a certificate key.
 func GenerateCertificateKey(commonName string, isCA bool, parent *x509.Certificate) (*CertificateKey, error) {
 	if commonName == "" {
@@ -69,7 +79,7 @@ func GenerateCertificateKey(commonName string, isCA bool, parent *x509.Certifica
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to generate ecdsa key")
 	}
-	// TODO: Regen on expiration
+	// Use CertificateKey.NeedsRenewal to check for expiration.
 	validFor := 365 * 24 * time.Hour * 10
 	notBefore := time.Now()
 	notAfter := notBefore.Add(validFor)
@@ -0,0 +1,81 @@
+package keys
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// deriveSalt is the HKDF salt for DeriveEdX25519Key, DeriveX25519Key and
+// DeriveSecretKey.
+const deriveSalt = "keys.pub/derive/v1"
+
+// DeriveEdX25519Key derives a EdX25519Key from a master key for a purpose and
+// context.
+//
+// The master key must be a EdX25519Key or X25519Key.
+// The derived key seed is:
+//
+//	HKDFSHA256(ikm, 32, salt="keys.pub/derive/v1",
+//	  info=masterType || 0x00 || "edx25519" || 0x00 || purpose || 0x00 || context)
+//
+// where ikm is the EdX25519 seed or X25519 private key, and masterType is the
+// key type ("edx25519" or "x25519").
+// The purpose (required) can't contain 0x00.
+//
+// Test vectors (master seed or private key is 0x01 repeated 32 times):
+//
+//	master    func              purpose    context     output
+//	edx25519  DeriveEdX25519Key "channel"  "#general"  seed 538fb6c19bb2a4c9173204befd27c73223a81a4aeba5f19cf2d6936189d569bf
+//	edx25519  DeriveX25519Key   "channel"  "#general"  private db5de173634965b078cf5dd0f6315473addfe90188abc1013ab6c75d88c92263
+//	edx25519  DeriveSecretKey   "db"       "users.db"  c2510102aa6181a7627b3afe673d8b943c055709145d21414e167684ffb010f1
+//	x25519    DeriveSecretKey   "db"       ""          74d52baee40b67b92b4c1a04655647a6178f95e436425328800ecd841a452889
+func DeriveEdX25519Key(master Key, purpose string, context string) (*EdX25519Key, error) {
+	b, err := derive(master, EdX25519, purpose, context)
+	if err != nil {
+		return nil, err
+	}
+	return NewEdX25519KeyFromSeed(Bytes32(b)), nil
+}
+
+// DeriveX25519Key derives a X25519Key from a master key for a purpose and
+// context.
+// The private key is derived as in DeriveEdX25519Key with type "x25519".
+func DeriveX25519Key(master Key, purpose string, context string) (*X25519Key, error) {
+	b, err := derive(master, X25519, purpose, context)
+	if err != nil {
+		return nil, err
+	}
+	return NewX25519KeyFromPrivateKey(Bytes32(b)), nil
+}
+
+// DeriveSecretKey derives a 32 byte secret key (for example for SecretBoxSeal)
+// from a master key for a purpose and context.
+// The key is derived as in DeriveEdX25519Key with type "secret".
+func DeriveSecretKey(master Key, purpose string, context string) (*[32]byte, error) {
+	b, err := derive(master, "secret", purpose, context)
+	if err != nil {
+		return nil, err
+	}
+	return Bytes32(b), nil
+}
+
+func derive(master Key, typ KeyType, purpose string, context string) ([]byte, error) {
+	var ikm []byte
+	switch k := master.(type) {
+	case *EdX25519Key:
+		ikm = k.Seed()[:]
+	case *X25519Key:
+		ikm = k.Private()
+	default:
+		return nil, errors.Errorf("unsupported master key type %s", master.Type())
+	}
+	if purpose == "" {
+		return nil, errors.Errorf("no purpose specified")
+	}
+	if strings.Contains(purpose, "\x00") {
+		return nil, errors.Errorf("invalid purpose")
+	}
+	info := strings.Join([]string{string(master.Type()), string(typ), purpose, context}, "\x00")
+	return HKDFSHA256(ikm, 32, []byte(deriveSalt), []byte(info)), nil
+}
@@ -0,0 +1,60 @@
+package keys_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveVectors(t *testing.T) {
+	// Vectors from the DeriveEdX25519Key doc.
+	// Master EdX25519 seed (0x01 * 32).
+	master := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+
+	ek, err := keys.DeriveEdX25519Key(master, "channel", "#general")
+	require.NoError(t, err)
+	require.Equal(t, "538fb6c19bb2a4c9173204befd27c73223a81a4aeba5f19cf2d6936189d569bf", hex.EncodeToString(ek.Seed()[:]))
+	require.Equal(t, keys.ID("kex1d8wgjj3wcp8dt50us29tmn2lwxsspyvpgpgqwaxd5j73yr9nq7sqkgl0qe"), ek.ID())
+
+	bk, err := keys.DeriveX25519Key(master, "channel", "#general")
+	require.NoError(t, err)
+	require.Equal(t, "db5de173634965b078cf5dd0f6315473addfe90188abc1013ab6c75d88c92263", hex.EncodeToString(bk.Private()))
+	require.Equal(t, keys.ID("kbx1alwrmf6zcu3ngswt890teplwzv202y3wgqkqgp25fr3rz465ecqq9p7zh2"), bk.ID())
+
+	sk, err := keys.DeriveSecretKey(master, "db", "users.db")
+	require.NoError(t, err)
+	require.Equal(t, "c2510102aa6181a7627b3afe673d8b943c055709145d21414e167684ffb010f1", hex.EncodeToString(sk[:]))
+
+	// Master X25519 private key (0x01 * 32).
+	xmaster := keys.NewX25519KeyFromPrivateKey(testSeed(0x01))
+	sk, err = keys.DeriveSecretKey(xmaster, "db", "")
+	require.NoError(t, err)
+	require.Equal(t, "74d52baee40b67b92b4c1a04655647a6178f95e436425328800ecd841a452889", hex.EncodeToString(sk[:]))
+}
+
+func TestDerive(t *testing.T) {
+	master := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+
+	k1, err := keys.DeriveX25519Key(master, "channel", "a")
+	require.NoError(t, err)
+	k2, err := keys.DeriveX25519Key(master, "channel", "b")
+	require.NoError(t, err)
+	require.NotEqual(t, k1.ID(), k2.ID())
+	k3, err := keys.DeriveX25519Key(master, "channel", "a")
+	require.NoError(t, err)
+	require.Equal(t, k1, k3)
+
+	other := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	k4, err := keys.DeriveX25519Key(other, "channel", "a")
+	require.NoError(t, err)
+	require.NotEqual(t, k1.ID(), k4.ID())
+
+	_, err = keys.DeriveSecretKey(master, "", "a")
+	require.EqualError(t, err, "no purpose specified")
+	_, err = keys.DeriveSecretKey(master, "a\x00b", "")
+	require.EqualError(t, err, "invalid purpose")
+	_, err = keys.DeriveSecretKey(master.PublicKey(), "a", "")
+	require.EqualError(t, err, "unsupported master key type edx25519")
+}
@@ -0,0 +1,119 @@
+// Package dsse provides Dead Simple Signing Envelopes (DSSE) and in-toto
+// attestations signed with EdX25519 keys.
+// See https://github.com/secure-systems-lab/dsse.
+package dsse
+
+import (
+	"fmt"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// Envelope is a DSSE envelope.
+type Envelope struct {
+	// Payload (base64 encoded in JSON).
+	Payload []byte `json:"payload"`
+	// PayloadType is the payload media type.
+	PayloadType string `json:"payloadType"`
+	// Signatures over the payload.
+	Signatures []*Signature `json:"signatures"`
+}
+
+// Signature in an Envelope.
+type Signature struct {
+	// KeyID is the (EdX25519) key ID of the signer.
+	KeyID keys.ID `json:"keyid"`
+	// Sig (base64 encoded in JSON).
+	Sig []byte `json:"sig"`
+}
+
+// Sign payload into an Envelope, with a signature for each key.
+func Sign(payload []byte, payloadType string, signers ...*keys.EdX25519Key) (*Envelope, error) {
+	if payloadType == "" {
+		return nil, errors.Errorf("no payload type")
+	}
+	if len(signers) == 0 {
+		return nil, errors.Errorf("no signers")
+	}
+	env := &Envelope{
+		Payload:     payload,
+		PayloadType: payloadType,
+		Signatures:  []*Signature{},
+	}
+	for _, key := range signers {
+		env.Sign(key)
+	}
+	return env, nil
+}
+
+// Sign adds a signature to the Envelope.
+// If the key already signed, its signature is replaced.
+func (e *Envelope) Sign(key *keys.EdX25519Key) {
+	sig := &Signature{
+		KeyID: key.ID(),
+		Sig:   key.SignDetached(pae(e.PayloadType, e.Payload)),
+	}
+	for i, s := range e.Signatures {
+		if s.KeyID == key.ID() {
+			e.Signatures[i] = sig
+			return
+		}
+	}
+	e.Signatures = append(e.Signatures, sig)
+}
+
+// Verify signatures in the Envelope.
+// Returns the payload and the key IDs with valid signatures.
+// Signatures from unsupported keys or that fail to verify are skipped.
+// Returns keys.ErrVerifyFailed if there are no valid signatures.
+func (e *Envelope) Verify() ([]byte, []keys.ID, error) {
+	msg := pae(e.PayloadType, e.Payload)
+	set := keys.NewIDSet()
+	for _, sig := range e.Signatures {
+		if set.Contains(sig.KeyID) {
+			continue
+		}
+		pk, err := keys.NewEdX25519PublicKeyFromID(sig.KeyID)
+		if err != nil {
+			continue
+		}
+		if err := pk.VerifyDetached(sig.Sig, msg); err != nil {
+			continue
+		}
+		set.Add(sig.KeyID)
+	}
+	if set.Size() == 0 {
+		return nil, nil, keys.ErrVerifyFailed
+	}
+	return e.Payload, set.IDs(), nil
+}
+
+// VerifyThreshold verifies the Envelope has valid signatures from at least
+// threshold of the trusted key IDs.
+// Returns the payload and the trusted key IDs with valid signatures.
+func (e *Envelope) VerifyThreshold(trusted []keys.ID, threshold int) ([]byte, []keys.ID, error) {
+	if threshold <= 0 {
+		return nil, nil, errors.Errorf("invalid threshold")
+	}
+	payload, kids, err := e.Verify()
+	if err != nil {
+		return nil, nil, err
+	}
+	set := keys.NewIDSet(trusted...)
+	out := []keys.ID{}
+	for _, kid := range kids {
+		if set.Contains(kid) {
+			out = append(out, kid)
+		}
+	}
+	if len(out) < threshold {
+		return nil, nil, errors.Errorf("not enough valid signatures (%d < %d)", len(out), threshold)
+	}
+	return payload, out, nil
+}
+
+// pae is the DSSE pre-authentication encoding (PAE).
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
@@ -0,0 +1,67 @@
+package dsse_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/dsse"
+	"github.com/stretchr/testify/require"
+)
+
+func testSeed(b byte) *[32]byte {
+	return keys.Bytes32(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSignVerify(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewEdX25519KeyFromSeed(testSeed(0x03))
+
+	env, err := dsse.Sign([]byte("hello world"), "http://example.com/HelloWorld", alice, bob)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(env)
+	require.NoError(t, err)
+	var out dsse.Envelope
+	err = json.Unmarshal(b, &out)
+	require.NoError(t, err)
+
+	payload, kids, err := out.Verify()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), payload)
+	require.Equal(t, []keys.ID{alice.ID(), bob.ID()}, kids)
+
+	_, kids, err = out.VerifyThreshold([]keys.ID{bob.ID(), charlie.ID()}, 1)
+	require.NoError(t, err)
+	require.Equal(t, []keys.ID{bob.ID()}, kids)
+	_, _, err = out.VerifyThreshold([]keys.ID{bob.ID(), charlie.ID()}, 2)
+	require.EqualError(t, err, "not enough valid signatures (1 < 2)")
+
+	// Invalid signature is skipped
+	out.Signatures[0].Sig = bob.SignDetached([]byte("invalid"))
+	_, kids, err = out.Verify()
+	require.NoError(t, err)
+	require.Equal(t, []keys.ID{bob.ID()}, kids)
+
+	// Changed payload type
+	out.PayloadType = "other"
+	_, _, err = out.Verify()
+	require.Equal(t, keys.ErrVerifyFailed, err)
+}
+
+func TestSignature(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+
+	env, err := dsse.Sign([]byte("hello world"), "http://example.com/HelloWorld", alice)
+	require.NoError(t, err)
+
+	// Signature is over "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	pae := []byte("DSSEv1 29 http://example.com/HelloWorld 11 hello world")
+	err = alice.PublicKey().VerifyDetached(env.Signatures[0].Sig, pae)
+	require.NoError(t, err)
+
+	_, err = dsse.Sign([]byte("hello world"), "", alice)
+	require.EqualError(t, err, "no payload type")
+}
@@ -0,0 +1,131 @@
+package dsse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/user"
+	"github.com/keys-pub/keys/users"
+	"github.com/pkg/errors"
+)
+
+// InTotoPayloadType is the DSSE payload type for in-toto statements.
+const InTotoPayloadType = "application/vnd.in-toto+json"
+
+// StatementType is the in-toto statement type.
+const StatementType = "https://in-toto.io/Statement/v0.1"
+
+// Statement is an in-toto attestation statement.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []*Subject      `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate,omitempty"`
+}
+
+// Subject is an artifact an in-toto statement is about.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// NewSubject creates a Subject with the SHA256 digest of b.
+func NewSubject(name string, b []byte) *Subject {
+	h := sha256.Sum256(b)
+	return &Subject{
+		Name:   name,
+		Digest: map[string]string{"sha256": hex.EncodeToString(h[:])},
+	}
+}
+
+// NewStatement creates an in-toto statement.
+func NewStatement(predicateType string, predicate interface{}, subjects ...*Subject) (*Statement, error) {
+	if predicateType == "" {
+		return nil, errors.Errorf("no predicate type")
+	}
+	if len(subjects) == 0 {
+		return nil, errors.Errorf("no subjects")
+	}
+	st := &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: predicateType,
+	}
+	if predicate != nil {
+		b, err := json.Marshal(predicate)
+		if err != nil {
+			return nil, err
+		}
+		st.Predicate = b
+	}
+	return st, nil
+}
+
+// SignStatement signs an in-toto statement into an Envelope.
+func SignStatement(st *Statement, signers ...*keys.EdX25519Key) (*Envelope, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	return Sign(b, InTotoPayloadType, signers...)
+}
+
+// Attestation is a verified in-toto statement.
+type Attestation struct {
+	Statement *Statement
+	Signers   []*Signer
+}
+
+// Signer of an Attestation.
+type Signer struct {
+	KID keys.ID
+	// User if the signer has a verified user (user.StatusOK), or nil.
+	User *user.User
+}
+
+// Users returns the verified users that signed.
+func (a *Attestation) Users() []*user.User {
+	out := []*user.User{}
+	for _, s := range a.Signers {
+		if s.User != nil {
+			out = append(out, s.User)
+		}
+	}
+	return out
+}
+
+// VerifyAttestation verifies an Envelope containing an in-toto statement, and
+// resolves signers to verified users.
+func VerifyAttestation(ctx context.Context, env *Envelope, usrs *users.Users) (*Attestation, error) {
+	if env.PayloadType != InTotoPayloadType {
+		return nil, errors.Errorf("invalid payload type %q", env.PayloadType)
+	}
+	payload, kids, err := env.Verify()
+	if err != nil {
+		return nil, err
+	}
+	var st Statement
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, errors.Wrapf(err, "invalid statement")
+	}
+	if st.Type != StatementType {
+		return nil, errors.Errorf("invalid statement type %q", st.Type)
+	}
+
+	signers := make([]*Signer, 0, len(kids))
+	for _, kid := range kids {
+		signer := &Signer{KID: kid}
+		res, err := usrs.Find(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil && res.Status == user.StatusOK {
+			signer.User = res.User
+		}
+		signers = append(signers, signer)
+	}
+	return &Attestation{Statement: &st, Signers: signers}, nil
+}
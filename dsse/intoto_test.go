@@ -0,0 +1,60 @@
+package dsse_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/dsse"
+	"github.com/keys-pub/keys/dstore"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/keys-pub/keys/user"
+	"github.com/keys-pub/keys/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestation(t *testing.T) {
+	clock := tsutil.NewTestClock()
+	ds := dstore.NewMem()
+	scs := keys.NewSigchains(ds)
+	usrs := users.New(ds, scs, users.Clock(clock))
+
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+
+	sc := keys.NewSigchain(alice.ID())
+	usr, err := user.NewEcho(alice, "alice", 1)
+	require.NoError(t, err)
+	st, err := user.NewSigchainStatement(sc, usr, alice, clock.Now())
+	require.NoError(t, err)
+	err = sc.Add(st)
+	require.NoError(t, err)
+	err = scs.Save(sc)
+	require.NoError(t, err)
+	_, err = usrs.Update(context.TODO(), alice.ID())
+	require.NoError(t, err)
+
+	predicate := map[string]string{"builder": "ci"}
+	statement, err := dsse.NewStatement("https://slsa.dev/provenance/v0.1", predicate, dsse.NewSubject("app.tar.gz", []byte("data")))
+	require.NoError(t, err)
+	require.Equal(t, "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7", statement.Subject[0].Digest["sha256"])
+
+	env, err := dsse.SignStatement(statement, alice, bob)
+	require.NoError(t, err)
+
+	att, err := dsse.VerifyAttestation(context.TODO(), env, usrs)
+	require.NoError(t, err)
+	require.Equal(t, "https://slsa.dev/provenance/v0.1", att.Statement.PredicateType)
+	require.Equal(t, `{"builder":"ci"}`, string(att.Statement.Predicate))
+	require.Equal(t, 2, len(att.Signers))
+	require.Equal(t, alice.ID(), att.Signers[0].KID)
+	require.Equal(t, "alice@echo", att.Signers[0].User.ID())
+	require.Equal(t, bob.ID(), att.Signers[1].KID)
+	require.Nil(t, att.Signers[1].User)
+	require.Equal(t, 1, len(att.Users()))
+
+	env2, err := dsse.Sign([]byte("{}"), "text/plain", alice)
+	require.NoError(t, err)
+	_, err = dsse.VerifyAttestation(context.TODO(), env2, usrs)
+	require.EqualError(t, err, `invalid payload type "text/plain"`)
+}
@@ -0,0 +1,83 @@
+package keys
+
+import (
+	"github.com/keys-pub/keys/encoding"
+	"github.com/pkg/errors"
+)
+
+// envelopeVersion is the envelope format version.
+const envelopeVersion byte = 0x01
+
+// envelopeContext is prepended to the signed bytes.
+const envelopeContext = "keys.pub/envelope/v1\x00"
+
+// EnvelopeBrand is the armor brand for envelopes.
+const EnvelopeBrand = "ENVELOPE"
+
+// envelopeOverhead is version (1) + ephemeral key (32) + box overhead (16) +
+// sender (32) + signature (64).
+const envelopeOverhead = 1 + 32 + 16 + 32 + 64
+
+// EnvelopeSeal encrypts and signs bytes from an EdX25519Key sender to a
+// X25519PublicKey recipient.
+//
+// The sender's public key and signature are encrypted (with CryptoBoxSeal), so
+// only the recipient can see who sent the message. The signature covers the
+// recipient public key and the bytes, so a recipient can't forward the
+// envelope to someone else as if it were sent to them.
+//
+// The format is:
+//
+//	version (0x01) || CryptoBoxSeal(sender (32) || signature (64) || b, recipient)
+//
+// where signature is the detached signature of:
+//
+//	"keys.pub/envelope/v1" || 0x00 || recipient (32) || b
+func EnvelopeSeal(b []byte, sender *EdX25519Key, recipient *X25519PublicKey) []byte {
+	sig := sender.SignDetached(envelopeSigBytes(b, recipient))
+	inner := bytesJoin(sender.PublicKey().Bytes(), sig, b)
+	return append([]byte{envelopeVersion}, CryptoBoxSeal(inner, recipient)...)
+}
+
+// EnvelopeOpen decrypts and verifies an envelope from EnvelopeSeal, returning
+// the bytes and the sender.
+func EnvelopeOpen(b []byte, recipient *X25519Key) ([]byte, *EdX25519PublicKey, error) {
+	if len(b) < envelopeOverhead {
+		return nil, nil, errors.Errorf("invalid envelope")
+	}
+	if b[0] != envelopeVersion {
+		return nil, nil, errors.Errorf("unsupported envelope version %d", b[0])
+	}
+	inner, err := CryptoBoxSealOpen(b[1:], recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	sender := NewEdX25519PublicKey(Bytes32(inner[:32]))
+	sig := inner[32:96]
+	out := inner[96:]
+	if err := sender.VerifyDetached(sig, envelopeSigBytes(out, recipient.PublicKey())); err != nil {
+		return nil, nil, err
+	}
+	return out, sender, nil
+}
+
+// EnvelopeSealArmored is EnvelopeSeal with armored (saltpack style) encoding.
+func EnvelopeSealArmored(b []byte, sender *EdX25519Key, recipient *X25519PublicKey) string {
+	return encoding.EncodeSaltpack(EnvelopeSeal(b, sender, recipient), EnvelopeBrand)
+}
+
+// EnvelopeOpenArmored opens an envelope from EnvelopeSealArmored.
+func EnvelopeOpenArmored(msg string, recipient *X25519Key) ([]byte, *EdX25519PublicKey, error) {
+	b, brand, err := encoding.DecodeSaltpack(msg, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if brand != EnvelopeBrand {
+		return nil, nil, errors.Errorf("invalid envelope armor")
+	}
+	return EnvelopeOpen(b, recipient)
+}
+
+func envelopeSigBytes(b []byte, recipient *X25519PublicKey) []byte {
+	return bytesJoin([]byte(envelopeContext), recipient.Bytes(), b)
+}
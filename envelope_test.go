@@ -0,0 +1,71 @@
+package keys_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewX25519KeyFromSeed(testSeed(0x03))
+
+	b := keys.EnvelopeSeal([]byte("hi bob"), alice, bob.PublicKey())
+	require.Equal(t, 145+6, len(b))
+
+	out, sender, err := keys.EnvelopeOpen(b, bob)
+	require.NoError(t, err)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, alice.ID(), sender.ID())
+
+	// Sender isn't visible
+	require.False(t, strings.Contains(string(b), string(alice.PublicKey().Bytes())))
+
+	_, _, err = keys.EnvelopeOpen(b, charlie)
+	require.EqualError(t, err, "failed to box open")
+
+	b[0] = 0x02
+	_, _, err = keys.EnvelopeOpen(b, bob)
+	require.EqualError(t, err, "unsupported envelope version 2")
+
+	_, _, err = keys.EnvelopeOpen([]byte{0x01}, bob)
+	require.EqualError(t, err, "invalid envelope")
+}
+
+func TestEnvelopeForwarded(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewX25519KeyFromSeed(testSeed(0x03))
+
+	b := keys.EnvelopeSeal([]byte("hi bob"), alice, bob.PublicKey())
+	out, _, err := keys.EnvelopeOpen(b, bob)
+	require.NoError(t, err)
+
+	// Bob re-encrypts alice's signed content to charlie.
+	inner, err := keys.CryptoBoxSealOpen(b[1:], bob)
+	require.NoError(t, err)
+	require.Equal(t, out, inner[96:])
+	forwarded := append([]byte{0x01}, keys.CryptoBoxSeal(inner, charlie.PublicKey())...)
+	_, _, err = keys.EnvelopeOpen(forwarded, charlie)
+	require.Equal(t, keys.ErrVerifyFailed, err)
+}
+
+func TestEnvelopeArmored(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateX25519Key()
+
+	msg := keys.EnvelopeSealArmored([]byte("hi bob"), alice, bob.PublicKey())
+	require.True(t, strings.HasPrefix(msg, "BEGIN ENVELOPE MESSAGE.\n"))
+	require.True(t, strings.HasSuffix(msg, "\nEND ENVELOPE MESSAGE."))
+
+	out, sender, err := keys.EnvelopeOpenArmored(msg, bob)
+	require.NoError(t, err)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, alice.ID(), sender.ID())
+
+	_, _, err = keys.EnvelopeOpenArmored(strings.ReplaceAll(msg, "ENVELOPE", "OTHER"), bob)
+	require.EqualError(t, err, "invalid envelope armor")
+}
@@ -0,0 +1,150 @@
+// Package group provides shared X25519 group keys for a keys.Address, with
+// epochs and rotation on membership change.
+package group
+
+import (
+	"encoding/binary"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// Group is a keys.Address with a shared X25519 key for each epoch.
+//
+// The group key for the current epoch is distributed to each member as a
+// Share, signed by the (EdX25519) member that rotated it. When members are
+// added or removed, the key is rotated to a new epoch.
+// Keys for previous epochs are kept to decrypt older messages.
+type Group struct {
+	address *keys.Address
+	epoch   uint32
+	keys    map[uint32]*keys.X25519Key
+}
+
+// New creates a group for an Address, with a new group key at epoch 1.
+// Address IDs must be EdX25519 or X25519 key IDs.
+func New(address *keys.Address) (*Group, error) {
+	if err := checkMembers(address); err != nil {
+		return nil, err
+	}
+	g := &Group{
+		address: address,
+		keys:    map[uint32]*keys.X25519Key{},
+	}
+	g.rotate()
+	return g, nil
+}
+
+// Address of group members.
+func (g *Group) Address() *keys.Address {
+	return g.address
+}
+
+// Epoch is the current epoch.
+func (g *Group) Epoch() uint32 {
+	return g.epoch
+}
+
+// Key returns the group key for the current epoch.
+func (g *Group) Key() *keys.X25519Key {
+	return g.keys[g.epoch]
+}
+
+// Rotate the group key to a new epoch.
+func (g *Group) Rotate() {
+	g.rotate()
+}
+
+func (g *Group) rotate() {
+	g.epoch++
+	g.keys[g.epoch] = keys.GenerateX25519Key()
+}
+
+// Add members, rotating the group key.
+func (g *Group) Add(ids ...keys.ID) error {
+	address, err := keys.NewAddress(append(g.address.IDs(), ids...)...)
+	if err != nil {
+		return err
+	}
+	return g.setAddress(address)
+}
+
+// Remove members, rotating the group key.
+func (g *Group) Remove(ids ...keys.ID) error {
+	remove := map[keys.ID]bool{}
+	for _, id := range ids {
+		if !g.address.Contains(id) {
+			return errors.Errorf("%s is not a member", id)
+		}
+		remove[id] = true
+	}
+	members := []keys.ID{}
+	for _, id := range g.address.IDs() {
+		if !remove[id] {
+			members = append(members, id)
+		}
+	}
+	address, err := keys.NewAddress(members...)
+	if err != nil {
+		return err
+	}
+	return g.setAddress(address)
+}
+
+func (g *Group) setAddress(address *keys.Address) error {
+	if err := checkMembers(address); err != nil {
+		return err
+	}
+	g.address = address
+	g.rotate()
+	return nil
+}
+
+// Encrypt to the group key for the current epoch.
+//
+// The format is:
+//
+//	epoch (uint32, big endian) || CryptoBoxSeal(b, group public key)
+func (g *Group) Encrypt(b []byte) []byte {
+	return encrypt(b, g.epoch, g.Key().PublicKey())
+}
+
+// Decrypt with the group key for the message epoch.
+func (g *Group) Decrypt(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errors.Errorf("invalid group message")
+	}
+	epoch := binary.BigEndian.Uint32(b[:4])
+	key, ok := g.keys[epoch]
+	if !ok {
+		return nil, errors.Errorf("no group key for epoch %d", epoch)
+	}
+	return keys.CryptoBoxSealOpen(b[4:], key)
+}
+
+func encrypt(b []byte, epoch uint32, pk *keys.X25519PublicKey) []byte {
+	out := make([]byte, 4, 4+len(b)+48)
+	binary.BigEndian.PutUint32(out, epoch)
+	return append(out, keys.CryptoBoxSeal(b, pk)...)
+}
+
+func checkMembers(address *keys.Address) error {
+	if address == nil {
+		return errors.Errorf("no address")
+	}
+	for _, id := range address.IDs() {
+		if _, err := memberKey(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberKey returns X25519PublicKey for a member (EdX25519 or X25519) ID.
+func memberKey(id keys.ID) (*keys.X25519PublicKey, error) {
+	pk, err := keys.NewX25519PublicKeyFromID(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid member %s", id)
+	}
+	return pk, nil
+}
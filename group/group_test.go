@@ -0,0 +1,184 @@
+package group_test
+
+import (
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/group"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateX25519Key()
+	charlie := keys.GenerateEdX25519Key()
+
+	address, err := keys.NewAddress(alice.ID(), bob.ID())
+	require.NoError(t, err)
+	g, err := group.New(address)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), g.Epoch())
+
+	shares, err := g.Shares(alice)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(shares))
+
+	bobGroup, err := group.NewFromShare(findShare(t, shares, bob.ID()), bob)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), bobGroup.Epoch())
+	require.Equal(t, address.String(), bobGroup.Address().String())
+	require.Equal(t, g.Key().ID(), bobGroup.Key().ID())
+
+	aliceGroup, err := group.NewFromShare(findShare(t, shares, alice.ID()), alice.X25519Key())
+	require.NoError(t, err)
+
+	msg := g.Encrypt([]byte("hi group"))
+	out, err := bobGroup.Decrypt(msg)
+	require.NoError(t, err)
+	require.Equal(t, "hi group", string(out))
+	out, err = aliceGroup.Decrypt(msg)
+	require.NoError(t, err)
+	require.Equal(t, "hi group", string(out))
+
+	// Add charlie
+	err = g.Add(charlie.ID())
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), g.Epoch())
+	require.True(t, g.Address().Contains(charlie.ID()))
+	shares, err = g.Shares(alice)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(shares))
+
+	charlieGroup, err := group.NewFromShare(findShare(t, shares, charlie.ID()), charlie.X25519Key())
+	require.NoError(t, err)
+	err = bobGroup.Update(findShare(t, shares, bob.ID()), bob)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), bobGroup.Epoch())
+
+	msg2 := bobGroup.Encrypt([]byte("hi charlie"))
+	out, err = charlieGroup.Decrypt(msg2)
+	require.NoError(t, err)
+	require.Equal(t, "hi charlie", string(out))
+
+	// Charlie can't decrypt messages from before they joined.
+	_, err = charlieGroup.Decrypt(msg)
+	require.EqualError(t, err, "no group key for epoch 1")
+	// Bob still can.
+	out, err = bobGroup.Decrypt(msg)
+	require.NoError(t, err)
+	require.Equal(t, "hi group", string(out))
+
+	// Remove bob
+	err = g.Remove(bob.ID())
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), g.Epoch())
+	require.False(t, g.Address().Contains(bob.ID()))
+	shares, err = g.Shares(alice)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(shares))
+	err = charlieGroup.Update(findShare(t, shares, charlie.ID()), charlie.X25519Key())
+	require.NoError(t, err)
+
+	msg3 := charlieGroup.Encrypt([]byte("bob is gone"))
+	_, err = bobGroup.Decrypt(msg3)
+	require.EqualError(t, err, "no group key for epoch 3")
+	out, err = g.Decrypt(msg3)
+	require.NoError(t, err)
+	require.Equal(t, "bob is gone", string(out))
+
+	err = g.Remove(bob.ID())
+	require.EqualError(t, err, bob.ID().String()+" is not a member")
+	err = g.Add(alice.ID())
+	require.EqualError(t, err, "duplicate address "+alice.ID().String())
+}
+
+func TestShareInvalid(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateX25519Key()
+
+	address, err := keys.NewAddress(alice.ID(), bob.ID())
+	require.NoError(t, err)
+	g, err := group.New(address)
+	require.NoError(t, err)
+	shares, err := g.Shares(alice)
+	require.NoError(t, err)
+	share := findShare(t, shares, bob.ID())
+
+	_, err = group.NewFromShare(share, alice.X25519Key())
+	require.EqualError(t, err, "share is not for key "+alice.X25519Key().ID().String())
+
+	// Sender isn't a member
+	_, err = g.Shares(keys.GenerateEdX25519Key())
+	require.Error(t, err)
+
+	// Share metadata doesn't match
+	changed := *share
+	changed.Epoch = 2
+	_, err = group.NewFromShare(&changed, bob)
+	require.EqualError(t, err, "invalid share")
+
+	invalid, err := keys.NewAddress(keys.ID("kbx1invalid"))
+	require.NoError(t, err)
+	_, err = group.New(invalid)
+	require.Error(t, err)
+}
+
+func TestShareForged(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateEdX25519Key()
+	mallory := keys.GenerateEdX25519Key()
+
+	address, err := keys.NewAddress(alice.ID(), bob.ID())
+	require.NoError(t, err)
+	g, err := group.New(address)
+	require.NoError(t, err)
+	shares, err := g.Shares(alice)
+	require.NoError(t, err)
+	bobGroup, err := group.NewFromShare(findShare(t, shares, bob.ID()), bob.X25519Key())
+	require.NoError(t, err)
+
+	// Mallory (not a member) adds herself, with a new key for epoch 2
+	forgedAddress, err := keys.NewAddress(alice.ID(), bob.ID(), mallory.ID())
+	require.NoError(t, err)
+	forged, err := group.New(forgedAddress)
+	require.NoError(t, err)
+	forged.Rotate()
+	shares, err = forged.Shares(mallory)
+	require.NoError(t, err)
+	share := findShare(t, shares, bob.ID())
+	err = bobGroup.Update(share, bob.X25519Key())
+	require.EqualError(t, err, "share sender "+mallory.ID().String()+" is not a member")
+
+	// Mallory claims alice sent it
+	changed := *share
+	changed.Sender = alice.ID()
+	err = bobGroup.Update(&changed, bob.X25519Key())
+	require.EqualError(t, err, "invalid share signature: verify failed")
+
+	require.Equal(t, uint32(1), bobGroup.Epoch())
+
+	// Replacing the key for a known epoch (by a member)
+	replaced, err := group.New(address)
+	require.NoError(t, err)
+	shares, err = replaced.Shares(alice)
+	require.NoError(t, err)
+	err = bobGroup.Update(findShare(t, shares, bob.ID()), bob.X25519Key())
+	require.EqualError(t, err, "group key for epoch 1 already exists")
+	require.Equal(t, g.Key().ID(), bobGroup.Key().ID())
+
+	// Same share again is ok
+	shares, err = g.Shares(alice)
+	require.NoError(t, err)
+	err = bobGroup.Update(findShare(t, shares, bob.ID()), bob.X25519Key())
+	require.NoError(t, err)
+}
+
+func findShare(t *testing.T, shares []*group.Share, id keys.ID) *group.Share {
+	for _, share := range shares {
+		if share.Member == id {
+			return share
+		}
+	}
+	t.Fatalf("no share for %s", id)
+	return nil
+}
@@ -0,0 +1,154 @@
+package group
+
+import (
+	"encoding/binary"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+const shareSignContext = "keys.pub/group/share/v1\x00"
+
+// Share is a group key for an epoch, encrypted to a member, and signed by the
+// member that created (rotated) it.
+type Share struct {
+	// Address of the group (members).
+	Address string `json:"address"`
+	// Epoch of the group key.
+	Epoch uint32 `json:"epoch"`
+	// Member the share is for.
+	Member keys.ID `json:"member"`
+	// Sender is the EdX25519 key ID of the member that signed the share.
+	Sender keys.ID `json:"sender"`
+	// Data is CryptoBoxSeal(epoch || group private key || signature ||
+	// address, member).
+	Data []byte `json:"data"`
+}
+
+// Shares returns the group key for the current epoch encrypted to each
+// member, to distribute after New, Add, Remove or Rotate.
+// The shares are signed by the sender, which must be an (EdX25519) member.
+func (g *Group) Shares(sender *keys.EdX25519Key) ([]*Share, error) {
+	if !g.address.Contains(sender.ID()) {
+		return nil, errors.Errorf("%s is not a member", sender.ID())
+	}
+	address := g.address.String()
+	shares := make([]*Share, 0, len(g.address.IDs()))
+	for _, id := range g.address.IDs() {
+		pk, err := memberKey(id)
+		if err != nil {
+			return nil, err
+		}
+		sig := sender.SignDetached(shareSignMessage(g.epoch, g.Key().PublicKey(), id, address))
+		shares = append(shares, &Share{
+			Address: address,
+			Epoch:   g.epoch,
+			Member:  id,
+			Sender:  sender.ID(),
+			Data:    keys.CryptoBoxSeal(sharePayload(g.epoch, g.Key(), sig, address), pk),
+		})
+	}
+	return shares, nil
+}
+
+// NewFromShare creates a group from a member's share.
+// The key is the member's X25519 key (for EdX25519 members, use
+// EdX25519Key.X25519Key()).
+func NewFromShare(share *Share, key *keys.X25519Key) (*Group, error) {
+	address, epoch, gk, err := openShare(share, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{
+		address: address,
+		epoch:   epoch,
+		keys:    map[uint32]*keys.X25519Key{epoch: gk},
+	}, nil
+}
+
+// Update group from a member's share.
+// The share must be signed by a member of the (current) group, and can't
+// change the group key for a known epoch.
+// If the share is for a newer epoch, it becomes the current epoch.
+func (g *Group) Update(share *Share, key *keys.X25519Key) error {
+	address, epoch, gk, err := openShare(share, key)
+	if err != nil {
+		return err
+	}
+	if !g.address.Contains(share.Sender) {
+		return errors.Errorf("share sender %s is not a member", share.Sender)
+	}
+	if existing, ok := g.keys[epoch]; ok {
+		if existing.ID() != gk.ID() {
+			return errors.Errorf("group key for epoch %d already exists", epoch)
+		}
+		return nil
+	}
+	g.keys[epoch] = gk
+	if epoch > g.epoch {
+		g.epoch = epoch
+		g.address = address
+	}
+	return nil
+}
+
+func openShare(share *Share, key *keys.X25519Key) (*keys.Address, uint32, *keys.X25519Key, error) {
+	if share == nil {
+		return nil, 0, nil, errors.Errorf("no share")
+	}
+	pk, err := memberKey(share.Member)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if *pk.Bytes32() != *key.PublicKey().Bytes32() {
+		return nil, 0, nil, errors.Errorf("share is not for key %s", key.ID())
+	}
+	spk, err := keys.NewEdX25519PublicKeyFromID(share.Sender)
+	if err != nil {
+		return nil, 0, nil, errors.Wrapf(err, "invalid share sender")
+	}
+	b, err := keys.CryptoBoxSealOpen(share.Data, key)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if len(b) < 100 {
+		return nil, 0, nil, errors.Errorf("invalid share")
+	}
+	epoch := binary.BigEndian.Uint32(b[:4])
+	gk := keys.NewX25519KeyFromPrivateKey(keys.Bytes32(b[4:36]))
+	sig := b[36:100]
+	if epoch != share.Epoch || string(b[100:]) != share.Address {
+		return nil, 0, nil, errors.Errorf("invalid share")
+	}
+	address, err := keys.ParseAddress(share.Address)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if !address.Contains(share.Member) || !address.Contains(share.Sender) {
+		return nil, 0, nil, errors.Errorf("invalid share")
+	}
+	if err := spk.VerifyDetached(sig, shareSignMessage(epoch, gk.PublicKey(), share.Member, share.Address)); err != nil {
+		return nil, 0, nil, errors.Wrapf(err, "invalid share signature")
+	}
+	return address, epoch, gk, nil
+}
+
+func sharePayload(epoch uint32, key *keys.X25519Key, sig []byte, address string) []byte {
+	b := make([]byte, 4, 100+len(address))
+	binary.BigEndian.PutUint32(b, epoch)
+	b = append(b, key.Private()...)
+	b = append(b, sig...)
+	return append(b, []byte(address)...)
+}
+
+// shareSignMessage is the message the sender signs, binding the group key to
+// the epoch, member and address.
+func shareSignMessage(epoch uint32, pk *keys.X25519PublicKey, member keys.ID, address string) []byte {
+	b := []byte(shareSignContext)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[len(shareSignContext):], epoch)
+	b = append(b, pk.Bytes()...)
+	b = append(b, []byte(member)...)
+	b = append(b, 0)
+	return append(b, []byte(address)...)
+}
@@ -0,0 +1,101 @@
+package jws
+
+import (
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// JWK is a JSON Web Key for an octet key pair (OKP), see RFC 8037.
+type JWK struct {
+	// Kty is the key type, always "OKP".
+	Kty string `json:"kty"`
+	// Crv is the curve, "Ed25519" or "X25519".
+	Crv string `json:"crv"`
+	// X is the public key.
+	X string `json:"x"`
+	// D is the private key (optional).
+	D string `json:"d,omitempty"`
+	// KID is the key ID.
+	KID keys.ID `json:"kid,omitempty"`
+}
+
+const (
+	kty   = "OKP"
+	crvEd = "Ed25519"
+	crvX  = "X25519"
+)
+
+// NewJWK creates a JWK from a key.
+// Supports EdX25519Key, EdX25519PublicKey, X25519Key and X25519PublicKey.
+// For private keys, the JWK includes the private key (d).
+func NewJWK(key keys.Key) (*JWK, error) {
+	switch k := key.(type) {
+	case *keys.EdX25519Key:
+		return &JWK{Kty: kty, Crv: crvEd, X: encode(k.Public()), D: encode(k.Seed()[:]), KID: k.ID()}, nil
+	case *keys.EdX25519PublicKey:
+		return &JWK{Kty: kty, Crv: crvEd, X: encode(k.Public()), KID: k.ID()}, nil
+	case *keys.X25519Key:
+		return &JWK{Kty: kty, Crv: crvX, X: encode(k.Public()), D: encode(k.Private()), KID: k.ID()}, nil
+	case *keys.X25519PublicKey:
+		return &JWK{Kty: kty, Crv: crvX, X: encode(k.Public()), KID: k.ID()}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %s", key.Type())
+	}
+}
+
+// Public returns a JWK without the private key.
+func (j *JWK) Public() *JWK {
+	return &JWK{Kty: j.Kty, Crv: j.Crv, X: j.X, KID: j.KID}
+}
+
+// Key returns a keys.Key for the JWK.
+// Returns a EdX25519Key, EdX25519PublicKey, X25519Key or X25519PublicKey.
+func (j *JWK) Key() (keys.Key, error) {
+	if j.Kty != kty {
+		return nil, errors.Errorf("unsupported jwk kty %q", j.Kty)
+	}
+	x, err := decode(j.X)
+	if err != nil || len(x) != 32 {
+		return nil, errors.Errorf("invalid jwk x")
+	}
+	var d []byte
+	if j.D != "" {
+		d, err = decode(j.D)
+		if err != nil || len(d) != 32 {
+			return nil, errors.Errorf("invalid jwk d")
+		}
+	}
+
+	var key keys.Key
+	switch j.Crv {
+	case crvEd:
+		pk := keys.NewEdX25519PublicKey(keys.Bytes32(x))
+		if d == nil {
+			key = pk
+			break
+		}
+		sk := keys.NewEdX25519KeyFromSeed(keys.Bytes32(d))
+		if sk.ID() != pk.ID() {
+			return nil, errors.Errorf("jwk public key mismatch")
+		}
+		key = sk
+	case crvX:
+		pk := keys.NewX25519PublicKey(keys.Bytes32(x))
+		if d == nil {
+			key = pk
+			break
+		}
+		sk := keys.NewX25519KeyFromPrivateKey(keys.Bytes32(d))
+		if sk.ID() != pk.ID() {
+			return nil, errors.Errorf("jwk public key mismatch")
+		}
+		key = sk
+	default:
+		return nil, errors.Errorf("unsupported jwk crv %q", j.Crv)
+	}
+
+	if j.KID != "" && j.KID != key.ID() {
+		return nil, errors.Errorf("jwk kid mismatch")
+	}
+	return key, nil
+}
@@ -0,0 +1,66 @@
+package jws_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/jws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWK(t *testing.T) {
+	// https://tools.ietf.org/html/rfc8037#appendix-A.1
+	seed, err := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	require.NoError(t, err)
+	sk := keys.NewEdX25519KeyFromSeed(keys.Bytes32(seed))
+
+	jwk, err := jws.NewJWK(sk)
+	require.NoError(t, err)
+	require.Equal(t, "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A", jwk.D)
+	require.Equal(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", jwk.X)
+
+	b, err := json.Marshal(jwk.Public())
+	require.NoError(t, err)
+	expected := `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo","kid":"` + sk.ID().String() + `"}`
+	require.Equal(t, expected, string(b))
+
+	var in jws.JWK
+	err = json.Unmarshal([]byte(`{"kty":"OKP","crv":"Ed25519","d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`), &in)
+	require.NoError(t, err)
+	key, err := in.Key()
+	require.NoError(t, err)
+	require.Equal(t, sk, key)
+
+	pub, err := jwk.Public().Key()
+	require.NoError(t, err)
+	require.Equal(t, sk.PublicKey(), pub)
+
+	// Mismatched kid
+	bad := jwk.Public()
+	bad.KID = keys.RandID("kex")
+	_, err = bad.Key()
+	require.EqualError(t, err, "jwk kid mismatch")
+}
+
+func TestJWKX25519(t *testing.T) {
+	// https://tools.ietf.org/html/rfc8037#appendix-A.6
+	priv, err := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	require.NoError(t, err)
+	bk := keys.NewX25519KeyFromPrivateKey(keys.Bytes32(priv))
+
+	jwk, err := jws.NewJWK(bk.PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, "X25519", jwk.Crv)
+	require.Equal(t, "hSDwCYkwp1R0i33ctD73Wg2_Og0mOBr066SpjqqbTmo", jwk.X)
+
+	jwk, err = jws.NewJWK(bk)
+	require.NoError(t, err)
+	key, err := jwk.Key()
+	require.NoError(t, err)
+	require.Equal(t, bk, key)
+
+	_, err = jws.NewJWK(bk.ID())
+	require.EqualError(t, err, "unsupported key type x25519")
+}
@@ -0,0 +1,137 @@
+// Package jws provides JSON Web Signatures (JWS), JSON Web Keys (JWK) and
+// JSON Web Tokens (JWT) using EdX25519 keys (EdDSA).
+package jws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// EdDSA is the JWS algorithm for EdX25519 (Ed25519) signatures, see RFC 8037.
+const EdDSA = "EdDSA"
+
+// Header is a JWS protected header.
+type Header struct {
+	// Alg is the signature algorithm (always "EdDSA").
+	Alg string `json:"alg"`
+	// Typ is the media type, e.g. "JWT".
+	Typ string `json:"typ,omitempty"`
+	// KID is the key ID of the signer.
+	KID keys.ID `json:"kid,omitempty"`
+	// Crit lists extensions that must be understood (unsupported).
+	Crit []string `json:"crit,omitempty"`
+}
+
+// Sign payload with a EdX25519Key, returning a JWS in compact serialization.
+// The "kid" header is set to the key ID.
+func Sign(payload []byte, key *keys.EdX25519Key) (string, error) {
+	return SignWithHeader(payload, &Header{KID: key.ID()}, key)
+}
+
+// SignWithHeader signs payload with a EdX25519Key and header.
+// The header alg is always set to "EdDSA".
+func SignWithHeader(payload []byte, header *Header, key *keys.EdX25519Key) (string, error) {
+	if header == nil {
+		header = &Header{}
+	}
+	if header.KID != "" && header.KID != key.ID() {
+		return "", errors.Errorf("header kid mismatch")
+	}
+	if len(header.Crit) > 0 {
+		return "", errors.Errorf("crit header unsupported")
+	}
+	hdr := *header
+	hdr.Alg = EdDSA
+	hb, err := json.Marshal(hdr)
+	if err != nil {
+		return "", err
+	}
+	input := encode(hb) + "." + encode(payload)
+	sig := key.SignDetached([]byte(input))
+	return input + "." + encode(sig), nil
+}
+
+// Verify a JWS (compact serialization), using the key from the "kid" header.
+// Returns the payload and header.
+func Verify(token string) ([]byte, *Header, error) {
+	header, _, err := Decode(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.KID == "" {
+		return nil, nil, errors.Errorf("no kid header")
+	}
+	pk, err := keys.NewEdX25519PublicKeyFromID(header.KID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid kid header")
+	}
+	payload, err := VerifyWithKey(token, pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, header, nil
+}
+
+// VerifyWithKey verifies a JWS (compact serialization) with a public key.
+// If the "kid" header is present, it must match the key.
+func VerifyWithKey(token string, pk *keys.EdX25519PublicKey) ([]byte, error) {
+	header, payload, err := Decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if header.KID != "" && header.KID != pk.ID() {
+		return nil, errors.Errorf("kid mismatch")
+	}
+	i := strings.LastIndex(token, ".")
+	sig, err := decode(token[i+1:])
+	if err != nil {
+		return nil, errors.Errorf("invalid signature encoding")
+	}
+	if len(sig) != keys.SignOverhead {
+		return nil, keys.ErrVerifyFailed
+	}
+	if err := pk.VerifyDetached(sig, []byte(token[:i])); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Decode a JWS (compact serialization) without verifying it.
+// Returns an error if the alg isn't "EdDSA".
+func Decode(token string) (*Header, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.Errorf("invalid jws")
+	}
+	hb, err := decode(parts[0])
+	if err != nil {
+		return nil, nil, errors.Errorf("invalid header encoding")
+	}
+	var header Header
+	if err := json.Unmarshal(hb, &header); err != nil {
+		return nil, nil, errors.Errorf("invalid header")
+	}
+	if header.Alg != EdDSA {
+		return nil, nil, errors.Errorf("unsupported alg %q", header.Alg)
+	}
+	if len(header.Crit) > 0 {
+		return nil, nil, errors.Errorf("crit header unsupported")
+	}
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, nil, errors.Errorf("invalid payload encoding")
+	}
+	return &header, payload, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
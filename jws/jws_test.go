@@ -0,0 +1,69 @@
+package jws_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/jws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	sk := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+
+	token, err := jws.Sign([]byte("hi"), sk)
+	require.NoError(t, err)
+	require.Equal(t, "eyJhbGciOiJFZERTQSIsImtpZCI6ImtleDEzMnl3OGh0NXA4Y2V0bDJqbXZrbmV3amF3dDl4d3pkbHJrMnB5eGxud2p5cXJkcTBkYXdxcXBoMDc3In0.aGk.", token[:strings.LastIndex(token, ".")+1])
+
+	payload, header, err := jws.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hi"), payload)
+	require.Equal(t, sk.ID(), header.KID)
+	require.Equal(t, jws.EdDSA, header.Alg)
+
+	payload, err = jws.VerifyWithKey(token, sk.PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, []byte("hi"), payload)
+
+	sk2 := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	_, err = jws.VerifyWithKey(token, sk2.PublicKey())
+	require.EqualError(t, err, "kid mismatch")
+
+	// Tampered payload
+	parts := strings.Split(token, ".")
+	_, _, err = jws.Verify(parts[0] + ".aGl5." + parts[2])
+	require.EqualError(t, err, "verify failed")
+
+	// Unsigned
+	_, _, err = jws.Verify("eyJhbGciOiJub25lIn0.aGk.")
+	require.EqualError(t, err, `unsupported alg "none"`)
+
+	_, _, err = jws.Verify("invalid")
+	require.EqualError(t, err, "invalid jws")
+}
+
+func TestRFC8037(t *testing.T) {
+	// https://tools.ietf.org/html/rfc8037#appendix-A.4
+	seed, err := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	require.NoError(t, err)
+	sk := keys.NewEdX25519KeyFromSeed(keys.Bytes32(seed))
+
+	token, err := jws.SignWithHeader([]byte("Example of Ed25519 signing"), &jws.Header{}, sk)
+	require.NoError(t, err)
+	expected := "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc.hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+	require.Equal(t, expected, token)
+
+	payload, err := jws.VerifyWithKey(expected, sk.PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, "Example of Ed25519 signing", string(payload))
+
+	// No kid header
+	_, _, err = jws.Verify(expected)
+	require.EqualError(t, err, "no kid header")
+}
+
+func testSeed(b byte) *[32]byte {
+	return keys.Bytes32([]byte(strings.Repeat(string([]byte{b}), 32)))
+}
@@ -0,0 +1,185 @@
+package jws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/pkg/errors"
+)
+
+// ErrTokenExpired if token is expired (exp).
+var ErrTokenExpired = errors.New("token expired")
+
+// ErrTokenNotValidYet if token isn't valid yet (nbf).
+var ErrTokenNotValidYet = errors.New("token not valid yet")
+
+// ErrInvalidAudience if token audience (aud) doesn't match.
+var ErrInvalidAudience = errors.New("invalid audience")
+
+// Claims are registered JWT claims, see RFC 7519.
+// Embed Claims in your own struct to add custom claims.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Audience (aud) which can be a string or array of strings.
+type Audience []string
+
+// MarshalJSON marshals a single audience as a string.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON unmarshals a string or array of strings.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var arr []string
+	if err := json.Unmarshal(b, &arr); err != nil {
+		return errors.Errorf("invalid aud")
+	}
+	*a = Audience(arr)
+	return nil
+}
+
+// Contains returns true if audience contains aud.
+func (a Audience) Contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// SignJWT signs claims as a JWT.
+// The claims can be a *Claims or a struct that embeds Claims.
+// The "kid" header is set to the key ID.
+func SignJWT(claims interface{}, key *keys.EdX25519Key) (string, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return SignWithHeader(b, &Header{Typ: "JWT", KID: key.ID()}, key)
+}
+
+// VerifyOptions are options for VerifyJWT.
+type VerifyOptions struct {
+	// Clock for exp and nbf checks, defaults to tsutil.NewClock().
+	Clock tsutil.Clock
+	// Leeway for clock skew.
+	Leeway time.Duration
+	// Audience, if set, must be in the token aud claim.
+	Audience string
+	// Key, if set, must have signed the token, otherwise the "kid" header
+	// is used.
+	Key *keys.EdX25519PublicKey
+}
+
+// VerifyOption ...
+type VerifyOption func(*VerifyOptions)
+
+func newVerifyOptions(opts ...VerifyOption) VerifyOptions {
+	var options VerifyOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Clock == nil {
+		options.Clock = tsutil.NewClock()
+	}
+	return options
+}
+
+// WithClock option.
+func WithClock(clock tsutil.Clock) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Clock = clock
+	}
+}
+
+// WithLeeway option.
+func WithLeeway(leeway time.Duration) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Leeway = leeway
+	}
+}
+
+// WithAudience option.
+func WithAudience(aud string) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Audience = aud
+	}
+}
+
+// WithKey option.
+func WithKey(pk *keys.EdX25519PublicKey) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Key = pk
+	}
+}
+
+// VerifyJWT verifies a JWT and validates the exp, nbf and aud claims.
+// If claims is not nil, the payload is also unmarshalled into it.
+// Returns the registered claims and the signer key ID.
+func VerifyJWT(token string, claims interface{}, opt ...VerifyOption) (*Claims, keys.ID, error) {
+	opts := newVerifyOptions(opt...)
+
+	var payload []byte
+	var kid keys.ID
+	if opts.Key != nil {
+		b, err := VerifyWithKey(token, opts.Key)
+		if err != nil {
+			return nil, "", err
+		}
+		payload, kid = b, opts.Key.ID()
+	} else {
+		b, header, err := Verify(token)
+		if err != nil {
+			return nil, "", err
+		}
+		payload, kid = b, header.KID
+	}
+
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, "", errors.Errorf("invalid claims")
+	}
+	if err := c.Validate(opts.Clock.Now(), opts.Leeway, opts.Audience); err != nil {
+		return nil, "", err
+	}
+	if claims != nil {
+		if err := json.Unmarshal(payload, claims); err != nil {
+			return nil, "", errors.Errorf("invalid claims")
+		}
+	}
+	return &c, kid, nil
+}
+
+// Validate exp and nbf claims at time now, and if aud is specified, that the
+// aud claim contains it.
+func (c Claims) Validate(now time.Time, leeway time.Duration, aud string) error {
+	if c.ExpiresAt != 0 && !now.Before(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if aud != "" && !c.Audience.Contains(aud) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package jws_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/jws"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWT(t *testing.T) {
+	sk := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	clock := tsutil.NewTestClock()
+	now := clock.Now()
+
+	type customClaims struct {
+		jws.Claims
+		Scope string `json:"scope"`
+	}
+	claims := &customClaims{
+		Claims: jws.Claims{
+			Issuer:    "keys.pub",
+			Audience:  jws.Audience{"api"},
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		},
+		Scope: "read",
+	}
+	token, err := jws.SignJWT(claims, sk)
+	require.NoError(t, err)
+
+	var out customClaims
+	c, kid, err := jws.VerifyJWT(token, &out, jws.WithClock(clock), jws.WithAudience("api"))
+	require.NoError(t, err)
+	require.Equal(t, sk.ID(), kid)
+	require.Equal(t, "keys.pub", c.Issuer)
+	require.Equal(t, "read", out.Scope)
+
+	_, _, err = jws.VerifyJWT(token, nil, jws.WithClock(clock), jws.WithKey(sk.PublicKey()))
+	require.NoError(t, err)
+
+	_, _, err = jws.VerifyJWT(token, nil, jws.WithClock(clock), jws.WithAudience("other"))
+	require.Equal(t, jws.ErrInvalidAudience, err)
+
+	clock.Add(time.Hour)
+	_, _, err = jws.VerifyJWT(token, nil, jws.WithClock(clock))
+	require.Equal(t, jws.ErrTokenExpired, err)
+	_, _, err = jws.VerifyJWT(token, nil, jws.WithClock(clock), jws.WithLeeway(time.Minute))
+	require.NoError(t, err)
+
+	clock = tsutil.NewTestClockAt(tsutil.Millis(now.Add(-time.Minute)))
+	_, _, err = jws.VerifyJWT(token, nil, jws.WithClock(clock))
+	require.Equal(t, jws.ErrTokenNotValidYet, err)
+}
+
+func TestAudience(t *testing.T) {
+	sk := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	clock := tsutil.NewTestClock()
+
+	token, err := jws.SignJWT(&jws.Claims{Audience: jws.Audience{"a", "b"}}, sk)
+	require.NoError(t, err)
+	c, _, err := jws.VerifyJWT(token, nil, jws.WithClock(clock), jws.WithAudience("b"))
+	require.NoError(t, err)
+	require.Equal(t, jws.Audience{"a", "b"}, c.Audience)
+}
@@ -17,27 +17,33 @@ func newCipherState(handshake *Handshake) cipherState {
 // Encrypt to out.
 func (n cipherState) Encrypt(out, ad, plaintext []byte) ([]byte, error) {
 	if n.initiator {
-		if n.csI0 == nil {
+		if n.cs0 == nil {
 			return nil, errors.Errorf("no cipher for encrypt (I)")
 		}
-		return n.csI0.Encrypt(out, ad, plaintext)
+		return n.cs0.Encrypt(out, ad, plaintext)
 	}
-	if n.csR1 == nil {
+	if n.pattern == N {
+		return nil, errors.Errorf("no cipher for encrypt (R), pattern N is one-way")
+	}
+	if n.cs1 == nil {
 		return nil, errors.Errorf("no cipher for encrypt (R)")
 	}
-	return n.csR1.Encrypt(out, ad, plaintext)
+	return n.cs1.Encrypt(out, ad, plaintext)
 }
 
 // Decrypt to out.
 func (n cipherState) Decrypt(out, ad, ciphertext []byte) ([]byte, error) {
 	if n.initiator {
-		if n.csI1 == nil {
+		if n.pattern == N {
+			return nil, errors.Errorf("no cipher for decrypt (I), pattern N is one-way")
+		}
+		if n.cs1 == nil {
 			return nil, errors.Errorf("no cipher for decrypt (I)")
 		}
-		return n.csI1.Decrypt(out, ad, ciphertext)
+		return n.cs1.Decrypt(out, ad, ciphertext)
 	}
-	if n.csR0 == nil {
+	if n.cs0 == nil {
 		return nil, errors.Errorf("no cipher for decrypt (R)")
 	}
-	return n.csR0.Decrypt(out, ad, ciphertext)
+	return n.cs0.Decrypt(out, ad, ciphertext)
 }
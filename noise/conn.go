@@ -0,0 +1,537 @@
+package noise
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// maxPlaintext is the maximum plaintext in a transport frame (the maximum
+// Noise message length minus the AEAD tag).
+const maxPlaintext = noise.MaxMsgLen - 16
+
+// ConnOptions for Client, Server, Dial and Listen.
+type ConnOptions struct {
+	// Handshake options, for example the pattern.
+	Handshake []HandshakeOption
+	// HandshakeTimeout is the maximum time for the handshake, if not zero.
+	HandshakeTimeout time.Duration
+	// RekeyInterval is the number of frames (in each direction) after which
+	// the cipher is rekeyed, if not zero.
+	RekeyInterval uint64
+	// Identity to send and verify identity proofs in the handshake, optional.
+	Identity *Identity
+}
+
+// ConnOption for ConnOptions.
+type ConnOption func(*ConnOptions)
+
+func newConnOptions(opts ...ConnOption) ConnOptions {
+	options := ConnOptions{
+		HandshakeTimeout: time.Second * 30,
+		RekeyInterval:    65536,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// ConnHandshake sets the handshake options.
+func ConnHandshake(opt ...HandshakeOption) ConnOption {
+	return func(o *ConnOptions) {
+		o.Handshake = append(o.Handshake, opt...)
+	}
+}
+
+// HandshakeTimeout sets the maximum time for the handshake.
+func HandshakeTimeout(dt time.Duration) ConnOption {
+	return func(o *ConnOptions) {
+		o.HandshakeTimeout = dt
+	}
+}
+
+// RekeyInterval sets the number of frames after which the cipher is rekeyed.
+// Both sides must use the same interval.
+func RekeyInterval(n uint64) ConnOption {
+	return func(o *ConnOptions) {
+		o.RekeyInterval = n
+	}
+}
+
+// ConnIdentity sets the identity, to bind the Conn to the participants
+// EdX25519 keys.
+// Both participants must use an identity.
+// The local static key is the identity's X25519 key.
+func ConnIdentity(identity *Identity) ConnOption {
+	return func(o *ConnOptions) {
+		o.Identity = identity
+	}
+}
+
+// Conn is a net.Conn secured by a Noise handshake.
+//
+// Handshake and transport messages are sent as frames, with a 2 byte (big
+// endian) length prefix. Writes larger than the maximum frame are split.
+//
+// The handshake is run on the first Read or Write, or you can call Handshake
+// explicitly.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	hs   *Handshake
+	opts ConnOptions
+
+	hsMtx  sync.Mutex
+	hsDone bool
+	hsErr  error
+	peer   *Peer
+
+	// Deadlines set by the caller, and the handshake deadline (if the
+	// handshake is in progress).
+	dmtx       sync.Mutex
+	rdeadline  time.Time
+	wdeadline  time.Time
+	hsDeadline time.Time
+
+	rmtx   sync.Mutex
+	rbuf   []byte
+	rcount uint64
+	rerr   error
+
+	wmtx   sync.Mutex
+	wcount uint64
+	werr   error
+}
+
+// Client returns a Conn for the initiator of the handshake.
+// The remote key is required if it is known in advance for the pattern (KK,
+// IK, NK, N).
+func Client(conn net.Conn, key *keys.X25519Key, remote *keys.X25519PublicKey, opt ...ConnOption) (*Conn, error) {
+	return newConn(conn, key, remote, true, opt...)
+}
+
+// Server returns a Conn for the responder of the handshake.
+// The remote key is required if it is known in advance for the pattern (KK).
+func Server(conn net.Conn, key *keys.X25519Key, remote *keys.X25519PublicKey, opt ...ConnOption) (*Conn, error) {
+	return newConn(conn, key, remote, false, opt...)
+}
+
+func newConn(conn net.Conn, key *keys.X25519Key, remote *keys.X25519PublicKey, initiator bool, opt ...ConnOption) (*Conn, error) {
+	opts := newConnOptions(opt...)
+	if opts.Identity != nil {
+		if key == nil {
+			key = opts.Identity.X25519Key()
+		} else if key.ID() != opts.Identity.X25519Key().ID() {
+			return nil, errors.Errorf("key doesn't match identity")
+		}
+	}
+	hs, err := NewHandshake(key, remote, initiator, opts.Handshake...)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		conn: conn,
+		br:   bufio.NewReaderSize(conn, 2+noise.MaxMsgLen),
+		hs:   hs,
+		opts: opts,
+	}, nil
+}
+
+// Dial connects to the address and runs the handshake as initiator.
+func Dial(network string, address string, key *keys.X25519Key, remote *keys.X25519PublicKey, opt ...ConnOption) (*Conn, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Client(conn, key, remote, opt...)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := c.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type listener struct {
+	net.Listener
+	key    *keys.X25519Key
+	remote *keys.X25519PublicKey
+	opts   []ConnOption
+}
+
+// Listen for connections, returning a net.Listener whose connections are
+// Server (responder) Conn's.
+// The handshake is run on the first Read or Write of the accepted connection.
+func Listen(network string, address string, key *keys.X25519Key, remote *keys.X25519PublicKey, opt ...ConnOption) (net.Listener, error) {
+	// Check the options.
+	if _, err := Server(nil, key, remote, opt...); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: l, key: key, remote: remote, opts: opt}, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c, err := Server(conn, l.key, l.remote, l.opts...)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Handshake runs the handshake, if it hasn't been run already.
+func (c *Conn) Handshake() error {
+	return c.HandshakeContext(context.Background())
+}
+
+// HandshakeContext runs the handshake, if it hasn't been run already.
+// The context deadline (if earlier than the handshake timeout) applies to
+// the handshake, and if the context is cancelled the handshake is
+// interrupted and fails. The context is also used for the identity (peer)
+// lookup.
+func (c *Conn) HandshakeContext(ctx context.Context) error {
+	c.hsMtx.Lock()
+	defer c.hsMtx.Unlock()
+	if c.hsDone {
+		return c.hsErr
+	}
+	c.hsDone = true
+	if err := ctx.Err(); err != nil {
+		c.hsErr = err
+		return err
+	}
+
+	var deadline time.Time
+	if c.opts.HandshakeTimeout > 0 {
+		deadline = time.Now().Add(c.opts.HandshakeTimeout)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		deadline = earliest(deadline, d)
+	}
+	if err := c.setHandshakeDeadline(deadline); err != nil {
+		c.hsErr = err
+		return err
+	}
+	// Restore the caller's deadlines.
+	defer func() { _ = c.setHandshakeDeadline(time.Time{}) }()
+
+	// Interrupt the handshake I/O if the context is cancelled.
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = c.setHandshakeDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	err := c.handshake(ctx)
+	close(done)
+	// Wait, so the deadlines are restored after an interrupt.
+	<-exited
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	c.hsErr = err
+	return c.hsErr
+}
+
+// setHandshakeDeadline sets the handshake deadline, the earlier of the
+// handshake deadline and the caller's deadlines applies.
+func (c *Conn) setHandshakeDeadline(t time.Time) error {
+	c.dmtx.Lock()
+	defer c.dmtx.Unlock()
+	c.hsDeadline = t
+	if err := c.conn.SetReadDeadline(earliest(c.rdeadline, t)); err != nil {
+		return err
+	}
+	return c.conn.SetWriteDeadline(earliest(c.wdeadline, t))
+}
+
+// earliest returns the earlier time, where zero means no deadline.
+func earliest(t1 time.Time, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
+
+func (c *Conn) handshake(ctx context.Context) error {
+	identity := c.opts.Identity
+	initiator := c.hs.Initiator()
+	write := initiator
+	for i := 0; !c.hs.Complete(); i++ {
+		if write {
+			var payload []byte
+			if identity != nil && c.hs.hasStatic(initiator) && i == c.hs.lastMessage(initiator) {
+				payload = identity.Proof()
+			}
+			b, err := c.hs.Write(payload)
+			if err != nil {
+				return err
+			}
+			if err := writeFrame(c.conn, b); err != nil {
+				return err
+			}
+		} else {
+			b, err := readFrame(c.br)
+			if err != nil {
+				if _, ok := err.(net.Error); ok {
+					return err
+				}
+				return errors.Wrapf(unexpectedEOF(err), "failed to read handshake")
+			}
+			payload, err := c.hs.Read(b)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read handshake")
+			}
+			if identity != nil && c.hs.hasStatic(!initiator) && i == c.hs.lastMessage(!initiator) {
+				remote := keys.NewX25519PublicKey(keys.Bytes32(c.hs.state.PeerStatic()))
+				peer, err := identity.VerifyPeer(ctx, remote, payload)
+				if err != nil {
+					return err
+				}
+				c.peer = peer
+			}
+		}
+		write = !write
+	}
+	return nil
+}
+
+// RemoteStatic returns the remote static key from the handshake.
+func (c *Conn) RemoteStatic() (*keys.X25519PublicKey, error) {
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+	return c.hs.RemoteStatic()
+}
+
+// ExportSecret returns a secret derived from the handshake, see
+// Handshake.ExportSecret.
+func (c *Conn) ExportSecret(label string) (*[32]byte, error) {
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+	return c.hs.ExportSecret(label)
+}
+
+// Peer returns the remote identity, verified in the handshake, if
+// ConnIdentity was set.
+// Returns nil if the remote is anonymous (as in the NK and N patterns).
+func (c *Conn) Peer() (*Peer, error) {
+	if c.opts.Identity == nil {
+		return nil, errors.Errorf("no identity")
+	}
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+	return c.peer, nil
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.rmtx.Lock()
+	defer c.rmtx.Unlock()
+	for len(c.rbuf) == 0 {
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		frame, err := readFrame(c.br)
+		if err != nil {
+			// Don't keep timeout errors, so the caller can retry after
+			// extending the deadline (a partially read frame is buffered).
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, err
+			}
+			c.rerr = err
+			return 0, err
+		}
+		out, err := c.decrypt(frame)
+		if err != nil {
+			c.rerr = errors.Wrapf(err, "failed to decrypt")
+			return 0, c.rerr
+		}
+		c.rbuf = out
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *Conn) decrypt(frame []byte) ([]byte, error) {
+	cs := c.hs.cs0
+	if c.hs.initiator {
+		if c.hs.pattern == N {
+			return nil, errors.Errorf("pattern N is one-way")
+		}
+		cs = c.hs.cs1
+	}
+	out, err := cs.Decrypt(nil, nil, frame)
+	if err != nil {
+		return nil, err
+	}
+	c.rcount++
+	if c.opts.RekeyInterval > 0 && c.rcount%c.opts.RekeyInterval == 0 {
+		cs.Rekey()
+	}
+	return out, nil
+}
+
+// Write writes data to the connection.
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	if c.werr != nil {
+		return 0, c.werr
+	}
+	n := 0
+	for len(b) > 0 {
+		k := len(b)
+		if k > maxPlaintext {
+			k = maxPlaintext
+		}
+		frame, err := c.encrypt(b[:k])
+		if err != nil {
+			c.werr = err
+			return n, err
+		}
+		if err := writeFrame(c.conn, frame); err != nil {
+			// After a partial write the stream is out of sync.
+			c.werr = err
+			return n, err
+		}
+		n += k
+		b = b[k:]
+	}
+	return n, nil
+}
+
+func (c *Conn) encrypt(b []byte) ([]byte, error) {
+	cs := c.hs.cs1
+	if c.hs.initiator {
+		cs = c.hs.cs0
+	} else if c.hs.pattern == N {
+		return nil, errors.Errorf("pattern N is one-way")
+	}
+	out, err := cs.Encrypt(nil, nil, b)
+	if err != nil {
+		return nil, err
+	}
+	c.wcount++
+	if c.opts.RekeyInterval > 0 && c.wcount%c.opts.RekeyInterval == 0 {
+		cs.Rekey()
+	}
+	return out, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+// The deadlines also apply to the handshake.
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.dmtx.Lock()
+	defer c.dmtx.Unlock()
+	c.rdeadline = t
+	return c.conn.SetReadDeadline(earliest(t, c.hsDeadline))
+}
+
+// SetWriteDeadline sets the write deadline.
+// After a write has timed out, the Conn is not usable for writes, since a
+// frame may have been partially written.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.dmtx.Lock()
+	defer c.dmtx.Unlock()
+	c.wdeadline = t
+	return c.conn.SetWriteDeadline(earliest(t, c.hsDeadline))
+}
+
+func writeFrame(w io.Writer, b []byte) error {
+	if len(b) > noise.MaxMsgLen {
+		return errors.Errorf("frame too large")
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame, which is only consumed from the reader when it is
+// complete.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	hdr, err := r.Peek(2)
+	if err != nil {
+		if len(hdr) > 0 {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, err
+	}
+	n := 2 + int(binary.BigEndian.Uint16(hdr))
+	b, err := r.Peek(n)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	frame := make([]byte, n-2)
+	copy(frame, b[2:])
+	if _, err := r.Discard(n); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,282 @@
+package noise_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/noise"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func testPipe(t *testing.T, clientOpts []noise.ConnOption, serverOpts []noise.ConnOption) (*noise.Conn, *noise.Conn) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	c1, c2 := net.Pipe()
+	client, err := noise.Client(c1, alice, bob.PublicKey(), clientOpts...)
+	require.NoError(t, err)
+	server, err := noise.Server(c2, bob, alice.PublicKey(), serverOpts...)
+	require.NoError(t, err)
+	return client, server
+}
+
+func testSeed(b byte) *[32]byte {
+	return keys.Bytes32(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestConn(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	message := testMessage(200000)
+
+	for _, pattern := range []noise.Pattern{noise.KK, noise.XX, noise.IK} {
+		c1, c2 := net.Pipe()
+		var clientRemote, serverRemote *keys.X25519PublicKey
+		switch pattern {
+		case noise.KK:
+			clientRemote, serverRemote = bob.PublicKey(), alice.PublicKey()
+		case noise.IK:
+			clientRemote = bob.PublicKey()
+		}
+		opts := []noise.ConnOption{noise.ConnHandshake(noise.WithPattern(pattern)), noise.RekeyInterval(2)}
+		client, err := noise.Client(c1, alice, clientRemote, opts...)
+		require.NoError(t, err)
+		server, err := noise.Server(c2, bob, serverRemote, opts...)
+		require.NoError(t, err)
+
+		// Echo
+		go func() {
+			b := make([]byte, len(message))
+			if _, err := io.ReadFull(server, b); err != nil {
+				return
+			}
+			_, _ = server.Write(b)
+		}()
+
+		n, err := client.Write(message)
+		require.NoError(t, err)
+		require.Equal(t, len(message), n)
+		out := make([]byte, len(message))
+		_, err = io.ReadFull(client, out)
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+
+		rs, err := client.RemoteStatic()
+		require.NoError(t, err)
+		require.Equal(t, bob.ID(), rs.ID())
+		rs, err = server.RemoteStatic()
+		require.NoError(t, err)
+		require.Equal(t, alice.ID(), rs.ID())
+
+		require.NoError(t, client.Close())
+		_, err = server.Read(out)
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestConnRekeyMismatch(t *testing.T) {
+	client, server := testPipe(t, []noise.ConnOption{noise.RekeyInterval(1)}, []noise.ConnOption{noise.RekeyInterval(2)})
+	go func() {
+		_, _ = client.Write([]byte("hi"))
+		_, _ = client.Write([]byte("hi"))
+	}()
+	b := make([]byte, 10)
+	n, err := server.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(b[:n]))
+	_, err = server.Read(b)
+	require.EqualError(t, err, "failed to decrypt: chacha20poly1305: message authentication failed")
+	// The error is kept
+	_, err = server.Read(b)
+	require.EqualError(t, err, "failed to decrypt: chacha20poly1305: message authentication failed")
+}
+
+func TestConnWrongKey(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewX25519KeyFromSeed(testSeed(0x03))
+
+	c1, c2 := net.Pipe()
+	client, err := noise.Client(c1, alice, charlie.PublicKey())
+	require.NoError(t, err)
+	server, err := noise.Server(c2, bob, alice.PublicKey())
+	require.NoError(t, err)
+	go func() { _ = client.Handshake() }()
+	err = server.Handshake()
+	require.EqualError(t, err, "failed to read handshake: chacha20poly1305: message authentication failed")
+	_, err = server.Write([]byte("hi"))
+	require.EqualError(t, err, "failed to read handshake: chacha20poly1305: message authentication failed")
+}
+
+func TestConnDeadline(t *testing.T) {
+	client, server := testPipe(t, nil, nil)
+	go func() { _ = client.Handshake() }()
+	require.NoError(t, server.Handshake())
+
+	// Read timeout, then retry
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Millisecond)))
+	b := make([]byte, 10)
+	_, err := server.Read(b)
+	require.Error(t, err)
+	ne, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, ne.Timeout())
+
+	require.NoError(t, server.SetReadDeadline(time.Time{}))
+	go func() { _, _ = client.Write([]byte("hi")) }()
+	n, err := server.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(b[:n]))
+}
+
+func TestConnHandshakeTimeout(t *testing.T) {
+	client, _ := testPipe(t, []noise.ConnOption{noise.HandshakeTimeout(time.Millisecond)}, nil)
+	err := client.Handshake()
+	require.Error(t, err)
+	ne, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, ne.Timeout())
+}
+
+func TestConnOneWay(t *testing.T) {
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	c1, c2 := net.Pipe()
+	opt := noise.ConnHandshake(noise.WithPattern(noise.N))
+	client, err := noise.Client(c1, nil, bob.PublicKey(), opt)
+	require.NoError(t, err)
+	server, err := noise.Server(c2, bob, nil, opt)
+	require.NoError(t, err)
+
+	go func() { _, _ = client.Write([]byte("hi")) }()
+	b := make([]byte, 10)
+	n, err := server.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(b[:n]))
+
+	_, err = server.Write([]byte("hi"))
+	require.EqualError(t, err, "pattern N is one-way")
+	_, err = server.RemoteStatic()
+	require.EqualError(t, err, "no remote static key for pattern N")
+}
+
+func TestDialListen(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	opt := noise.ConnHandshake(noise.WithPattern(noise.XX))
+
+	l, err := noise.Listen("tcp", "127.0.0.1:0", bob, nil, opt)
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	conn, err := noise.Dial("tcp", l.Addr().String(), alice, nil, opt)
+	require.NoError(t, err)
+	defer conn.Close()
+	rs, err := conn.RemoteStatic()
+	require.NoError(t, err)
+	require.Equal(t, bob.ID(), rs.ID())
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	b := make([]byte, 5)
+	_, err = io.ReadFull(conn, b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+
+	_, err = noise.Listen("tcp", "127.0.0.1:0", bob, nil)
+	require.EqualError(t, err, "no recipient key for pattern KK")
+}
+
+func TestConnExportSecret(t *testing.T) {
+	client, server := testPipe(t, []noise.ConnOption{noise.RekeyInterval(1)}, []noise.ConnOption{noise.RekeyInterval(1)})
+	go func() { _ = client.Handshake() }()
+	require.NoError(t, server.Handshake())
+	before, err := server.ExportSecret("test")
+	require.NoError(t, err)
+
+	// Transport traffic, rekeying after every frame
+	go func() {
+		for i := 0; i < 3; i++ {
+			_, _ = client.Write([]byte("hi"))
+		}
+	}()
+	b := make([]byte, 2)
+	for i := 0; i < 3; i++ {
+		_, err := io.ReadFull(server, b)
+		require.NoError(t, err)
+	}
+
+	sa, err := client.ExportSecret("test")
+	require.NoError(t, err)
+	sb, err := server.ExportSecret("test")
+	require.NoError(t, err)
+	require.Equal(t, sa, sb)
+	require.Equal(t, before, sb)
+}
+
+func TestConnDeadlineBeforeHandshake(t *testing.T) {
+	client, server := testPipe(t, nil, nil)
+
+	// Deadline before the (lazy) handshake, with no client
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+	b := make([]byte, 10)
+	start := time.Now()
+	_, err := server.Read(b)
+	require.Error(t, err)
+	ne, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, ne.Timeout())
+	require.True(t, time.Since(start) < time.Second*5)
+
+	// Deadline before the handshake, is kept after the handshake
+	client, server = testPipe(t, nil, nil)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+	go func() { _ = client.Handshake() }()
+	start = time.Now()
+	_, err = server.Read(b)
+	require.Error(t, err)
+	ne, ok = err.(net.Error)
+	require.True(t, ok)
+	require.True(t, ne.Timeout())
+	require.True(t, time.Since(start) < time.Second*5)
+	require.NoError(t, server.Handshake())
+}
+
+func TestConnHandshakeContext(t *testing.T) {
+	// Cancel
+	client, _ := testPipe(t, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		cancel()
+	}()
+	err := client.HandshakeContext(ctx)
+	require.Equal(t, context.Canceled, err)
+
+	// Deadline
+	client, _ = testPipe(t, nil, nil)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	err = client.HandshakeContext(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
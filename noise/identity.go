@@ -0,0 +1,157 @@
+package noise
+
+import (
+	"context"
+	"crypto/ed25519"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/user"
+	"github.com/pkg/errors"
+)
+
+const identityProofContext = "keys.pub/noise/identity/v1\x00"
+
+// identityProofSize is EdX25519 public key (32) and signature (64).
+const identityProofSize = ed25519.PublicKeySize + ed25519.SignatureSize
+
+// Users finds user results, see users.Users.
+type Users interface {
+	// Find user result for a key ID (including related X25519 key IDs).
+	Find(ctx context.Context, kid keys.ID) (*user.Result, error)
+}
+
+// Peer is a remote identity bound to a Noise handshake.
+type Peer struct {
+	// ID is the EdX25519 key ID (kex...).
+	ID keys.ID
+	// Static is the remote static key from the handshake.
+	Static *keys.X25519PublicKey
+	// User if found (with Users) and verified (status OK), or nil.
+	User *user.User
+}
+
+// Policy accepts (returns nil) or rejects (returns an error) a peer.
+type Policy func(ctx context.Context, peer *Peer) error
+
+// IdentityOptions for NewIdentity.
+type IdentityOptions struct {
+	// Users to lookup the peer, optional.
+	Users Users
+	// Policies to accept or reject peers.
+	Policies []Policy
+}
+
+// IdentityOption for IdentityOptions.
+type IdentityOption func(*IdentityOptions)
+
+func newIdentityOptions(opts ...IdentityOption) IdentityOptions {
+	var options IdentityOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithUsers sets the users lookup for peers.
+func WithUsers(users Users) IdentityOption {
+	return func(o *IdentityOptions) {
+		o.Users = users
+	}
+}
+
+// WithPolicy adds a policy to accept or reject peers.
+// Policies are called in order, after the identity proof is verified (and
+// the user lookup).
+func WithPolicy(policy Policy) IdentityOption {
+	return func(o *IdentityOptions) {
+		o.Policies = append(o.Policies, policy)
+	}
+}
+
+// RequireUser is a Policy that rejects peers without a verified user.
+func RequireUser(ctx context.Context, peer *Peer) error {
+	if peer.User == nil {
+		return errors.Errorf("no verified user")
+	}
+	return nil
+}
+
+// Identity binds Noise handshakes to an EdX25519 key (sigchain identity).
+//
+// The handshake static key is the X25519 key for the EdX25519 key. Each
+// participant sends an identity proof, the EdX25519 public key and a
+// signature of its static key, in the payload of the last handshake message
+// it writes. The peer verifies the proof and checks the static key with
+// keys.X25519Match.
+//
+// Use ConnIdentity to use an Identity with a Conn.
+type Identity struct {
+	key  *keys.EdX25519Key
+	opts IdentityOptions
+}
+
+// NewIdentity creates an Identity for an EdX25519 key.
+func NewIdentity(key *keys.EdX25519Key, opt ...IdentityOption) *Identity {
+	return &Identity{
+		key:  key,
+		opts: newIdentityOptions(opt...),
+	}
+}
+
+// ID returns the EdX25519 key ID.
+func (i *Identity) ID() keys.ID {
+	return i.key.ID()
+}
+
+// X25519Key returns the static key for the handshake.
+func (i *Identity) X25519Key() *keys.X25519Key {
+	return i.key.X25519Key()
+}
+
+// Proof returns the identity proof for a handshake payload.
+func (i *Identity) Proof() []byte {
+	sig := i.key.SignDetached(identityProofMessage(i.X25519Key().PublicKey()))
+	return append(i.key.PublicKey().Bytes(), sig...)
+}
+
+// VerifyPeer verifies an identity proof for the remote static key from the
+// handshake, and returns the Peer if it's accepted by the policies.
+func (i *Identity) VerifyPeer(ctx context.Context, remote *keys.X25519PublicKey, proof []byte) (*Peer, error) {
+	if len(proof) == 0 {
+		return nil, errors.Errorf("missing identity proof")
+	}
+	if len(proof) != identityProofSize {
+		return nil, errors.Errorf("invalid identity proof")
+	}
+	spk := keys.NewEdX25519PublicKey(keys.Bytes32(proof[:ed25519.PublicKeySize]))
+	if err := spk.VerifyDetached(proof[ed25519.PublicKeySize:], identityProofMessage(remote)); err != nil {
+		return nil, errors.Wrapf(err, "invalid identity proof")
+	}
+	if !keys.X25519Match(spk.ID(), remote.ID()) {
+		return nil, errors.Errorf("identity proof doesn't match static key")
+	}
+
+	peer := &Peer{
+		ID:     spk.ID(),
+		Static: remote,
+	}
+	if i.opts.Users != nil {
+		res, err := i.opts.Users.Find(ctx, spk.ID())
+		if err != nil {
+			return nil, err
+		}
+		if res != nil && res.Status == user.StatusOK {
+			peer.User = res.User
+		}
+	}
+	for _, policy := range i.opts.Policies {
+		if err := policy(ctx, peer); err != nil {
+			return nil, errors.Wrapf(err, "peer %s rejected", peer.ID)
+		}
+	}
+	return peer, nil
+}
+
+func identityProofMessage(static *keys.X25519PublicKey) []byte {
+	return append([]byte(identityProofContext), static.Bytes()...)
+}
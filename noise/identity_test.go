@@ -0,0 +1,181 @@
+package noise_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/noise"
+	"github.com/keys-pub/keys/user"
+	"github.com/keys-pub/keys/users"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var _ noise.Users = &users.Users{}
+
+type testUsers struct {
+	results []*user.Result
+}
+
+func (u *testUsers) Find(ctx context.Context, kid keys.ID) (*user.Result, error) {
+	for _, res := range u.results {
+		if res.User.KID == kid {
+			return res, nil
+		}
+	}
+	return nil, nil
+}
+
+// testIdentityHandshake runs the handshake for client and server, returning
+// the client and server errors.
+// On error, the connection is closed, so the other side doesn't wait.
+func testIdentityHandshake(client *noise.Conn, server *noise.Conn) (error, error) {
+	errs := make(chan error, 1)
+	go func() {
+		err := client.Handshake()
+		if err != nil {
+			_ = client.Close()
+		}
+		errs <- err
+	}()
+	serr := server.Handshake()
+	if serr != nil {
+		_ = server.Close()
+	}
+	cerr := <-errs
+	return cerr, serr
+}
+
+func TestIdentity(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	usrs := &testUsers{results: []*user.Result{
+		{Status: user.StatusOK, User: &user.User{Name: "alice", Service: "github", KID: alice.ID()}},
+		{Status: user.StatusFailure, User: &user.User{Name: "bob", Service: "github", KID: bob.ID()}},
+	}}
+
+	for _, pattern := range []noise.Pattern{noise.XX, noise.KK, noise.IK} {
+		var clientRemote, serverRemote *keys.X25519PublicKey
+		switch pattern {
+		case noise.KK:
+			clientRemote, serverRemote = bob.X25519Key().PublicKey(), alice.X25519Key().PublicKey()
+		case noise.IK:
+			clientRemote = bob.X25519Key().PublicKey()
+		}
+		hs := noise.ConnHandshake(noise.WithPattern(pattern))
+
+		c1, c2 := net.Pipe()
+		client, err := noise.Client(c1, nil, clientRemote, hs, noise.ConnIdentity(noise.NewIdentity(alice, noise.WithUsers(usrs))))
+		require.NoError(t, err)
+		server, err := noise.Server(c2, nil, serverRemote, hs, noise.ConnIdentity(noise.NewIdentity(bob, noise.WithUsers(usrs), noise.WithPolicy(noise.RequireUser))))
+		require.NoError(t, err)
+
+		cerr, serr := testIdentityHandshake(client, server)
+		require.NoError(t, cerr)
+		require.NoError(t, serr)
+
+		peer, err := server.Peer()
+		require.NoError(t, err)
+		require.Equal(t, alice.ID(), peer.ID)
+		require.Equal(t, alice.X25519Key().ID(), peer.Static.ID())
+		require.Equal(t, "alice@github", peer.User.ID())
+
+		peer, err = client.Peer()
+		require.NoError(t, err)
+		require.Equal(t, bob.ID(), peer.ID)
+		// Bob's user isn't verified
+		require.Nil(t, peer.User)
+	}
+}
+
+func TestIdentityRejected(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	hs := noise.ConnHandshake(noise.WithPattern(noise.XX))
+
+	// No user
+	c1, c2 := net.Pipe()
+	client, err := noise.Client(c1, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(alice)))
+	require.NoError(t, err)
+	server, err := noise.Server(c2, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(bob, noise.WithUsers(&testUsers{}), noise.WithPolicy(noise.RequireUser))))
+	require.NoError(t, err)
+	_, serr := testIdentityHandshake(client, server)
+	require.EqualError(t, serr, "peer "+alice.ID().String()+" rejected: no verified user")
+	_, err = server.Peer()
+	require.EqualError(t, err, "peer "+alice.ID().String()+" rejected: no verified user")
+
+	// Custom policy
+	c1, c2 = net.Pipe()
+	policy := func(ctx context.Context, peer *noise.Peer) error {
+		if peer.ID == bob.ID() {
+			return errors.Errorf("not today")
+		}
+		return nil
+	}
+	client, err = noise.Client(c1, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(alice, noise.WithPolicy(policy))))
+	require.NoError(t, err)
+	server, err = noise.Server(c2, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(bob)))
+	require.NoError(t, err)
+	cerr, _ := testIdentityHandshake(client, server)
+	require.EqualError(t, cerr, "peer "+bob.ID().String()+" rejected: not today")
+
+	// Missing proof
+	c1, c2 = net.Pipe()
+	client, err = noise.Client(c1, alice.X25519Key(), nil, hs)
+	require.NoError(t, err)
+	server, err = noise.Server(c2, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(bob)))
+	require.NoError(t, err)
+	_, serr = testIdentityHandshake(client, server)
+	require.EqualError(t, serr, "missing identity proof")
+
+	// Key doesn't match identity
+	_, err = noise.Client(c1, bob.X25519Key(), nil, hs, noise.ConnIdentity(noise.NewIdentity(alice)))
+	require.EqualError(t, err, "key doesn't match identity")
+
+	// No identity
+	_, err = client.Peer()
+	require.EqualError(t, err, "no identity")
+}
+
+func TestIdentityAnonymous(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	hs := noise.ConnHandshake(noise.WithPattern(noise.NK))
+
+	c1, c2 := net.Pipe()
+	client, err := noise.Client(c1, nil, bob.X25519Key().PublicKey(), hs, noise.ConnIdentity(noise.NewIdentity(alice)))
+	require.NoError(t, err)
+	server, err := noise.Server(c2, nil, nil, hs, noise.ConnIdentity(noise.NewIdentity(bob)))
+	require.NoError(t, err)
+	cerr, serr := testIdentityHandshake(client, server)
+	require.NoError(t, cerr)
+	require.NoError(t, serr)
+
+	peer, err := client.Peer()
+	require.NoError(t, err)
+	require.Equal(t, bob.ID(), peer.ID)
+	peer, err = server.Peer()
+	require.NoError(t, err)
+	require.Nil(t, peer)
+}
+
+func TestVerifyPeer(t *testing.T) {
+	ctx := context.TODO()
+	alice := noise.NewIdentity(keys.NewEdX25519KeyFromSeed(testSeed(0x01)))
+	bob := noise.NewIdentity(keys.NewEdX25519KeyFromSeed(testSeed(0x02)))
+
+	peer, err := bob.VerifyPeer(ctx, alice.X25519Key().PublicKey(), alice.Proof())
+	require.NoError(t, err)
+	require.Equal(t, alice.ID(), peer.ID)
+
+	// Proof for a different static key
+	_, err = bob.VerifyPeer(ctx, bob.X25519Key().PublicKey(), alice.Proof())
+	require.EqualError(t, err, "invalid identity proof: verify failed")
+
+	_, err = bob.VerifyPeer(ctx, alice.X25519Key().PublicKey(), alice.Proof()[:10])
+	require.EqualError(t, err, "invalid identity proof")
+	_, err = bob.VerifyPeer(ctx, alice.X25519Key().PublicKey(), nil)
+	require.EqualError(t, err, "missing identity proof")
+}
@@ -2,6 +2,8 @@
 package noise
 
 import (
+	"math"
+
 	"github.com/flynn/noise"
 	"github.com/keys-pub/keys"
 	"github.com/pkg/errors"
@@ -18,12 +20,19 @@ type Cipher interface {
 // See http://www.noiseprotocol.org/.
 type Handshake struct {
 	initiator bool
+	pattern   Pattern
+	keys      patternKeys
+	messages  int
 	state     *noise.HandshakeState
 
-	csI0 *noise.CipherState
-	csI1 *noise.CipherState
-	csR0 *noise.CipherState
-	csR1 *noise.CipherState
+	// cs0 encrypts from initiator to responder, cs1 from responder to
+	// initiator.
+	cs0 *noise.CipherState
+	cs1 *noise.CipherState
+
+	// exportKey is derived from the initial transport key when the handshake
+	// completes, see ExportSecret.
+	exportKey []byte
 }
 
 // NewHandshake returns a Handshake for X25519Key sender and recipient.
@@ -31,35 +40,67 @@ type Handshake struct {
 // The cipher suite used is:
 // Curve25519 ECDH, ChaCha20-Poly1305 AEAD, BLAKE2b hash.
 //
-// The handshake uses the KK pattern:
+// The handshake uses the KK pattern by default:
 // - K = Static key for initiator Known to responder
 // - K = Static key for responder Known to initiator
 //
+// Other patterns (XX, IK, NK, N) can be specified with WithPattern, and a
+// pre-shared key with WithPSK. The keys required depend on the pattern:
+// - KK: sender and recipient
+// - XX: sender (recipient is transmitted)
+// - IK: sender, and recipient for the initiator
+// - NK, N: recipient for the initiator (anonymous), sender for the responder
+//
 // One of the Noise participants should be the initiator.
 //
-// The order of the handshake writes/reads should be:
-// - (1) Initiator: Write
-// - (2) Responder: Read
-// - (3) Initiator: Read
-// - (4) Responder: Write
+// The initiator writes first, then the participants alternate writes/reads
+// until the handshake is Complete:
+// - KK, IK, NK: Initiator: Write, Responder: Read, Responder: Write, Initiator: Read
+// - XX: as above, then Initiator: Write, Responder: Read
+// - N: Initiator: Write, Responder: Read
 //
 // When the handshake is complete, use the Cipher to Encrypt/Decrypt.
-//
-func NewHandshake(sender *keys.X25519Key, recipient *keys.X25519PublicKey, initiator bool) (*Handshake, error) {
-	dhKey := noise.DHKey{
-		Private: sender.PrivateKey()[:],
-		Public:  sender.PublicKey().Bytes(),
+func NewHandshake(sender *keys.X25519Key, recipient *keys.X25519PublicKey, initiator bool, opt ...HandshakeOption) (*Handshake, error) {
+	opts := newHandshakeOptions(opt...)
+	pattern, pk, err := opts.Pattern.handshake()
+	if err != nil {
+		return nil, err
+	}
+	needStatic, needRemote := pk.responderStatic, pk.responderRemote
+	if initiator {
+		needStatic, needRemote = pk.initiatorStatic, pk.initiatorRemote
 	}
-	pk := recipient.Bytes()
 
-	cs := noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashBLAKE2b)
 	config := noise.Config{
-		CipherSuite:   cs,
-		Pattern:       noise.HandshakeKK,
-		Initiator:     initiator,
-		Prologue:      []byte("keys.pub/1.0"),
-		StaticKeypair: dhKey,
-		PeerStatic:    pk,
+		CipherSuite: noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashBLAKE2b),
+		Pattern:     pattern,
+		Initiator:   initiator,
+		Prologue:    opts.Prologue,
+	}
+	if needStatic {
+		if sender == nil {
+			return nil, errors.Errorf("no sender key for pattern %s", opts.Pattern)
+		}
+		config.StaticKeypair = noise.DHKey{
+			Private: sender.PrivateKey()[:],
+			Public:  sender.PublicKey().Bytes(),
+		}
+	}
+	if needRemote {
+		if recipient == nil {
+			return nil, errors.Errorf("no recipient key for pattern %s", opts.Pattern)
+		}
+		config.PeerStatic = recipient.Bytes()
+	} else if recipient != nil {
+		// The remote static key is transmitted in the handshake.
+		return nil, errors.Errorf("recipient key is not known in advance for pattern %s", opts.Pattern)
+	}
+	if opts.PSK != nil {
+		if opts.PSKPlacement < 0 || opts.PSKPlacement > len(pattern.Messages) {
+			return nil, errors.Errorf("invalid psk placement %d for pattern %s", opts.PSKPlacement, opts.Pattern)
+		}
+		config.PresharedKey = opts.PSK[:]
+		config.PresharedKeyPlacement = opts.PSKPlacement
 	}
 
 	state, err := noise.NewHandshakeState(config)
@@ -69,54 +110,48 @@ func NewHandshake(sender *keys.X25519Key, recipient *keys.X25519PublicKey, initi
 
 	return &Handshake{
 		initiator: initiator,
+		pattern:   opts.Pattern,
+		keys:      pk,
+		messages:  len(pattern.Messages),
 		state:     state,
 	}, nil
 }
 
 // Write performs handshake write.
-// You can include optional payload bytes, as the pattern allows zero-RTT
-// encryption, meaning the initiator can encrypt the first handshake payload.
+// You can include optional payload bytes. Whether the payload is encrypted
+// depends on the pattern and message, for example with KK, IK, NK and N the
+// initiator can encrypt the first handshake payload (zero-RTT), but the first
+// message in XX is not encrypted.
 //
-// The order of the handshake writes/reads should be:
-// (1) Initiator: Write
-// (2) Responder: Read
-// (3) Initiator: Read
-// (4) Responder: Write
+// See NewHandshake for the order of the handshake writes/reads.
 func (n *Handshake) Write(payload []byte) ([]byte, error) {
 	if n.Complete() {
 		return nil, errors.Errorf("handshake already complete")
 	}
-	out, csR0, csR1, err := n.state.WriteMessage(nil, payload)
+	out, cs0, cs1, err := n.state.WriteMessage(nil, payload)
 	if err != nil {
 		return nil, err
 	}
-	if !n.initiator {
-		n.csR0 = csR0
-		n.csR1 = csR1
+	if cs0 != nil {
+		n.complete(cs0, cs1)
 	}
 	return out, nil
 }
 
 // Read performs handshake read, returning optional payload if it was included
-// in the Write, as the pattern allows zero-RTT encryption, meaning the
-// initiator can encrypt the first handshake payload.
+// in the Write.
 //
-// The order of the handshake writes/reads should be:
-// (1) Initiator: Write
-// (2) Responder: Read
-// (3) Initiator: Read
-// (4) Responder: Write
+// See NewHandshake for the order of the handshake writes/reads.
 func (n *Handshake) Read(b []byte) ([]byte, error) {
 	if n.Complete() {
 		return nil, errors.Errorf("handshake already complete")
 	}
-	out, csI0, csI1, err := n.state.ReadMessage(nil, b)
+	out, cs0, cs1, err := n.state.ReadMessage(nil, b)
 	if err != nil {
 		return nil, err
 	}
-	if n.initiator {
-		n.csI0 = csI0
-		n.csI1 = csI1
+	if cs0 != nil {
+		n.complete(cs0, cs1)
 	}
 	return out, nil
 }
@@ -124,7 +159,7 @@ func (n *Handshake) Read(b []byte) ([]byte, error) {
 // Complete returns true if handshake is complete and Encrypt/Decrypt
 // are available.
 func (n *Handshake) Complete() bool {
-	return n.csI0 != nil || n.csR0 != nil
+	return n.cs0 != nil
 }
 
 // Cipher provides symmetric encryption and decryption after a successful
@@ -135,3 +170,74 @@ func (n *Handshake) Cipher() (Cipher, error) {
 	}
 	return newCipherState(n), nil
 }
+
+// Pattern returns the handshake pattern.
+func (n *Handshake) Pattern() Pattern {
+	return n.pattern
+}
+
+// RemoteStatic returns the remote static key, authenticated by the completed
+// handshake.
+// For the responder in NK and N patterns, the initiator is anonymous, and this
+// returns an error.
+func (n *Handshake) RemoteStatic() (*keys.X25519PublicKey, error) {
+	if !n.Complete() {
+		return nil, errors.Errorf("handshake not complete")
+	}
+	rs := n.state.PeerStatic()
+	if len(rs) != 32 {
+		return nil, errors.Errorf("no remote static key for pattern %s", n.pattern)
+	}
+	return keys.NewX25519PublicKey(keys.Bytes32(rs)), nil
+}
+
+// lastMessage returns the index of the last handshake message written by the
+// initiator (or responder), or -1 if it doesn't write any.
+// The initiator writes the even messages, the responder the odd.
+func (n *Handshake) lastMessage(initiator bool) int {
+	i := n.messages - 1
+	if (i%2 == 0) != initiator {
+		i--
+	}
+	return i
+}
+
+// hasStatic returns true if the initiator (or responder) has a static key in
+// the pattern.
+func (n *Handshake) hasStatic(initiator bool) bool {
+	if initiator {
+		return n.keys.initiatorStatic
+	}
+	return n.keys.responderStatic
+}
+
+func (n *Handshake) complete(cs0 *noise.CipherState, cs1 *noise.CipherState) {
+	// Cipher() invalidates the CipherState, so we use a copy. Rekey encrypts
+	// 32 zero bytes at the (reserved) maximum nonce and uses the first 32
+	// bytes as the next key. We encrypt 64 zero bytes and keep the second 32
+	// bytes, which are keystream that neither the transport nor Rekey use.
+	c := *cs0
+	out := c.Cipher().Encrypt(nil, math.MaxUint64, nil, make([]byte, 64))
+	n.exportKey = out[32:64]
+	n.cs0, n.cs1 = cs0, cs1
+}
+
+// ExportSecret returns a 32 byte secret derived from the completed handshake,
+// for seeding another protocol, such as a ratchet.Session.
+//
+// Both participants derive the same secret for the same label. The secret is
+// the HKDF-SHA256 (with the label) of keystream from the initial transport
+// key, that the transport and rekeying never use, salted with the handshake
+// hash (channel binding).
+func (n *Handshake) ExportSecret(label string) (*[32]byte, error) {
+	if !n.Complete() {
+		return nil, errors.Errorf("handshake not complete")
+	}
+	out := keys.HKDFSHA256(n.exportKey, 32, n.state.ChannelBinding(), []byte(label))
+	return keys.Bytes32(out), nil
+}
+
+// Initiator returns true if we are the handshake initiator.
+func (n *Handshake) Initiator() bool {
+	return n.initiator
+}
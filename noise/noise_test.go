@@ -1,6 +1,7 @@
 package noise_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/keys-pub/keys"
@@ -59,3 +60,203 @@ func TestNewHandshake(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "what time is the meeting?", string(decrypted))
 }
+
+func TestExportSecret(t *testing.T) {
+	alice := keys.GenerateX25519Key()
+	bob := keys.GenerateX25519Key()
+
+	na, err := noise.NewHandshake(alice, bob.PublicKey(), true)
+	require.NoError(t, err)
+	nb, err := noise.NewHandshake(bob, alice.PublicKey(), false)
+	require.NoError(t, err)
+
+	_, err = na.ExportSecret("test")
+	require.EqualError(t, err, "handshake not complete")
+
+	b, err := na.Write(nil)
+	require.NoError(t, err)
+	_, err = nb.Read(b)
+	require.NoError(t, err)
+	b, err = nb.Write(nil)
+	require.NoError(t, err)
+	_, err = na.Read(b)
+	require.NoError(t, err)
+
+	sa, err := na.ExportSecret("test")
+	require.NoError(t, err)
+	sb, err := nb.ExportSecret("test")
+	require.NoError(t, err)
+	require.Equal(t, sa, sb)
+
+	other, err := na.ExportSecret("other")
+	require.NoError(t, err)
+	require.NotEqual(t, sa, other)
+
+	// Transport is unaffected
+	ca, err := na.Cipher()
+	require.NoError(t, err)
+	cb, err := nb.Cipher()
+	require.NoError(t, err)
+	encrypted, err := ca.Encrypt(nil, nil, []byte("hello"))
+	require.NoError(t, err)
+	decrypted, err := cb.Decrypt(nil, nil, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(decrypted))
+
+	// Secret is unaffected by the transport
+	sa2, err := na.ExportSecret("test")
+	require.NoError(t, err)
+	require.Equal(t, sa, sa2)
+}
+
+func TestExportKeyRekey(t *testing.T) {
+	alice := keys.GenerateX25519Key()
+	bob := keys.GenerateX25519Key()
+	na, err := noise.NewHandshake(alice, bob.PublicKey(), true)
+	require.NoError(t, err)
+	nb, err := noise.NewHandshake(bob, alice.PublicKey(), false)
+	require.NoError(t, err)
+	testHandshake(t, na, nb)
+
+	export := noise.ExportKey(na)
+	require.Equal(t, 32, len(export))
+	rekeyed, err := noise.RekeyedKey(na)
+	require.NoError(t, err)
+	// Shares no bytes with the rekeyed transport key
+	for i := 0; i+4 <= len(rekeyed); i++ {
+		require.False(t, bytes.Contains(export, rekeyed[i:i+4]))
+	}
+}
+
+func testHandshake(t *testing.T, na *noise.Handshake, nb *noise.Handshake) {
+	// Alternate writes and reads, starting with the initiator.
+	w, r := na, nb
+	for i := 0; !na.Complete() || !nb.Complete(); i++ {
+		require.True(t, i < 3)
+		b, err := w.Write([]byte("payload"))
+		require.NoError(t, err)
+		out, err := r.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, "payload", string(out))
+		w, r = r, w
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	alice := keys.GenerateX25519Key()
+	bob := keys.GenerateX25519Key()
+	psk := keys.Rand32()
+
+	for _, tc := range []struct {
+		pattern noise.Pattern
+		opts    []noise.HandshakeOption
+	}{
+		{noise.KK, nil},
+		{noise.KK, []noise.HandshakeOption{noise.WithPrologue([]byte("test"))}},
+		{noise.XX, nil},
+		{noise.IK, nil},
+		{noise.NK, nil},
+		{noise.N, nil},
+		{noise.XX, []noise.HandshakeOption{noise.WithPSK(psk, 0)}},
+		{noise.XX, []noise.HandshakeOption{noise.WithPSK(psk, 2)}},
+		{noise.IK, []noise.HandshakeOption{noise.WithPSK(psk, 2)}},
+		{noise.NK, []noise.HandshakeOption{noise.WithPSK(psk, 0)}},
+		{noise.N, []noise.HandshakeOption{noise.WithPSK(psk, 0)}},
+	} {
+		pattern := tc.pattern
+		opts := append([]noise.HandshakeOption{noise.WithPattern(pattern)}, tc.opts...)
+
+		var sender, recipient *keys.X25519Key = alice, bob
+		var remote *keys.X25519PublicKey = bob.PublicKey()
+		var remoteR *keys.X25519PublicKey = alice.PublicKey()
+		switch pattern {
+		case noise.XX:
+			remote, remoteR = nil, nil
+		case noise.IK:
+			remoteR = nil
+		case noise.NK, noise.N:
+			sender, remoteR = nil, nil
+		}
+
+		na, err := noise.NewHandshake(sender, remote, true, opts...)
+		require.NoError(t, err)
+		nb, err := noise.NewHandshake(recipient, remoteR, false, opts...)
+		require.NoError(t, err)
+		require.Equal(t, pattern, na.Pattern())
+
+		testHandshake(t, na, nb)
+
+		rs, err := na.RemoteStatic()
+		require.NoError(t, err)
+		require.Equal(t, bob.PublicKey().ID(), rs.ID())
+		rs, err = nb.RemoteStatic()
+		if sender == nil {
+			require.EqualError(t, err, "no remote static key for pattern "+string(pattern))
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, alice.PublicKey().ID(), rs.ID())
+		}
+
+		ca, err := na.Cipher()
+		require.NoError(t, err)
+		cb, err := nb.Cipher()
+		require.NoError(t, err)
+		encrypted, err := ca.Encrypt(nil, nil, []byte("hello"))
+		require.NoError(t, err)
+		decrypted, err := cb.Decrypt(nil, nil, encrypted)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(decrypted))
+
+		encrypted, err = cb.Encrypt(nil, nil, []byte("hi"))
+		if pattern == noise.N {
+			require.EqualError(t, err, "no cipher for encrypt (R), pattern N is one-way")
+			continue
+		}
+		require.NoError(t, err)
+		decrypted, err = ca.Decrypt(nil, nil, encrypted)
+		require.NoError(t, err)
+		require.Equal(t, "hi", string(decrypted))
+	}
+}
+
+func TestPatternMismatch(t *testing.T) {
+	alice := keys.GenerateX25519Key()
+	bob := keys.GenerateX25519Key()
+	psk := keys.Rand32()
+
+	// Different prologue
+	na, err := noise.NewHandshake(alice, nil, true, noise.WithPattern(noise.XX), noise.WithPrologue([]byte("a")))
+	require.NoError(t, err)
+	nb, err := noise.NewHandshake(bob, nil, false, noise.WithPattern(noise.XX), noise.WithPrologue([]byte("b")))
+	require.NoError(t, err)
+	b, err := na.Write(nil)
+	require.NoError(t, err)
+	_, err = nb.Read(b)
+	require.NoError(t, err)
+	b, err = nb.Write(nil)
+	require.NoError(t, err)
+	_, err = na.Read(b)
+	require.EqualError(t, err, "chacha20poly1305: message authentication failed")
+
+	// Missing PSK
+	na, err = noise.NewHandshake(nil, bob.PublicKey(), true, noise.WithPattern(noise.NK), noise.WithPSK(psk, 0))
+	require.NoError(t, err)
+	nb, err = noise.NewHandshake(bob, nil, false, noise.WithPattern(noise.NK))
+	require.NoError(t, err)
+	b, err = na.Write(nil)
+	require.NoError(t, err)
+	_, err = nb.Read(b)
+	require.EqualError(t, err, "chacha20poly1305: message authentication failed")
+
+	// Keys
+	_, err = noise.NewHandshake(nil, bob.PublicKey(), true)
+	require.EqualError(t, err, "no sender key for pattern KK")
+	_, err = noise.NewHandshake(alice, nil, true, noise.WithPattern(noise.IK))
+	require.EqualError(t, err, "no recipient key for pattern IK")
+	_, err = noise.NewHandshake(alice, bob.PublicKey(), true, noise.WithPattern(noise.XX))
+	require.EqualError(t, err, "recipient key is not known in advance for pattern XX")
+	_, err = noise.NewHandshake(alice, bob.PublicKey(), true, noise.WithPattern("NN"))
+	require.EqualError(t, err, `unsupported pattern "NN"`)
+	_, err = noise.NewHandshake(nil, bob.PublicKey(), true, noise.WithPattern(noise.N), noise.WithPSK(psk, 2))
+	require.EqualError(t, err, "invalid psk placement 2 for pattern N")
+}
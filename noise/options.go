@@ -0,0 +1,103 @@
+package noise
+
+import (
+	"github.com/flynn/noise"
+	"github.com/pkg/errors"
+)
+
+// Pattern is a Noise handshake pattern.
+type Pattern string
+
+const (
+	// KK pattern, both static keys are known in advance (default).
+	KK Pattern = "KK"
+	// XX pattern, static keys are transmitted (and authenticated) in the
+	// handshake.
+	XX Pattern = "XX"
+	// IK pattern, the responder's static key is known to the initiator, the
+	// initiator's static key is transmitted in the first message.
+	IK Pattern = "IK"
+	// NK pattern, the responder's static key is known to the initiator, the
+	// initiator is anonymous.
+	NK Pattern = "NK"
+	// N pattern, one-way (initiator to responder) with an anonymous
+	// initiator, the responder's static key is known to the initiator.
+	N Pattern = "N"
+)
+
+type patternKeys struct {
+	// Whether we need our static key.
+	initiatorStatic bool
+	responderStatic bool
+	// Whether we need the remote static key in advance.
+	initiatorRemote bool
+	responderRemote bool
+}
+
+func (p Pattern) handshake() (noise.HandshakePattern, patternKeys, error) {
+	switch p {
+	case KK:
+		return noise.HandshakeKK, patternKeys{true, true, true, true}, nil
+	case XX:
+		return noise.HandshakeXX, patternKeys{true, true, false, false}, nil
+	case IK:
+		return noise.HandshakeIK, patternKeys{true, true, true, false}, nil
+	case NK:
+		return noise.HandshakeNK, patternKeys{false, true, true, false}, nil
+	case N:
+		return noise.HandshakeN, patternKeys{false, true, true, false}, nil
+	default:
+		return noise.HandshakePattern{}, patternKeys{}, errors.Errorf("unsupported pattern %q", p)
+	}
+}
+
+// HandshakeOptions for NewHandshake.
+type HandshakeOptions struct {
+	// Pattern for the handshake, defaults to KK.
+	Pattern Pattern
+	// Prologue must be the same for both participants, defaults to
+	// "keys.pub/1.0".
+	Prologue []byte
+	// PSK is an optional pre-shared key.
+	PSK *[32]byte
+	// PSKPlacement is the position of the psk modifier, for example 0 for
+	// psk0 or 2 for psk2.
+	PSKPlacement int
+}
+
+// HandshakeOption for NewHandshake.
+type HandshakeOption func(*HandshakeOptions)
+
+func newHandshakeOptions(opts ...HandshakeOption) HandshakeOptions {
+	options := HandshakeOptions{
+		Pattern:  KK,
+		Prologue: []byte("keys.pub/1.0"),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithPattern sets the handshake pattern.
+func WithPattern(pattern Pattern) HandshakeOption {
+	return func(o *HandshakeOptions) {
+		o.Pattern = pattern
+	}
+}
+
+// WithPrologue sets the prologue.
+func WithPrologue(prologue []byte) HandshakeOption {
+	return func(o *HandshakeOptions) {
+		o.Prologue = prologue
+	}
+}
+
+// WithPSK sets a pre-shared key, mixed into the handshake at the specified
+// placement, for example 0 (psk0) or 2 (psk2).
+func WithPSK(psk *[32]byte, placement int) HandshakeOption {
+	return func(o *HandshakeOptions) {
+		o.PSK = psk
+		o.PSKPlacement = placement
+	}
+}
@@ -0,0 +1,36 @@
+package noise
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/flynn/noise"
+	"github.com/pkg/errors"
+)
+
+// ExportKey for testing.
+func ExportKey(n *Handshake) []byte {
+	return n.exportKey
+}
+
+// RekeyedKey returns the (initiator to responder) transport key after a
+// Rekey, for testing.
+func RekeyedKey(n *Handshake) ([]byte, error) {
+	c := *n.cs0
+	k := c.Cipher().Encrypt(nil, math.MaxUint64, nil, make([]byte, 32))[:32]
+
+	// Check the key with a rekeyed CipherState
+	r := *n.cs0
+	r.Rekey()
+	var key [32]byte
+	copy(key[:], k)
+	nonce := r.Nonce()
+	expected, err := r.Encrypt(nil, nil, []byte("test"))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(noise.CipherChaChaPoly.Cipher(key).Encrypt(nil, nonce, nil, []byte("test")), expected) {
+		return nil, errors.Errorf("rekeyed key mismatch")
+	}
+	return k, nil
+}
@@ -0,0 +1,3 @@
+package paseto
+
+var V4EncryptWithNonce = v4Encrypt
@@ -0,0 +1,198 @@
+// Package paseto provides PASETO v4 tokens using EdX25519 keys (v4.public) and
+// 32 byte secret keys (v4.local).
+// See https://github.com/paseto-standard/paseto-spec.
+package paseto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	headerV4Public = "v4.public."
+	headerV4Local  = "v4.local."
+)
+
+// ErrInvalidToken if token is invalid.
+var ErrInvalidToken = errors.New("invalid token")
+
+// V4Sign signs a message, returning a v4.public token.
+// The footer and implicit assertion are optional.
+func V4Sign(m []byte, key *keys.EdX25519Key, f []byte, i []byte) string {
+	m2 := pae([]byte(headerV4Public), m, f, i)
+	sig := ed25519.Sign(ed25519.PrivateKey(key.Private()), m2)
+	return appendFooter(headerV4Public+encode(bytesJoin(m, sig)), f)
+}
+
+// V4Verify verifies a v4.public token, returning the message and footer.
+// The implicit assertion must match the one used to sign.
+func V4Verify(token string, pk *keys.EdX25519PublicKey, i []byte) ([]byte, []byte, error) {
+	b, f, err := split(token, headerV4Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) < ed25519.SignatureSize {
+		return nil, nil, ErrInvalidToken
+	}
+	m := b[:len(b)-ed25519.SignatureSize]
+	sig := b[len(b)-ed25519.SignatureSize:]
+	m2 := pae([]byte(headerV4Public), m, f, i)
+	if !ed25519.Verify(ed25519.PublicKey(pk.Bytes()), m2, sig) {
+		return nil, nil, keys.ErrVerifyFailed
+	}
+	return m, f, nil
+}
+
+// V4Encrypt encrypts a message with a secret key, returning a v4.local token.
+// The footer and implicit assertion are optional.
+func V4Encrypt(m []byte, key *[32]byte, f []byte, i []byte) string {
+	return v4Encrypt(m, key, keys.Rand32(), f, i)
+}
+
+func v4Encrypt(m []byte, key *[32]byte, n *[32]byte, f []byte, i []byte) string {
+	ek, n2, ak := v4SplitKey(key, n[:])
+	c := make([]byte, len(m))
+	xchacha(c, m, ek, n2)
+	preAuth := pae([]byte(headerV4Local), n[:], c, f, i)
+	t := blake2bMAC(ak, preAuth)
+	return appendFooter(headerV4Local+encode(bytesJoin(n[:], c, t)), f)
+}
+
+// V4Decrypt decrypts a v4.local token, returning the message and footer.
+// The implicit assertion must match the one used to encrypt.
+func V4Decrypt(token string, key *[32]byte, i []byte) ([]byte, []byte, error) {
+	b, f, err := split(token, headerV4Local)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) < 64 {
+		return nil, nil, ErrInvalidToken
+	}
+	n := b[:32]
+	c := b[32 : len(b)-32]
+	t := b[len(b)-32:]
+	ek, n2, ak := v4SplitKey(key, n)
+	preAuth := pae([]byte(headerV4Local), n, c, f, i)
+	t2 := blake2bMAC(ak, preAuth)
+	if subtle.ConstantTimeCompare(t, t2) != 1 {
+		return nil, nil, errors.Errorf("failed to decrypt")
+	}
+	m := make([]byte, len(c))
+	xchacha(m, c, ek, n2)
+	return m, f, nil
+}
+
+// Footer returns the (unverified) footer of a token.
+func Footer(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	switch len(parts) {
+	case 3:
+		return nil, nil
+	case 4:
+		f, err := decode(parts[3])
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		return f, nil
+	default:
+		return nil, ErrInvalidToken
+	}
+}
+
+func v4SplitKey(key *[32]byte, n []byte) ([]byte, []byte, []byte) {
+	tmp := blake2bMAC56(key[:], bytesJoin([]byte("paseto-encryption-key"), n))
+	ak := blake2bMAC(key[:], bytesJoin([]byte("paseto-auth-key-for-aead"), n))
+	return tmp[:32], tmp[32:], ak
+}
+
+func xchacha(dst []byte, src []byte, key []byte, nonce []byte) {
+	cipher, err := chacha20.NewUnauthenticatedCipher(key, nonce)
+	if err != nil {
+		panic(err)
+	}
+	cipher.XORKeyStream(dst, src)
+}
+
+func blake2bMAC(key []byte, msg []byte) []byte {
+	return blake2bSum(32, key, msg)
+}
+
+func blake2bMAC56(key []byte, msg []byte) []byte {
+	return blake2bSum(56, key, msg)
+}
+
+func blake2bSum(size int, key []byte, msg []byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = h.Write(msg)
+	return h.Sum(nil)
+}
+
+// pae is Pre-Authentication Encoding (PAE).
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(le64(len(pieces)))
+	for _, p := range pieces {
+		buf.Write(le64(len(p)))
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func le64(n int) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n)&^(1<<63))
+	return b
+}
+
+func split(token string, header string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, errors.Errorf("invalid token header")
+	}
+	parts := strings.Split(token[len(header):], ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	b, err := decode(parts[0])
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	var f []byte
+	if len(parts) == 2 {
+		f, err = decode(parts[1])
+		if err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return b, f, nil
+}
+
+func appendFooter(s string, f []byte) string {
+	if len(f) == 0 {
+		return s
+	}
+	return s + "." + encode(f)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func bytesJoin(b ...[]byte) []byte {
+	return bytes.Join(b, []byte{})
+}
@@ -0,0 +1,230 @@
+package paseto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/pkg/errors"
+)
+
+// ErrTokenExpired if token is expired (exp).
+var ErrTokenExpired = errors.New("token expired")
+
+// ErrTokenNotValidYet if token isn't valid yet (nbf).
+var ErrTokenNotValidYet = errors.New("token not valid yet")
+
+// ErrInvalidAudience if token audience (aud) doesn't match.
+var ErrInvalidAudience = errors.New("invalid audience")
+
+// Claims are registered PASETO claims.
+// Embed Claims in your own struct to add custom claims.
+type Claims struct {
+	Issuer     string     `json:"iss,omitempty"`
+	Subject    string     `json:"sub,omitempty"`
+	Audience   string     `json:"aud,omitempty"`
+	Expiration *time.Time `json:"exp,omitempty"`
+	NotBefore  *time.Time `json:"nbf,omitempty"`
+	IssuedAt   *time.Time `json:"iat,omitempty"`
+	TokenID    string     `json:"jti,omitempty"`
+}
+
+// Validate exp and nbf claims at time now, and if aud is specified, that the
+// aud claim matches.
+func (c Claims) Validate(now time.Time, leeway time.Duration, aud string) error {
+	if c.Expiration != nil && !now.Before(c.Expiration.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Add(leeway).Before(*c.NotBefore) {
+		return ErrTokenNotValidYet
+	}
+	if aud != "" && c.Audience != aud {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// footer is the (JSON) footer for tokens.
+type footer struct {
+	KID keys.ID `json:"kid,omitempty"`
+}
+
+// Sign claims as a v4.public token.
+// The claims can be a *Claims or a struct that embeds Claims.
+// The footer and implicit assertion carry the key ID.
+func Sign(claims interface{}, key *keys.EdX25519Key) (string, error) {
+	m, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	f, err := json.Marshal(footer{KID: key.ID()})
+	if err != nil {
+		return "", err
+	}
+	return V4Sign(m, key, f, []byte(key.ID())), nil
+}
+
+// Verify a v4.public token and validate its claims.
+// The signer is the key ID in the footer, or the Key option if specified.
+// If claims is not nil, the payload is also unmarshalled into it.
+// Returns the registered claims and the signer key ID.
+func Verify(token string, claims interface{}, opt ...VerifyOption) (*Claims, keys.ID, error) {
+	opts := newVerifyOptions(opt...)
+	pk := opts.Key
+	if pk == nil {
+		kid, err := footerKID(token)
+		if err != nil {
+			return nil, "", err
+		}
+		if kid == "" {
+			return nil, "", errors.Errorf("no kid in footer")
+		}
+		pk, err = keys.NewEdX25519PublicKeyFromID(kid)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "invalid kid in footer")
+		}
+	}
+	m, _, err := V4Verify(token, pk, []byte(pk.ID()))
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := unmarshalClaims(m, claims, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, pk.ID(), nil
+}
+
+// Encrypt claims as a v4.local token.
+// The claims can be a *Claims or a struct that embeds Claims.
+// The kid (optional) identifies the issuer and is carried in the footer and
+// implicit assertion.
+func Encrypt(claims interface{}, key *[32]byte, kid keys.ID) (string, error) {
+	m, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	var f []byte
+	if kid != "" {
+		f, err = json.Marshal(footer{KID: kid})
+		if err != nil {
+			return "", err
+		}
+	}
+	return V4Encrypt(m, key, f, []byte(kid)), nil
+}
+
+// Decrypt a v4.local token and validate its claims.
+// If claims is not nil, the payload is also unmarshalled into it.
+// Returns the registered claims and the key ID from the footer (if any).
+func Decrypt(token string, key *[32]byte, claims interface{}, opt ...VerifyOption) (*Claims, keys.ID, error) {
+	opts := newVerifyOptions(opt...)
+	kid, err := footerKID(token)
+	if err != nil {
+		return nil, "", err
+	}
+	m, _, err := V4Decrypt(token, key, []byte(kid))
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := unmarshalClaims(m, claims, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, kid, nil
+}
+
+func footerKID(token string) (keys.ID, error) {
+	b, err := Footer(token)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", nil
+	}
+	var f footer
+	if err := json.Unmarshal(b, &f); err != nil {
+		return "", errors.Errorf("invalid footer")
+	}
+	if f.KID == "" {
+		return "", nil
+	}
+	kid, err := keys.ParseID(string(f.KID))
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid footer")
+	}
+	return kid, nil
+}
+
+func unmarshalClaims(m []byte, claims interface{}, opts VerifyOptions) (*Claims, error) {
+	var c Claims
+	if err := json.Unmarshal(m, &c); err != nil {
+		return nil, errors.Errorf("invalid claims")
+	}
+	if err := c.Validate(opts.Clock.Now(), opts.Leeway, opts.Audience); err != nil {
+		return nil, err
+	}
+	if claims != nil {
+		if err := json.Unmarshal(m, claims); err != nil {
+			return nil, errors.Errorf("invalid claims")
+		}
+	}
+	return &c, nil
+}
+
+// VerifyOptions are options for Verify and Decrypt.
+type VerifyOptions struct {
+	// Clock for exp and nbf checks, defaults to tsutil.NewClock().
+	Clock tsutil.Clock
+	// Leeway for clock skew.
+	Leeway time.Duration
+	// Audience, if set, must equal the token aud claim (PASETO aud is a
+	// single string).
+	Audience string
+	// Key, if set, must have signed the token, otherwise the footer kid is
+	// used (Verify only).
+	Key *keys.EdX25519PublicKey
+}
+
+// VerifyOption for Verify and Decrypt.
+type VerifyOption func(*VerifyOptions)
+
+func newVerifyOptions(opts ...VerifyOption) VerifyOptions {
+	var options VerifyOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Clock == nil {
+		options.Clock = tsutil.NewClock()
+	}
+	return options
+}
+
+// WithClock option.
+func WithClock(clock tsutil.Clock) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Clock = clock
+	}
+}
+
+// WithLeeway option.
+func WithLeeway(leeway time.Duration) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Leeway = leeway
+	}
+}
+
+// WithAudience option.
+func WithAudience(aud string) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Audience = aud
+	}
+}
+
+// WithKey option.
+func WithKey(pk *keys.EdX25519PublicKey) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Key = pk
+	}
+}
@@ -0,0 +1,90 @@
+package paseto_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/paseto"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testSeed(b byte) *[32]byte {
+	return keys.Bytes32(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSignVerify(t *testing.T) {
+	sk := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	clock := tsutil.NewTestClock()
+	now := clock.Now()
+	exp := now.Add(time.Hour)
+
+	type customClaims struct {
+		paseto.Claims
+		Scope string `json:"scope"`
+	}
+	claims := &customClaims{
+		Claims: paseto.Claims{Issuer: "keys.pub", Audience: "api", Expiration: &exp},
+		Scope:  "read",
+	}
+	token, err := paseto.Sign(claims, sk)
+	require.NoError(t, err)
+
+	footer, err := paseto.Footer(token)
+	require.NoError(t, err)
+	require.Equal(t, `{"kid":"kex132yw8ht5p8cetl2jmvknewjawt9xwzdlrk2pyxlnwjyqrdq0dawqqph077"}`, string(footer))
+
+	var out customClaims
+	c, kid, err := paseto.Verify(token, &out, paseto.WithClock(clock), paseto.WithAudience("api"))
+	require.NoError(t, err)
+	require.Equal(t, sk.ID(), kid)
+	require.Equal(t, "keys.pub", c.Issuer)
+	require.Equal(t, "read", out.Scope)
+
+	_, _, err = paseto.Verify(token, nil, paseto.WithClock(clock), paseto.WithAudience("other"))
+	require.Equal(t, paseto.ErrInvalidAudience, err)
+
+	// Implicit assertion binds the token to the signer kid
+	sk2 := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	_, _, err = paseto.Verify(token, nil, paseto.WithClock(clock), paseto.WithKey(sk2.PublicKey()))
+	require.EqualError(t, err, "verify failed")
+
+	clock.Add(time.Hour)
+	_, _, err = paseto.Verify(token, nil, paseto.WithClock(clock))
+	require.Equal(t, paseto.ErrTokenExpired, err)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := keys.Rand32()
+	sk := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	clock := tsutil.NewTestClock()
+	nbf := clock.Now().Add(time.Minute)
+
+	token, err := paseto.Encrypt(&paseto.Claims{Subject: "alice", NotBefore: &nbf}, key, sk.ID())
+	require.NoError(t, err)
+
+	_, _, err = paseto.Decrypt(token, key, nil, paseto.WithClock(clock))
+	require.Equal(t, paseto.ErrTokenNotValidYet, err)
+
+	clock.Add(time.Minute)
+	c, kid, err := paseto.Decrypt(token, key, nil, paseto.WithClock(clock))
+	require.NoError(t, err)
+	require.Equal(t, "alice", c.Subject)
+	require.Equal(t, sk.ID(), kid)
+
+	_, _, err = paseto.Decrypt(token, keys.Rand32(), nil, paseto.WithClock(clock))
+	require.EqualError(t, err, "failed to decrypt")
+
+	// Without kid
+	token, err = paseto.Encrypt(&paseto.Claims{Subject: "bob"}, key, "")
+	require.NoError(t, err)
+	c, kid, err = paseto.Decrypt(token, key, nil)
+	require.NoError(t, err)
+	require.Equal(t, "bob", c.Subject)
+	require.Empty(t, kid)
+
+	_, _, err = paseto.V4Verify(token, sk.PublicKey(), nil)
+	require.EqualError(t, err, "invalid token header")
+}
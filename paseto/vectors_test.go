@@ -0,0 +1,64 @@
+package paseto_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/paseto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV4PublicVectors(t *testing.T) {
+	// https://github.com/paseto-standard/test-vectors/blob/master/v4.json
+	sk := keys.NewEdX25519KeyFromPrivateKey(keys.Bytes64(decodeHex(t, "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")))
+	require.Equal(t, "1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2", hex.EncodeToString(sk.Public()))
+	payload := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+
+	// 4-S-1
+	token := paseto.V4Sign(payload, sk, nil, nil)
+	require.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA", token)
+	m, f, err := paseto.V4Verify(token, sk.PublicKey(), nil)
+	require.NoError(t, err)
+	require.Equal(t, payload, m)
+	require.Empty(t, f)
+
+	// 4-S-2
+	footer := []byte(`{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`)
+	token = paseto.V4Sign(payload, sk, footer, nil)
+	require.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9", token)
+	m, f, err = paseto.V4Verify(token, sk.PublicKey(), nil)
+	require.NoError(t, err)
+	require.Equal(t, payload, m)
+	require.Equal(t, footer, f)
+
+	// 4-S-3
+	implicit := []byte(`{"test-vector":"4-S-3"}`)
+	token = paseto.V4Sign(payload, sk, footer, implicit)
+	require.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9NPWciuD3d0o5eXJXG5pJy-DiVEoyPYWs1YSTwWHNJq6DZD3je5gf-0M4JR9ipdUSJbIovzmBECeaWmaqcaP0DQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9", token)
+	_, _, err = paseto.V4Verify(token, sk.PublicKey(), nil)
+	require.EqualError(t, err, "verify failed")
+	m, _, err = paseto.V4Verify(token, sk.PublicKey(), implicit)
+	require.NoError(t, err)
+	require.Equal(t, payload, m)
+}
+
+func TestV4LocalVectors(t *testing.T) {
+	// https://github.com/paseto-standard/test-vectors/blob/master/v4.json
+	key := keys.Bytes32(decodeHex(t, "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f"))
+
+	// 4-E-1
+	nonce := keys.Bytes32(make([]byte, 32))
+	payload := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	token := paseto.V4EncryptWithNonce(payload, key, nonce, nil, nil)
+	require.Equal(t, "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg", token)
+	m, _, err := paseto.V4Decrypt(token, key, nil)
+	require.NoError(t, err)
+	require.Equal(t, payload, m)
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
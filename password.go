@@ -105,15 +105,97 @@ func randomCharFromSet(charSet string) byte {
 	return charSet[n]
 }
 
+// Argon2idParams are argon2id parameters for deriving a key from a password.
+type Argon2idParams struct {
+	// Time is the number of passes.
+	Time uint32
+	// Memory in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultArgon2idParams are the default argon2id parameters (1 pass, 64 MiB,
+// 4 threads).
+var DefaultArgon2idParams = Argon2idParams{Time: 1, Memory: 64 * 1024, Threads: 4}
+
+// DefaultArgon2idLimits are the maximum argon2id parameters when reading
+// params from an encrypted payload (8 passes, 256 MiB, 255 threads), so a
+// payload can't make us do (much) more work than the defaults.
+var DefaultArgon2idLimits = Argon2idParams{Time: 8, Memory: 256 * 1024, Threads: 255}
+
+func (p Argon2idParams) check() error {
+	if p.Time < 1 {
+		return errors.Errorf("invalid argon2id time %d", p.Time)
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return errors.Errorf("invalid argon2id memory %d", p.Memory)
+	}
+	if p.Threads < 1 {
+		return errors.Errorf("invalid argon2id threads %d", p.Threads)
+	}
+	return nil
+}
+
+func (p Argon2idParams) checkLimits(limits Argon2idParams) error {
+	if p.Time > limits.Time || p.Memory > limits.Memory || p.Threads > limits.Threads {
+		return errors.Errorf("kdf params exceed limits")
+	}
+	return nil
+}
+
+func (p Argon2idParams) key(password string, salt []byte) *[32]byte {
+	return Bytes32(argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, 32))
+}
+
+// KDFOptions are options for deriving a key from a password.
+type KDFOptions struct {
+	Argon2id Argon2idParams
+	// Argon2idLimits are the maximum params when decrypting.
+	Argon2idLimits Argon2idParams
+}
+
+// KDFOption ...
+type KDFOption func(*KDFOptions)
+
+func newKDFOptions(opts ...KDFOption) KDFOptions {
+	options := KDFOptions{
+		Argon2id:       DefaultArgon2idParams,
+		Argon2idLimits: DefaultArgon2idLimits,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithArgon2id option to set argon2id parameters.
+func WithArgon2id(params Argon2idParams) KDFOption {
+	return func(o *KDFOptions) {
+		o.Argon2id = params
+	}
+}
+
+// WithArgon2idLimits option to set the maximum argon2id parameters when
+// decrypting.
+func WithArgon2idLimits(limits Argon2idParams) KDFOption {
+	return func(o *KDFOptions) {
+		o.Argon2idLimits = limits
+	}
+}
+
 // KeyForPassword generates a key from a password and salt.
-func KeyForPassword(password string, salt []byte) (*[32]byte, error) {
+// Uses DefaultArgon2idParams unless WithArgon2id is specified.
+func KeyForPassword(password string, salt []byte, opt ...KDFOption) (*[32]byte, error) {
+	opts := newKDFOptions(opt...)
 	if len(salt) < 16 {
 		return nil, errors.Errorf("not enough salt")
 	}
 	if password == "" {
 		return nil, errors.Errorf("empty password")
 	}
-
-	akey := argon2.IDKey([]byte(password), salt[:], 1, 64*1024, 4, 32)
-	return Bytes32(akey), nil
+	if err := opts.Argon2id.check(); err != nil {
+		return nil, err
+	}
+	return opts.Argon2id.key(password, salt), nil
 }
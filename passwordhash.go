@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrInvalidPassword if password doesn't match hash.
+var ErrInvalidPassword = errors.New("invalid password")
+
+const passwordHashLength = 32
+
+// HashPassword returns an argon2id hash of the password encoded in PHC string
+// format, for example "$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>".
+// Uses DefaultArgon2idParams unless WithArgon2id is specified, and a random 16
+// byte salt.
+func HashPassword(password string, opt ...KDFOption) (string, error) {
+	opts := newKDFOptions(opt...)
+	if password == "" {
+		return "", errors.Errorf("empty password")
+	}
+	params := opts.Argon2id
+	if err := params.check(); err != nil {
+		return "", err
+	}
+	salt := Rand16()
+	hash := argon2.IDKey([]byte(password), salt[:], params.Time, params.Memory, params.Threads, passwordHashLength)
+	return encodePasswordHash(params, salt[:], hash), nil
+}
+
+// VerifyPassword checks a password against a hash from HashPassword, in
+// constant time.
+// Returns ErrInvalidPassword if the password doesn't match.
+func VerifyPassword(encoded string, password string) error {
+	ph, err := decodePasswordHash(encoded)
+	if err != nil {
+		return err
+	}
+	hash := argon2.IDKey([]byte(password), ph.salt, ph.params.Time, ph.params.Memory, ph.params.Threads, uint32(len(ph.hash)))
+	if subtle.ConstantTimeCompare(hash, ph.hash) != 1 {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// PasswordNeedsRehash returns true if the hash parameters are different from
+// the current parameters (DefaultArgon2idParams unless WithArgon2id is
+// specified).
+// Use this after VerifyPassword succeeds to upgrade stored hashes.
+func PasswordNeedsRehash(encoded string, opt ...KDFOption) (bool, error) {
+	opts := newKDFOptions(opt...)
+	ph, err := decodePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	if ph.params != opts.Argon2id {
+		return true, nil
+	}
+	return len(ph.salt) < 16 || len(ph.hash) != passwordHashLength, nil
+}
+
+type passwordHash struct {
+	params Argon2idParams
+	salt   []byte
+	hash   []byte
+}
+
+func encodePasswordHash(params Argon2idParams, salt []byte, hash []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash))
+}
+
+func decodePasswordHash(encoded string) (*passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, errors.Errorf("invalid password hash")
+	}
+	if parts[1] != "argon2id" {
+		return nil, errors.Errorf("unsupported password hash %q", parts[1])
+	}
+	version, err := parsePasswordHashParam(parts[2], "v", 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid password hash version")
+	}
+	if version != argon2.Version {
+		return nil, errors.Errorf("unsupported argon2 version %d", version)
+	}
+	params, err := parsePasswordHashParams(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < 8 {
+		return nil, errors.Errorf("invalid password hash salt")
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) < 16 {
+		return nil, errors.Errorf("invalid password hash")
+	}
+	return &passwordHash{params: params, salt: salt, hash: hash}, nil
+}
+
+// parsePasswordHashParams parses "m=<memory>,t=<time>,p=<threads>", exactly.
+func parsePasswordHashParams(s string) (Argon2idParams, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return Argon2idParams{}, errors.Errorf("invalid password hash params")
+	}
+	m, err := parsePasswordHashParam(fields[0], "m", 32)
+	if err != nil {
+		return Argon2idParams{}, errors.Errorf("invalid password hash params")
+	}
+	t, err := parsePasswordHashParam(fields[1], "t", 32)
+	if err != nil {
+		return Argon2idParams{}, errors.Errorf("invalid password hash params")
+	}
+	p, err := parsePasswordHashParam(fields[2], "p", 8)
+	if err != nil {
+		return Argon2idParams{}, errors.Errorf("invalid password hash params")
+	}
+	return Argon2idParams{Memory: uint32(m), Time: uint32(t), Threads: uint8(p)}, nil
+}
+
+// parsePasswordHashParam parses "<key>=<decimal value>", exactly.
+func parsePasswordHashParam(s string, key string, bitSize int) (uint64, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] != key {
+		return 0, errors.Errorf("invalid param")
+	}
+	return strconv.ParseUint(kv[1], 10, bitSize)
+}
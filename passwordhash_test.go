@@ -0,0 +1,81 @@
+package keys_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := keys.HashPassword("password123")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$"))
+
+	err = keys.VerifyPassword(hash, "password123")
+	require.NoError(t, err)
+	err = keys.VerifyPassword(hash, "invalid")
+	require.Equal(t, keys.ErrInvalidPassword, err)
+
+	hash2, err := keys.HashPassword("password123")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, hash2)
+
+	_, err = keys.HashPassword("")
+	require.EqualError(t, err, "empty password")
+}
+
+func TestVerifyPasswordVector(t *testing.T) {
+	// From the argon2 reference implementation (password, somesalt)
+	hash := "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+	err := keys.VerifyPassword(hash, "password")
+	require.NoError(t, err)
+	err = keys.VerifyPassword(hash, "password1")
+	require.Equal(t, keys.ErrInvalidPassword, err)
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	params := keys.Argon2idParams{Time: 2, Memory: 1024, Threads: 1}
+	hash, err := keys.HashPassword("password123", keys.WithArgon2id(params))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=2,p=1$"))
+
+	rehash, err := keys.PasswordNeedsRehash(hash, keys.WithArgon2id(params))
+	require.NoError(t, err)
+	require.False(t, rehash)
+
+	rehash, err = keys.PasswordNeedsRehash(hash)
+	require.NoError(t, err)
+	require.True(t, rehash)
+
+	upgraded := keys.Argon2idParams{Time: 3, Memory: 1024, Threads: 1}
+	rehash, err = keys.PasswordNeedsRehash(hash, keys.WithArgon2id(upgraded))
+	require.NoError(t, err)
+	require.True(t, rehash)
+}
+
+func TestVerifyPasswordInvalid(t *testing.T) {
+	for _, test := range []struct {
+		hash string
+		err  string
+	}{
+		{"", "invalid password hash"},
+		{"$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", `unsupported password hash "argon2i"`},
+		{"$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "unsupported argon2 version 16"},
+		{"$argon2id$v=19$m=65536$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19xyz$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash version"},
+		{"$argon2id$19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash version"},
+		{"$argon2id$v=19$m=65536,t=2,p=1,keyid=abc$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$m=65536,t=2,p=1x$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$t=2,m=65536,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$m=65536,m=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$m=-1,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$m=65536,t=2,p=256$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash params"},
+		{"$argon2id$v=19$m=65536,t=0,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid argon2id time 0"},
+		{"$argon2id$v=19$m=65536,t=2,p=1$!!!$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "invalid password hash salt"},
+	} {
+		err := keys.VerifyPassword(test.hash, "password")
+		require.EqualError(t, err, test.err)
+	}
+}
@@ -0,0 +1,355 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PEM block types.
+const (
+	pemPrivateKey          = "PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	pemPublicKey           = "PUBLIC KEY"
+)
+
+// pemIterations is the PBKDF2 iteration count for PBES2 encrypted keys.
+const pemIterations = 100000
+
+// pemMaxIterations limits the PBKDF2 iteration count when decrypting.
+const pemMaxIterations = 10000000
+
+var (
+	oidEd25519        = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidX25519         = asn1.ObjectIdentifier{1, 3, 101, 110}
+	oidRSA            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// pkcs8 is a PKCS#8 PrivateKeyInfo (RFC 5208, RFC 8410).
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	// Optional attributes and public key are omitted.
+}
+
+// spki is a SubjectPublicKeyInfo (RFC 5280, RFC 8410).
+type spki struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// encryptedPrivateKeyInfo is a PKCS#8 EncryptedPrivateKeyInfo (RFC 5208).
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params (RFC 8018).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params (RFC 8018).
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncodePEMKey encodes a key to PEM.
+// Private keys are encoded as PKCS#8 ("PRIVATE KEY"), and if password is
+// specified, encrypted with PBES2 (PBKDF2-SHA256, AES-256-CBC) as
+// "ENCRYPTED PRIVATE KEY".
+// Public keys are encoded as SPKI ("PUBLIC KEY").
+// Supports EdX25519, X25519 and RSA keys.
+func EncodePEMKey(key Key, password string) (string, error) {
+	var der []byte
+	var blockType string
+	switch k := key.(type) {
+	case *EdX25519Key:
+		b, err := marshalPKCS8(oidEd25519, k.Seed()[:])
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPrivateKey
+	case *X25519Key:
+		b, err := marshalPKCS8(oidX25519, k.Private())
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPrivateKey
+	case *RSAKey:
+		b, err := x509.MarshalPKCS8PrivateKey(k.privateKey)
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPrivateKey
+	case *EdX25519PublicKey:
+		b, err := asn1.Marshal(spki{Algo: pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, PublicKey: asn1.BitString{Bytes: k.Bytes(), BitLength: 256}})
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPublicKey
+	case *X25519PublicKey:
+		b, err := asn1.Marshal(spki{Algo: pkix.AlgorithmIdentifier{Algorithm: oidX25519}, PublicKey: asn1.BitString{Bytes: k.Bytes(), BitLength: 256}})
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPublicKey
+	case *RSAPublicKey:
+		b, err := x509.MarshalPKIXPublicKey(k.pk)
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemPublicKey
+	default:
+		return "", errors.Errorf("unsupported key type %s", key.Type())
+	}
+
+	if password != "" {
+		if blockType == pemPublicKey {
+			return "", errors.Errorf("password not supported when exporting public key")
+		}
+		b, err := encryptPBES2(der, []byte(password))
+		if err != nil {
+			return "", err
+		}
+		der, blockType = b, pemEncryptedPrivateKey
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})), nil
+}
+
+// DecodePEMKey decodes a PKCS#8 ("PRIVATE KEY" or "ENCRYPTED PRIVATE KEY") or
+// SPKI ("PUBLIC KEY") PEM key.
+// Returns EdX25519Key, X25519Key, RSAKey or their public keys.
+func DecodePEMKey(s string, password string) (Key, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(s)))
+	if block == nil {
+		return nil, errors.Errorf("failed to decode pem")
+	}
+	switch block.Type {
+	case pemPrivateKey:
+		if password != "" {
+			return nil, errors.Errorf("password unsupported for unencrypted private key")
+		}
+		return parsePKCS8(block.Bytes)
+	case pemEncryptedPrivateKey:
+		if password == "" {
+			return nil, errors.Errorf("password required for encrypted private key")
+		}
+		der, err := decryptPBES2(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8(der)
+	case pemPublicKey:
+		if password != "" {
+			return nil, errors.Errorf("password unsupported for public key")
+		}
+		return parseSPKI(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported pem type %q", block.Type)
+	}
+}
+
+func marshalPKCS8(oid asn1.ObjectIdentifier, privateKey []byte) ([]byte, error) {
+	pk, err := asn1.Marshal(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs8{Algo: pkix.AlgorithmIdentifier{Algorithm: oid}, PrivateKey: pk})
+}
+
+func parsePKCS8(der []byte) (Key, error) {
+	var info pkcs8
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse pkcs8")
+	}
+	switch {
+	case info.Algo.Algorithm.Equal(oidRSA):
+		k, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse pkcs8")
+		}
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("invalid rsa key")
+		}
+		return NewRSAKey(rk), nil
+	case info.Algo.Algorithm.Equal(oidEd25519), info.Algo.Algorithm.Equal(oidX25519):
+		var b []byte
+		if _, err := asn1.Unmarshal(info.PrivateKey, &b); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse pkcs8")
+		}
+		if len(b) != 32 {
+			return nil, errors.Errorf("invalid pkcs8 private key length")
+		}
+		if info.Algo.Algorithm.Equal(oidEd25519) {
+			return NewEdX25519KeyFromSeed(Bytes32(b)), nil
+		}
+		return NewX25519KeyFromPrivateKey(Bytes32(b)), nil
+	default:
+		return nil, errors.Errorf("unsupported pkcs8 algorithm %s", info.Algo.Algorithm)
+	}
+}
+
+func parseSPKI(der []byte) (Key, error) {
+	var info spki
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse public key")
+	}
+	switch {
+	case info.Algo.Algorithm.Equal(oidRSA):
+		k, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key")
+		}
+		rk, ok := k.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("invalid rsa public key")
+		}
+		return NewRSAPublicKey(rk), nil
+	case info.Algo.Algorithm.Equal(oidEd25519), info.Algo.Algorithm.Equal(oidX25519):
+		b := info.PublicKey.RightAlign()
+		if len(b) != 32 {
+			return nil, errors.Errorf("invalid public key length")
+		}
+		if info.Algo.Algorithm.Equal(oidEd25519) {
+			return NewEdX25519PublicKey(Bytes32(b)), nil
+		}
+		return NewX25519PublicKey(Bytes32(b)), nil
+	default:
+		return nil, errors.Errorf("unsupported public key algorithm %s", info.Algo.Algorithm)
+	}
+}
+
+func encryptPBES2(der []byte, password []byte) ([]byte, error) {
+	salt := RandBytes(16)
+	iv := RandBytes(aes.BlockSize)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pemIterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(password, salt, pemIterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo:          pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
+
+func decryptPBES2(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse encrypted private key")
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, errors.Errorf("unsupported encryption algorithm %s", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse pbes2 params")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse pbkdf2 params")
+	}
+	if kdfParams.IterationCount <= 0 || kdfParams.IterationCount > pemMaxIterations {
+		return nil, errors.Errorf("invalid pbkdf2 iteration count %d", kdfParams.IterationCount)
+	}
+	var h func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		h = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	default:
+		return nil, errors.Errorf("unsupported pbkdf2 prf %s", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLen = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, errors.Errorf("unsupported encryption scheme %s", params.EncryptionScheme.Algorithm)
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, errors.Errorf("invalid pbkdf2 key length")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.Errorf("invalid encryption iv")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.Errorf("invalid encrypted data length")
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLen, h)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.EncryptedData)
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.Errorf("failed to decrypt private key (invalid password?)")
+	}
+	return data[:len(data)-padding], nil
+}
@@ -0,0 +1,742 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// OpenPGP (RFC 4880) support for Ed25519 (EdDSA) and Curve25519 (ECDH) keys,
+// see also RFC 6637 and draft-ietf-openpgp-rfc4880bis.
+
+const (
+	pgpTagSignature       = 2
+	pgpTagSecretKey       = 5
+	pgpTagPublicKey       = 6
+	pgpTagSecretSubkey    = 7
+	pgpTagUserID          = 13
+	pgpTagPublicSubkey    = 14
+	pgpAlgoECDH           = 18
+	pgpAlgoEdDSA          = 22
+	pgpHashSHA256         = 8
+	pgpSymAES128          = 7
+	pgpSymAES192          = 8
+	pgpSymAES256          = 9
+	pgpSigBinary          = 0x00
+	pgpSigText            = 0x01
+	pgpSigPositiveCert    = 0x13
+	pgpSigSubkeyBinding   = 0x18
+	pgpPublicKeyBlockType = "PGP PUBLIC KEY BLOCK"
+	pgpSecretKeyBlockType = "PGP PRIVATE KEY BLOCK"
+)
+
+var pgpOIDEd25519 = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0xDA, 0x47, 0x0F, 0x01}
+var pgpOIDCurve25519 = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0x97, 0x55, 0x01, 0x05, 0x01}
+
+// ParsePGPKeys parses an OpenPGP (armored or binary) public or secret key
+// block.
+// Ed25519 (EdDSA) keys are returned as EdX25519 keys and Curve25519 (ECDH)
+// keys as X25519 keys, with the primary key first.
+// The primary key must be an Ed25519 key with a valid self-signature, and
+// subkeys are only returned if they have a valid binding signature from the
+// primary key. Other subkey types are skipped.
+// The password is required for encrypted secret keys.
+func ParsePGPKeys(b []byte, password string) ([]Key, error) {
+	b, err := pgpDearmor(b)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := pgpReadPackets(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var primary *EdX25519PublicKey
+	var primaryPub []byte
+	selfSigned := false
+	// Current user ID or subkey, for the signatures that follow
+	var userID []byte
+	var subkey Key
+	var subkeyPub []byte
+
+	out := []Key{}
+	for _, p := range packets {
+		switch p.tag {
+		case pgpTagPublicKey, pgpTagSecretKey:
+			if primary != nil {
+				return nil, errors.Errorf("multiple pgp primary keys")
+			}
+			key, pub, err := pgpParseKey(p.body, p.tag == pgpTagSecretKey, password)
+			if err != nil {
+				return nil, err
+			}
+			switch k := key.(type) {
+			case *EdX25519PublicKey:
+				primary = k
+			case *EdX25519Key:
+				primary = k.PublicKey()
+			default:
+				return nil, errors.Errorf("unsupported pgp primary key")
+			}
+			primaryPub = pub
+			out = append(out, key)
+		case pgpTagUserID:
+			userID, subkey, subkeyPub = p.body, nil, nil
+		case pgpTagPublicSubkey, pgpTagSecretSubkey:
+			if primary == nil {
+				return nil, errors.Errorf("pgp subkey without primary key")
+			}
+			key, pub, err := pgpParseKey(p.body, p.tag == pgpTagSecretSubkey, password)
+			if err != nil {
+				return nil, err
+			}
+			userID, subkey, subkeyPub = nil, key, pub
+		case pgpTagSignature:
+			if primary == nil {
+				continue
+			}
+			sig, err := pgpParseSignature(p.body)
+			if err != nil {
+				// Signatures we can't parse (or from other keys) are ignored
+				continue
+			}
+			switch {
+			case sig.sigType >= 0x10 && sig.sigType <= pgpSigPositiveCert && userID != nil:
+				if sig.verify(primary, bytesJoin(
+					pgpKeyHashPrefix(primaryPub),
+					[]byte{0xB4}, pgpUint32(uint32(len(userID))), userID,
+				)) == nil {
+					selfSigned = true
+				}
+			case sig.sigType == pgpSigSubkeyBinding && subkey != nil:
+				if sig.verify(primary, bytesJoin(
+					pgpKeyHashPrefix(primaryPub),
+					pgpKeyHashPrefix(subkeyPub),
+				)) == nil {
+					out = append(out, subkey)
+					subkey, subkeyPub = nil, nil
+				}
+			}
+		}
+	}
+	if primary == nil {
+		return nil, errors.Errorf("no supported pgp keys found")
+	}
+	if !selfSigned {
+		return nil, errors.Errorf("pgp primary key has no valid self-signature")
+	}
+	return out, nil
+}
+
+// EncodeToPGPPublic encodes a EdX25519Key as an (armored) OpenPGP public key,
+// with a Curve25519 encryption subkey (from X25519Key).
+// The OpenPGP fingerprint depends on the created time.
+func (k *EdX25519Key) EncodeToPGPPublic(userID string, created time.Time) (string, error) {
+	return k.encodeToPGP(userID, created, false, nil)
+}
+
+// EncodeToPGP encodes a EdX25519Key as an (armored) OpenPGP secret key, with a
+// Curve25519 encryption subkey (from X25519Key).
+// If password is specified, the secret keys are encrypted with it.
+// The OpenPGP fingerprint depends on the created time.
+func (k *EdX25519Key) EncodeToPGP(userID string, created time.Time, password []byte) (string, error) {
+	return k.encodeToPGP(userID, created, true, password)
+}
+
+// VerifyPGPDetached verifies an OpenPGP (armored or binary) detached signature.
+func VerifyPGPDetached(sig []byte, b []byte, pk *EdX25519PublicKey) error {
+	sig, err := pgpDearmor(sig)
+	if err != nil {
+		return err
+	}
+	packets, err := pgpReadPackets(sig)
+	if err != nil {
+		return err
+	}
+	if len(packets) != 1 || packets[0].tag != pgpTagSignature {
+		return errors.Errorf("invalid pgp signature")
+	}
+	s, err := pgpParseSignature(packets[0].body)
+	if err != nil {
+		return err
+	}
+	switch s.sigType {
+	case pgpSigBinary:
+	case pgpSigText:
+		b = pgpCanonicalText(b)
+	default:
+		return errors.Errorf("unsupported pgp signature type %d", s.sigType)
+	}
+	return s.verify(pk, b)
+}
+
+func (k *EdX25519Key) encodeToPGP(userID string, created time.Time, secret bool, password []byte) (string, error) {
+	if userID == "" {
+		return "", errors.Errorf("no user id")
+	}
+	ts := uint32(created.Unix())
+	pub := pgpEdDSAPublicBody(k.PublicKey(), ts)
+	bk := k.X25519Key()
+	subPub := pgpECDHPublicBody(bk.PublicKey(), ts)
+	fp := pgpFingerprint(pub)
+
+	uidSig := pgpSign(k, pgpSigPositiveCert, ts, fp, []byte{0x03}, bytesJoin(
+		pgpKeyHashPrefix(pub),
+		[]byte{0xB4}, pgpUint32(uint32(len(userID))), []byte(userID),
+	))
+	subSig := pgpSign(k, pgpSigSubkeyBinding, ts, fp, []byte{0x0C}, bytesJoin(
+		pgpKeyHashPrefix(pub),
+		pgpKeyHashPrefix(subPub),
+	))
+
+	var buf bytes.Buffer
+	blockType := pgpPublicKeyBlockType
+	if secret {
+		blockType = pgpSecretKeyBlockType
+		sec, err := pgpSecretBody(pub, pgpMPI(k.Seed()[:]), password)
+		if err != nil {
+			return "", err
+		}
+		subSec, err := pgpSecretBody(subPub, pgpMPI(reverseBytes(pgpClamp(bk.Private()))), password)
+		if err != nil {
+			return "", err
+		}
+		pgpWritePacket(&buf, pgpTagSecretKey, sec)
+		pgpWritePacket(&buf, pgpTagUserID, []byte(userID))
+		pgpWritePacket(&buf, pgpTagSignature, uidSig)
+		pgpWritePacket(&buf, pgpTagSecretSubkey, subSec)
+		pgpWritePacket(&buf, pgpTagSignature, subSig)
+	} else {
+		pgpWritePacket(&buf, pgpTagPublicKey, pub)
+		pgpWritePacket(&buf, pgpTagUserID, []byte(userID))
+		pgpWritePacket(&buf, pgpTagSignature, uidSig)
+		pgpWritePacket(&buf, pgpTagPublicSubkey, subPub)
+		pgpWritePacket(&buf, pgpTagSignature, subSig)
+	}
+
+	var out bytes.Buffer
+	w, err := armor.Encode(&out, blockType, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	out.WriteByte('\n')
+	return out.String(), nil
+}
+
+type pgpPacket struct {
+	tag  byte
+	body []byte
+}
+
+func pgpDearmor(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN PGP ")) {
+		return b, nil
+	}
+	block, err := armor.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode pgp armor")
+	}
+	return ioutil.ReadAll(block.Body)
+}
+
+func pgpReadPackets(b []byte) ([]*pgpPacket, error) {
+	packets := []*pgpPacket{}
+	for len(b) > 0 {
+		ctb := b[0]
+		if ctb&0x80 == 0 {
+			return nil, errors.Errorf("invalid pgp packet")
+		}
+		var tag byte
+		var length int
+		var hlen int
+		if ctb&0x40 != 0 {
+			// New format
+			tag = ctb & 0x3f
+			if len(b) < 2 {
+				return nil, errors.Errorf("invalid pgp packet")
+			}
+			switch o := b[1]; {
+			case o < 192:
+				length, hlen = int(o), 2
+			case o < 224:
+				if len(b) < 3 {
+					return nil, errors.Errorf("invalid pgp packet")
+				}
+				length, hlen = (int(o)-192)<<8+int(b[2])+192, 3
+			case o == 255:
+				if len(b) < 6 {
+					return nil, errors.Errorf("invalid pgp packet")
+				}
+				length, hlen = int(binary.BigEndian.Uint32(b[2:6])), 6
+			default:
+				return nil, errors.Errorf("unsupported pgp partial length packet")
+			}
+		} else {
+			// Old format
+			tag = (ctb >> 2) & 0x0f
+			switch ctb & 0x03 {
+			case 0:
+				if len(b) < 2 {
+					return nil, errors.Errorf("invalid pgp packet")
+				}
+				length, hlen = int(b[1]), 2
+			case 1:
+				if len(b) < 3 {
+					return nil, errors.Errorf("invalid pgp packet")
+				}
+				length, hlen = int(binary.BigEndian.Uint16(b[1:3])), 3
+			case 2:
+				if len(b) < 5 {
+					return nil, errors.Errorf("invalid pgp packet")
+				}
+				length, hlen = int(binary.BigEndian.Uint32(b[1:5])), 5
+			default:
+				length, hlen = len(b)-1, 1
+			}
+		}
+		if length < 0 || len(b) < hlen+length {
+			return nil, errors.Errorf("invalid pgp packet length")
+		}
+		packets = append(packets, &pgpPacket{tag: tag, body: b[hlen : hlen+length]})
+		b = b[hlen+length:]
+	}
+	return packets, nil
+}
+
+func pgpWritePacket(w *bytes.Buffer, tag byte, body []byte) {
+	w.WriteByte(0xC0 | tag)
+	switch l := len(body); {
+	case l < 192:
+		w.WriteByte(byte(l))
+	case l < 8384:
+		l -= 192
+		w.WriteByte(byte(l>>8) + 192)
+		w.WriteByte(byte(l))
+	default:
+		w.WriteByte(255)
+		w.Write(pgpUint32(uint32(l)))
+	}
+	w.Write(body)
+}
+
+// pgpReader reads fields from a packet body.
+type pgpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *pgpReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errors.Errorf("invalid pgp packet: not enough data")
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *pgpReader) uint8() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *pgpReader) uint16() int {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (r *pgpReader) mpi() []byte {
+	bits := r.uint16()
+	return r.next((bits + 7) / 8)
+}
+
+// pgpParseKey parses a public or secret key packet body, returning the key
+// and the public key body (for signatures).
+// Returns a nil key if the key type is unsupported.
+func pgpParseKey(body []byte, secret bool, password string) (Key, []byte, error) {
+	r := &pgpReader{b: body}
+	if version := r.uint8(); r.err == nil && version != 4 {
+		return nil, nil, nil
+	}
+	r.next(4) // created
+	algo := r.uint8()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if algo != pgpAlgoEdDSA && algo != pgpAlgoECDH {
+		logger.Debugf("Skipping unsupported pgp key (algo=%d)", algo)
+		return nil, nil, nil
+	}
+	oid := r.next(int(r.uint8()))
+	point := r.mpi()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	switch {
+	case algo == pgpAlgoEdDSA && bytes.Equal(oid, pgpOIDEd25519):
+	case algo == pgpAlgoECDH && bytes.Equal(oid, pgpOIDCurve25519):
+		// KDF parameters
+		r.next(int(r.uint8()))
+	default:
+		logger.Debugf("Skipping unsupported pgp key (algo=%d)", algo)
+		return nil, nil, nil
+	}
+	if len(point) != 33 || point[0] != 0x40 {
+		return nil, nil, errors.Errorf("invalid pgp public key")
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	pubBody := body[:len(body)-len(r.b)]
+	pub := Bytes32(point[1:])
+
+	if !secret {
+		if algo == pgpAlgoEdDSA {
+			return NewEdX25519PublicKey(pub), pubBody, nil
+		}
+		return NewX25519PublicKey(pub), pubBody, nil
+	}
+
+	sk, err := pgpSecretMPI(r, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sk) > 32 {
+		return nil, nil, errors.Errorf("invalid pgp secret key")
+	}
+	sk = append(make([]byte, 32-len(sk)), sk...)
+
+	if algo == pgpAlgoEdDSA {
+		key := NewEdX25519KeyFromSeed(Bytes32(sk))
+		if subtle.ConstantTimeCompare(key.Public(), pub[:]) != 1 {
+			return nil, nil, errors.Errorf("pgp secret key doesn't match public key")
+		}
+		return key, pubBody, nil
+	}
+	// Curve25519 secret key MPI is big-endian (reversed)
+	key := NewX25519KeyFromPrivateKey(Bytes32(reverseBytes(sk)))
+	if subtle.ConstantTimeCompare(key.Public(), pub[:]) != 1 {
+		return nil, nil, errors.Errorf("pgp secret key doesn't match public key")
+	}
+	return key, pubBody, nil
+}
+
+func pgpSecretMPI(r *pgpReader, password string) ([]byte, error) {
+	usage := r.uint8()
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch usage {
+	case 0:
+		sk := r.mpi()
+		checksum := r.uint16()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if pgpChecksum(pgpMPI(sk)) != checksum {
+			return nil, errors.Errorf("invalid pgp secret key checksum")
+		}
+		return sk, nil
+	case 254, 255:
+		if password == "" {
+			return nil, errors.Errorf("pgp secret key is encrypted, password required")
+		}
+		var keySize int
+		switch sym := r.uint8(); sym {
+		case pgpSymAES128:
+			keySize = 16
+		case pgpSymAES192:
+			keySize = 24
+		case pgpSymAES256:
+			keySize = 32
+		default:
+			return nil, errors.Errorf("unsupported pgp cipher %d", sym)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		br := bytes.NewReader(r.b)
+		s2kFn, err := s2k.Parse(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse pgp s2k")
+		}
+		r.next(len(r.b) - br.Len())
+		iv := r.next(aes.BlockSize)
+		encrypted := r.next(len(r.b))
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		key := make([]byte, keySize)
+		s2kFn(key, []byte(password))
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, len(encrypted))
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(data, encrypted)
+
+		dr := &pgpReader{b: data}
+		sk := dr.mpi()
+		if dr.err != nil {
+			return nil, errors.Errorf("failed to decrypt pgp secret key")
+		}
+		if usage == 254 {
+			h := sha1.Sum(data[:len(data)-len(dr.b)])
+			if len(dr.b) < sha1.Size || subtle.ConstantTimeCompare(h[:], dr.b[:sha1.Size]) != 1 {
+				return nil, errors.Errorf("failed to decrypt pgp secret key")
+			}
+		} else {
+			if len(dr.b) < 2 || pgpChecksum(data[:len(data)-len(dr.b)]) != int(binary.BigEndian.Uint16(dr.b)) {
+				return nil, errors.Errorf("failed to decrypt pgp secret key")
+			}
+		}
+		return sk, nil
+	default:
+		return nil, errors.Errorf("unsupported pgp secret key encryption")
+	}
+}
+
+func pgpSecretBody(pub []byte, mpi []byte, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return bytesJoin(pub, []byte{0}, mpi, pgpUint16(uint16(pgpChecksum(mpi)))), nil
+	}
+	var buf bytes.Buffer
+	buf.Write(pub)
+	buf.Write([]byte{254, pgpSymAES256})
+	key := make([]byte, 32)
+	if err := s2k.Serialize(&buf, key, rand.Reader, password, &s2k.Config{Hash: crypto.SHA256, S2KCount: 65011712}); err != nil {
+		return nil, err
+	}
+	iv := RandBytes(aes.BlockSize)
+	buf.Write(iv)
+	h := sha1.Sum(mpi)
+	data := bytesJoin(mpi, h[:])
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(data, data)
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+type pgpSignature struct {
+	sigType  byte
+	hashAlgo byte
+	hashed   []byte
+	hashLeft []byte
+	sig      []byte
+}
+
+func pgpParseSignature(body []byte) (*pgpSignature, error) {
+	r := &pgpReader{b: body}
+	if version := r.uint8(); r.err == nil && version != 4 {
+		return nil, errors.Errorf("unsupported pgp signature version %d", version)
+	}
+	sigType := r.uint8()
+	algo := r.uint8()
+	hashAlgo := r.uint8()
+	hashedLen := r.uint16()
+	r.next(hashedLen)
+	if r.err != nil {
+		return nil, r.err
+	}
+	hashed := body[:6+hashedLen]
+	r.next(r.uint16()) // unhashed
+	hashLeft := r.next(2)
+	sr := r.mpi()
+	ss := r.mpi()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if algo != pgpAlgoEdDSA {
+		return nil, errors.Errorf("unsupported pgp signature algorithm %d", algo)
+	}
+	if len(sr) > 32 || len(ss) > 32 {
+		return nil, errors.Errorf("invalid pgp signature")
+	}
+	sig := bytesJoin(make([]byte, 32-len(sr)), sr, make([]byte, 32-len(ss)), ss)
+	return &pgpSignature{
+		sigType:  sigType,
+		hashAlgo: hashAlgo,
+		hashed:   hashed,
+		hashLeft: hashLeft,
+		sig:      sig,
+	}, nil
+}
+
+func (s *pgpSignature) verify(pk *EdX25519PublicKey, b []byte) error {
+	h, ok := s2k.HashIdToHash(s.hashAlgo)
+	if !ok || !h.Available() || h == crypto.SHA1 || h == crypto.MD5 {
+		return errors.Errorf("unsupported pgp signature hash %d", s.hashAlgo)
+	}
+	digest := pgpDigest(h, b, s.hashed)
+	if !bytes.Equal(digest[:2], s.hashLeft) {
+		return ErrVerifyFailed
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pk.Bytes()), digest, s.sig) {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+func pgpDigest(h crypto.Hash, b []byte, hashed []byte) []byte {
+	hasher := h.New()
+	_, _ = hasher.Write(b)
+	_, _ = hasher.Write(hashed)
+	_, _ = hasher.Write([]byte{0x04, 0xFF})
+	_, _ = hasher.Write(pgpUint32(uint32(len(hashed))))
+	return hasher.Sum(nil)
+}
+
+// pgpSign creates a (SHA256) signature packet body for a key signature.
+func pgpSign(key *EdX25519Key, sigType byte, ts uint32, fp []byte, keyFlags []byte, b []byte) []byte {
+	subpackets := bytesJoin(
+		pgpSubpacket(2, pgpUint32(ts)),
+		pgpSubpacket(27, keyFlags),
+		pgpSubpacket(33, append([]byte{0x04}, fp...)),
+	)
+	if sigType == pgpSigPositiveCert {
+		subpackets = bytesJoin(subpackets,
+			pgpSubpacket(11, []byte{pgpSymAES256, pgpSymAES128}),
+			pgpSubpacket(21, []byte{pgpHashSHA256}),
+			pgpSubpacket(30, []byte{0x01}),
+		)
+	}
+	hashed := bytesJoin([]byte{0x04, sigType, pgpAlgoEdDSA, pgpHashSHA256}, pgpUint16(uint16(len(subpackets))), subpackets)
+	unhashed := pgpSubpacket(16, fp[len(fp)-8:])
+	digest := pgpDigest(crypto.SHA256, b, hashed)
+	sig := ed25519.Sign(ed25519.PrivateKey(key.Private()), digest)
+	return bytesJoin(
+		hashed,
+		pgpUint16(uint16(len(unhashed))), unhashed,
+		digest[:2],
+		pgpMPI(sig[:32]), pgpMPI(sig[32:]),
+	)
+}
+
+func pgpSubpacket(typ byte, b []byte) []byte {
+	// Subpackets here are always < 192 bytes
+	return bytesJoin([]byte{byte(len(b) + 1), typ}, b)
+}
+
+func pgpEdDSAPublicBody(pk *EdX25519PublicKey, ts uint32) []byte {
+	return bytesJoin(
+		[]byte{0x04}, pgpUint32(ts), []byte{pgpAlgoEdDSA},
+		[]byte{byte(len(pgpOIDEd25519))}, pgpOIDEd25519,
+		pgpMPI(bytesJoin([]byte{0x40}, pk.Bytes())),
+	)
+}
+
+func pgpECDHPublicBody(pk *X25519PublicKey, ts uint32) []byte {
+	return bytesJoin(
+		[]byte{0x04}, pgpUint32(ts), []byte{pgpAlgoECDH},
+		[]byte{byte(len(pgpOIDCurve25519))}, pgpOIDCurve25519,
+		pgpMPI(bytesJoin([]byte{0x40}, pk.Bytes())),
+		// KDF parameters: SHA256, AES128
+		[]byte{0x03, 0x01, pgpHashSHA256, pgpSymAES128},
+	)
+}
+
+func pgpKeyHashPrefix(pub []byte) []byte {
+	return bytesJoin([]byte{0x99}, pgpUint16(uint16(len(pub))), pub)
+}
+
+func pgpFingerprint(pub []byte) []byte {
+	h := sha1.Sum(pgpKeyHashPrefix(pub))
+	return h[:]
+}
+
+// pgpMPI encodes bytes as an MPI (multiprecision integer).
+func pgpMPI(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	bits := 0
+	if len(b) > 0 {
+		bits = (len(b)-1)*8 + bitLen(b[0])
+	}
+	return bytesJoin(pgpUint16(uint16(bits)), b)
+}
+
+func bitLen(b byte) int {
+	n := 0
+	for ; b != 0; b >>= 1 {
+		n++
+	}
+	return n
+}
+
+func pgpChecksum(b []byte) int {
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	return sum & 0xffff
+}
+
+func pgpUint16(n uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, n)
+	return b
+}
+
+func pgpUint32(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+func pgpCanonicalText(b []byte) []byte {
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+// pgpClamp clamps a Curve25519 scalar, which OpenPGP implementations expect
+// (it doesn't change the public key).
+func pgpClamp(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+	out[0] &= 248
+	out[31] &= 127
+	out[31] |= 64
+	return out
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[len(b)-1-i]
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package keys_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestParsePGPKeys(t *testing.T) {
+	// Generated with gpg 2.2 (ed25519, cv25519)
+	pub, err := keys.ParsePGPKeys(testdata(t, "testdata/pgp/alice.pub.asc"), "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pub))
+	require.Equal(t, keys.ID("kex1u7ek28jtpf4k8s26d5t203733sr80fx4nw69rwth9vhtakh60lksrlmd5k"), pub[0].ID())
+	require.Equal(t, keys.ID("kbx1zsj59ksflq28uljgyzj9hq9lvlnc6a5sqdywlzend9m220502d9q50ke0k"), pub[1].ID())
+	require.IsType(t, &keys.EdX25519PublicKey{}, pub[0])
+	require.IsType(t, &keys.X25519PublicKey{}, pub[1])
+
+	sec, err := keys.ParsePGPKeys(testdata(t, "testdata/pgp/alice.sec.asc"), "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sec))
+	require.Equal(t, pub[0].ID(), sec[0].ID())
+	require.Equal(t, pub[1].ID(), sec[1].ID())
+	require.IsType(t, &keys.EdX25519Key{}, sec[0])
+	require.IsType(t, &keys.X25519Key{}, sec[1])
+
+	// Encrypted
+	_, err = keys.ParsePGPKeys(testdata(t, "testdata/pgp/bob.sec.asc"), "")
+	require.EqualError(t, err, "pgp secret key is encrypted, password required")
+	_, err = keys.ParsePGPKeys(testdata(t, "testdata/pgp/bob.sec.asc"), "invalidpassword")
+	require.EqualError(t, err, "failed to decrypt pgp secret key")
+	bob, err := keys.ParsePGPKeys(testdata(t, "testdata/pgp/bob.sec.asc"), "testpassword")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(bob))
+	require.Equal(t, keys.ID("kex1nkmr5cg0lu6cnhpnh32tyqmymwqesn8ta9lntjx8ywph8m4pqzfs80wreg"), bob[0].ID())
+
+	_, err = keys.ParsePGPKeys([]byte{}, "")
+	require.EqualError(t, err, "no supported pgp keys found")
+}
+
+func TestVerifyPGPDetached(t *testing.T) {
+	pub, err := keys.ParsePGPKeys(testdata(t, "testdata/pgp/alice.pub.asc"), "")
+	require.NoError(t, err)
+	alice := pub[0].(*keys.EdX25519PublicKey)
+	msg := testdata(t, "testdata/pgp/msg.txt")
+
+	// Armored
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.asc"), msg, alice)
+	require.NoError(t, err)
+	// Binary
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.sig"), msg, alice)
+	require.NoError(t, err)
+	// Text mode
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.text.asc"), msg, alice)
+	require.NoError(t, err)
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.text.asc"), []byte("hello world\r\n"), alice)
+	require.NoError(t, err)
+
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.asc"), []byte("hello world"), alice)
+	require.Equal(t, keys.ErrVerifyFailed, err)
+
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	err = keys.VerifyPGPDetached(testdata(t, "testdata/pgp/msg.txt.asc"), msg, bob.PublicKey())
+	require.Equal(t, keys.ErrVerifyFailed, err)
+}
+
+func TestEncodeToPGP(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	created := time.Unix(1600000000, 0)
+
+	pub, err := alice.EncodeToPGPPublic("alice <alice@example.com>", created)
+	require.NoError(t, err)
+	out, err := keys.ParsePGPKeys([]byte(pub), "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(out))
+	require.Equal(t, alice.ID(), out[0].ID())
+	require.Equal(t, alice.X25519Key().ID(), out[1].ID())
+	require.IsType(t, &keys.EdX25519PublicKey{}, out[0])
+
+	sec, err := alice.EncodeToPGP("alice <alice@example.com>", created, nil)
+	require.NoError(t, err)
+	out, err = keys.ParsePGPKeys([]byte(sec), "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(out))
+	require.Equal(t, alice, out[0])
+	require.Equal(t, alice.X25519Key().PublicKey(), out[1].(*keys.X25519Key).PublicKey())
+
+	sec, err = alice.EncodeToPGP("alice <alice@example.com>", created, []byte("testpassword"))
+	require.NoError(t, err)
+	_, err = keys.ParsePGPKeys([]byte(sec), "invalidpassword")
+	require.EqualError(t, err, "failed to decrypt pgp secret key")
+	out, err = keys.ParsePGPKeys([]byte(sec), "testpassword")
+	require.NoError(t, err)
+	require.Equal(t, alice, out[0])
+
+	_, err = alice.EncodeToPGPPublic("", created)
+	require.EqualError(t, err, "no user id")
+}
+
+type testPGPPacket struct {
+	tag  byte
+	body []byte
+}
+
+// testPGPPackets splits an armored key (from EncodeToPGP), with only new
+// format packets.
+func testPGPPackets(t *testing.T, s string) []testPGPPacket {
+	block, err := armor.Decode(strings.NewReader(s))
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(block.Body)
+	require.NoError(t, err)
+	packets := []testPGPPacket{}
+	for len(b) > 0 {
+		tag := b[0] & 0x3f
+		l, h := int(b[1]), 2
+		if l >= 192 {
+			l, h = (l-192)<<8+int(b[2])+192, 3
+		}
+		packets = append(packets, testPGPPacket{tag: tag, body: b[h : h+l]})
+		b = b[h+l:]
+	}
+	return packets
+}
+
+func testPGPEncode(packets ...testPGPPacket) []byte {
+	var buf bytes.Buffer
+	for _, p := range packets {
+		buf.WriteByte(0xC0 | p.tag)
+		if l := len(p.body); l < 192 {
+			buf.WriteByte(byte(l))
+		} else {
+			buf.WriteByte(byte((l-192)>>8) + 192)
+			buf.WriteByte(byte(l - 192))
+		}
+		buf.Write(p.body)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePGPKeysSignatures(t *testing.T) {
+	created := time.Unix(1600000000, 0)
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	apub, err := alice.EncodeToPGPPublic("alice <alice@example.com>", created)
+	require.NoError(t, err)
+	a := testPGPPackets(t, apub)
+	require.Equal(t, 5, len(a))
+	mallory := keys.NewEdX25519KeyFromSeed(testSeed(0x03))
+	mpub, err := mallory.EncodeToPGPPublic("mallory <mallory@example.com>", created)
+	require.NoError(t, err)
+	m := testPGPPackets(t, mpub)
+
+	// Mallory's subkey (and binding signature) with alice's primary key
+	out, err := keys.ParsePGPKeys(testPGPEncode(a[0], a[1], a[2], m[3], m[4]), "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(out))
+	require.Equal(t, alice.ID(), out[0].ID())
+
+	// Subkey without binding signature
+	out, err = keys.ParsePGPKeys(testPGPEncode(a[0], a[1], a[2], m[3]), "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(out))
+
+	// Subkey with alice's signature for her own subkey
+	out, err = keys.ParsePGPKeys(testPGPEncode(a[0], a[1], a[2], m[3], a[4]), "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(out))
+
+	// Alice's primary key with mallory's self-signature
+	_, err = keys.ParsePGPKeys(testPGPEncode(a[0], a[1], m[2], a[3], a[4]), "")
+	require.EqualError(t, err, "pgp primary key has no valid self-signature")
+	_, err = keys.ParsePGPKeys(testPGPEncode(a[0], a[1], a[3], a[4]), "")
+	require.EqualError(t, err, "pgp primary key has no valid self-signature")
+
+	// RSA primary key with an Ed25519 subkey
+	n := append([]byte{0x80}, bytes.Repeat([]byte{0x01}, 255)...)
+	rsa := testPGPPacket{tag: 6, body: bytes.Join([][]byte{
+		{0x04, 0x5f, 0x5e, 0x10, 0x00, 0x01},
+		{0x08, 0x00}, n,
+		{0x00, 0x11, 0x01, 0x00, 0x01},
+	}, nil)}
+	edSubkey := testPGPPacket{tag: 14, body: a[0].body}
+	_, err = keys.ParsePGPKeys(testPGPEncode(rsa, a[1], edSubkey), "")
+	require.EqualError(t, err, "unsupported pgp primary key")
+}
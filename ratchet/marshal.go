@@ -0,0 +1,101 @@
+package ratchet
+
+import (
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// stateVersion is the serialized session version.
+const stateVersion = 1
+
+type state struct {
+	Version    int          `msgpack:"v"`
+	DHs        []byte       `msgpack:"dhs"`
+	DHr        []byte       `msgpack:"dhr,omitempty"`
+	RK         []byte       `msgpack:"rk"`
+	CKs        []byte       `msgpack:"cks,omitempty"`
+	CKr        []byte       `msgpack:"ckr,omitempty"`
+	Ns         uint32       `msgpack:"ns"`
+	Nr         uint32       `msgpack:"nr"`
+	PN         uint32       `msgpack:"pn"`
+	Skipped    []skippedKey `msgpack:"skipped,omitempty"`
+	MaxSkip    int          `msgpack:"maxSkip"`
+	MaxSkipped int          `msgpack:"maxSkipped"`
+}
+
+// MarshalBinary serializes the session (msgpack), for example to save in a
+// keyring.Keyring or dstore.
+// The serialized session contains secret keys.
+func (s *Session) MarshalBinary() ([]byte, error) {
+	st := state{
+		Version:    stateVersion,
+		DHs:        s.dhs.Private(),
+		RK:         s.rk[:],
+		Ns:         s.ns,
+		Nr:         s.nr,
+		PN:         s.pn,
+		Skipped:    s.skipped,
+		MaxSkip:    s.maxSkip,
+		MaxSkipped: s.maxSkipped,
+	}
+	if s.dhr != nil {
+		st.DHr = s.dhr.Bytes()
+	}
+	if s.cks != nil {
+		st.CKs = s.cks[:]
+	}
+	if s.ckr != nil {
+		st.CKr = s.ckr[:]
+	}
+	return msgpack.Marshal(st)
+}
+
+// UnmarshalBinary deserializes a session from MarshalBinary.
+func (s *Session) UnmarshalBinary(b []byte) error {
+	var st state
+	if err := msgpack.Unmarshal(b, &st); err != nil {
+		return errors.Wrapf(err, "invalid ratchet session")
+	}
+	if st.Version != stateVersion {
+		return errors.Errorf("unsupported ratchet session version %d", st.Version)
+	}
+	if len(st.DHs) != 32 || len(st.RK) != 32 {
+		return errors.Errorf("invalid ratchet session")
+	}
+	for _, b := range [][]byte{st.DHr, st.CKs, st.CKr} {
+		if len(b) != 0 && len(b) != 32 {
+			return errors.Errorf("invalid ratchet session")
+		}
+	}
+	for _, sk := range st.Skipped {
+		if len(sk.DH) != 32 || len(sk.Key) != 32 {
+			return errors.Errorf("invalid ratchet session")
+		}
+	}
+	if err := checkLimits(st.MaxSkip, st.MaxSkipped); err != nil {
+		return errors.Wrapf(err, "invalid ratchet session")
+	}
+
+	out := Session{
+		dhs:        keys.NewX25519KeyFromPrivateKey(keys.Bytes32(st.DHs)),
+		rk:         keys.Bytes32(st.RK),
+		ns:         st.Ns,
+		nr:         st.Nr,
+		pn:         st.PN,
+		skipped:    st.Skipped,
+		maxSkip:    st.MaxSkip,
+		maxSkipped: st.MaxSkipped,
+	}
+	if len(st.DHr) > 0 {
+		out.dhr = keys.NewX25519PublicKey(keys.Bytes32(st.DHr))
+	}
+	if len(st.CKs) > 0 {
+		out.cks = keys.Bytes32(st.CKs)
+	}
+	if len(st.CKr) > 0 {
+		out.ckr = keys.Bytes32(st.CKr)
+	}
+	*s = out
+	return nil
+}
@@ -0,0 +1,360 @@
+// Package ratchet implements the Double Ratchet algorithm with X25519 ratchet
+// keys, for forward secret and post-compromise secure messaging.
+// See https://signal.org/docs/specifications/doubleratchet/.
+package ratchet
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/noise"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// info for root KDF.
+	rootInfo = "keys.pub/ratchet/v1"
+	// info for message key KDF.
+	messageInfo = "keys.pub/ratchet/v1/message"
+	// label for noise.Handshake ExportSecret.
+	handshakeLabel = "keys.pub/ratchet/v1"
+)
+
+// DefaultMaxSkip is the default maximum number of message keys that can be
+// skipped in a single chain.
+const DefaultMaxSkip = 1000
+
+// DefaultMaxSkipped is the default maximum number of skipped message keys
+// stored. If exceeded, the oldest skipped keys are removed.
+const DefaultMaxSkipped = 2000
+
+// headerLength is ratchet public key (32) + previous chain length (4) +
+// message number (4).
+const headerLength = 40
+
+// ErrDecryptFailed if message failed to decrypt.
+var ErrDecryptFailed = errors.New("ratchet decrypt failed")
+
+// Options for Session.
+type Options struct {
+	MaxSkip    int
+	MaxSkipped int
+}
+
+// Option for Session.
+type Option func(*Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		MaxSkip:    DefaultMaxSkip,
+		MaxSkipped: DefaultMaxSkipped,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// MaxSkip sets the maximum number of message keys that can be skipped in a
+// single chain.
+func MaxSkip(n int) Option {
+	return func(o *Options) {
+		o.MaxSkip = n
+	}
+}
+
+// MaxSkipped sets the maximum number of skipped message keys stored.
+func MaxSkipped(n int) Option {
+	return func(o *Options) {
+		o.MaxSkipped = n
+	}
+}
+
+// Session is a Double Ratchet session.
+//
+// Sessions are not safe for concurrent use. Use MarshalBinary to save the
+// session after each Encrypt or Decrypt.
+type Session struct {
+	dhs *keys.X25519Key
+	dhr *keys.X25519PublicKey
+	rk  *[32]byte
+	cks *[32]byte
+	ckr *[32]byte
+	ns  uint32
+	nr  uint32
+	pn  uint32
+
+	skipped []skippedKey
+
+	maxSkip    int
+	maxSkipped int
+}
+
+type skippedKey struct {
+	DH  []byte `msgpack:"dh"`
+	N   uint32 `msgpack:"n"`
+	Key []byte `msgpack:"k"`
+}
+
+// NewInitiator creates a session for the initiator from a shared secret and
+// the responder's ratchet public key (for example from X3DH, the signed
+// prekey).
+// The initiator sends the first message.
+func NewInitiator(secret *[32]byte, remote *keys.X25519PublicKey, opt ...Option) (*Session, error) {
+	if secret == nil {
+		return nil, errors.Errorf("no secret")
+	}
+	if remote == nil {
+		return nil, errors.Errorf("no remote ratchet key")
+	}
+	s, err := newSession(opt...)
+	if err != nil {
+		return nil, err
+	}
+	s.dhs = keys.GenerateX25519Key()
+	s.dhr = remote
+	out, err := dh(s.dhs, s.dhr)
+	if err != nil {
+		return nil, err
+	}
+	s.rk, s.cks = kdfRK(secret, out)
+	return s, nil
+}
+
+// NewResponder creates a session for the responder from a shared secret and
+// our ratchet key (for example from X3DH, the signed prekey).
+// The responder can't Encrypt until it has received a message.
+func NewResponder(secret *[32]byte, ratchetKey *keys.X25519Key, opt ...Option) (*Session, error) {
+	if secret == nil {
+		return nil, errors.Errorf("no secret")
+	}
+	if ratchetKey == nil {
+		return nil, errors.Errorf("no ratchet key")
+	}
+	s, err := newSession(opt...)
+	if err != nil {
+		return nil, err
+	}
+	s.dhs = ratchetKey
+	rk := *secret
+	s.rk = &rk
+	return s, nil
+}
+
+// NewSessionFromHandshake creates a session from a completed noise.Handshake.
+// The sender and recipient are the static keys used in the handshake.
+// The handshake initiator is the session initiator.
+func NewSessionFromHandshake(hs *noise.Handshake, sender *keys.X25519Key, recipient *keys.X25519PublicKey, opt ...Option) (*Session, error) {
+	secret, err := hs.ExportSecret(handshakeLabel)
+	if err != nil {
+		return nil, err
+	}
+	if hs.Initiator() {
+		return NewInitiator(secret, recipient, opt...)
+	}
+	return NewResponder(secret, sender, opt...)
+}
+
+func newSession(opt ...Option) (*Session, error) {
+	opts := newOptions(opt...)
+	if err := checkLimits(opts.MaxSkip, opts.MaxSkipped); err != nil {
+		return nil, err
+	}
+	return &Session{
+		maxSkip:    opts.MaxSkip,
+		maxSkipped: opts.MaxSkipped,
+	}, nil
+}
+
+func checkLimits(maxSkip int, maxSkipped int) error {
+	if maxSkip < 0 {
+		return errors.Errorf("invalid max skip %d", maxSkip)
+	}
+	if maxSkipped < 0 {
+		return errors.Errorf("invalid max skipped %d", maxSkipped)
+	}
+	return nil
+}
+
+// Encrypt a message with associated data.
+func (s *Session) Encrypt(b []byte, ad []byte) ([]byte, error) {
+	if s.cks == nil {
+		return nil, errors.Errorf("no sending chain, waiting for first message")
+	}
+	var mk *[32]byte
+	s.cks, mk = kdfCK(s.cks)
+	header := encodeHeader(s.dhs.PublicKey().Bytes32(), s.pn, s.ns)
+	s.ns++
+	return encrypt(mk, b, ad, header), nil
+}
+
+// Decrypt a message with associated data.
+// Messages can be received out of order; keys for skipped messages are
+// stored (up to the MaxSkipped option).
+// If decrypt fails, the session is unchanged.
+func (s *Session) Decrypt(b []byte, ad []byte) ([]byte, error) {
+	if len(b) < headerLength+16 {
+		return nil, errors.Errorf("invalid ratchet message")
+	}
+	header := b[:headerLength]
+	dh, pn, n := decodeHeader(header)
+
+	if i := s.findSkipped(dh, n); i >= 0 {
+		out, err := decrypt(keys.Bytes32(s.skipped[i].Key), b[headerLength:], ad, header)
+		if err != nil {
+			return nil, err
+		}
+		s.skipped = append(s.skipped[:i], s.skipped[i+1:]...)
+		return out, nil
+	}
+
+	// Work on a copy, so the session is unchanged on failure.
+	c := s.clone()
+	if c.dhr == nil || *dh != *c.dhr.Bytes32() {
+		if err := c.skip(pn); err != nil {
+			return nil, err
+		}
+		if err := c.step(keys.NewX25519PublicKey(dh)); err != nil {
+			return nil, err
+		}
+	}
+	if c.ckr == nil {
+		// An initiator has no receiving chain until the first ratchet step.
+		return nil, errors.Errorf("invalid ratchet message")
+	}
+	if err := c.skip(n); err != nil {
+		return nil, err
+	}
+	var mk *[32]byte
+	c.ckr, mk = kdfCK(c.ckr)
+	c.nr++
+	out, err := decrypt(mk, b[headerLength:], ad, header)
+	if err != nil {
+		return nil, err
+	}
+	*s = *c
+	return out, nil
+}
+
+// step performs a DH ratchet step.
+func (s *Session) step(remote *keys.X25519PublicKey) error {
+	s.pn = s.ns
+	s.ns = 0
+	s.nr = 0
+	s.dhr = remote
+	dr, err := dh(s.dhs, s.dhr)
+	if err != nil {
+		return err
+	}
+	s.rk, s.ckr = kdfRK(s.rk, dr)
+	s.dhs = keys.GenerateX25519Key()
+	ds, err := dh(s.dhs, s.dhr)
+	if err != nil {
+		return err
+	}
+	s.rk, s.cks = kdfRK(s.rk, ds)
+	return nil
+}
+
+// skip stores message keys for the receiving chain until n.
+func (s *Session) skip(n uint32) error {
+	if s.ckr == nil {
+		return nil
+	}
+	if n < s.nr {
+		return nil
+	}
+	if int64(n)-int64(s.nr) > int64(s.maxSkip) {
+		return errors.Errorf("too many skipped messages")
+	}
+	pk := s.dhr.Bytes()
+	for s.nr < n {
+		var mk *[32]byte
+		s.ckr, mk = kdfCK(s.ckr)
+		s.skipped = append(s.skipped, skippedKey{DH: pk, N: s.nr, Key: mk[:]})
+		s.nr++
+	}
+	if len(s.skipped) > s.maxSkipped {
+		s.skipped = s.skipped[len(s.skipped)-s.maxSkipped:]
+	}
+	return nil
+}
+
+func (s *Session) findSkipped(dh *[32]byte, n uint32) int {
+	for i, sk := range s.skipped {
+		if sk.N == n && hmac.Equal(sk.DH, dh[:]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) clone() *Session {
+	c := *s
+	c.skipped = make([]skippedKey, len(s.skipped))
+	copy(c.skipped, s.skipped)
+	return &c
+}
+
+// kdfRK returns new root key and chain key.
+func kdfRK(rk *[32]byte, dh []byte) (*[32]byte, *[32]byte) {
+	out := keys.HKDFSHA256(dh, 64, rk[:], []byte(rootInfo))
+	return keys.Bytes32(out[:32]), keys.Bytes32(out[32:])
+}
+
+// kdfCK returns next chain key and message key.
+func kdfCK(ck *[32]byte) (*[32]byte, *[32]byte) {
+	return keys.Bytes32(hmacSHA256(ck[:], []byte{0x02})), keys.Bytes32(hmacSHA256(ck[:], []byte{0x01}))
+}
+
+func encrypt(mk *[32]byte, b []byte, ad []byte, header []byte) []byte {
+	aead, nonce := messageCipher(mk)
+	ad = append(append([]byte{}, ad...), header...)
+	return append(header, aead.Seal(nil, nonce, b, ad)...)
+}
+
+func decrypt(mk *[32]byte, b []byte, ad []byte, header []byte) ([]byte, error) {
+	aead, nonce := messageCipher(mk)
+	ad = append(append([]byte{}, ad...), header...)
+	out, err := aead.Open(nil, nonce, b, ad)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return out, nil
+}
+
+func messageCipher(mk *[32]byte) (cipher.AEAD, []byte) {
+	kn := keys.HKDFSHA256(mk[:], chacha20poly1305.KeySize+chacha20poly1305.NonceSize, nil, []byte(messageInfo))
+	aead, err := chacha20poly1305.New(kn[:chacha20poly1305.KeySize])
+	if err != nil {
+		panic(err)
+	}
+	return aead, kn[chacha20poly1305.KeySize:]
+}
+
+func encodeHeader(dh *[32]byte, pn uint32, n uint32) []byte {
+	b := make([]byte, headerLength)
+	copy(b, dh[:])
+	binary.BigEndian.PutUint32(b[32:], pn)
+	binary.BigEndian.PutUint32(b[36:], n)
+	return b
+}
+
+func decodeHeader(b []byte) (*[32]byte, uint32, uint32) {
+	return keys.Bytes32(b[:32]), binary.BigEndian.Uint32(b[32:]), binary.BigEndian.Uint32(b[36:])
+}
+
+func dh(priv *keys.X25519Key, pub *keys.X25519PublicKey) ([]byte, error) {
+	return curve25519.X25519(priv.Private(), pub.Bytes())
+}
+
+func hmacSHA256(key []byte, b []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(b)
+	return h.Sum(nil)
+}
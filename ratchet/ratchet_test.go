@@ -0,0 +1,256 @@
+package ratchet_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/keyring"
+	"github.com/keys-pub/keys/noise"
+	"github.com/keys-pub/keys/ratchet"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func newSessions(t *testing.T, opt ...ratchet.Option) (*ratchet.Session, *ratchet.Session) {
+	secret := keys.Rand32()
+	bobKey := keys.GenerateX25519Key()
+	alice, err := ratchet.NewInitiator(secret, bobKey.PublicKey(), opt...)
+	require.NoError(t, err)
+	bob, err := ratchet.NewResponder(secret, bobKey, opt...)
+	require.NoError(t, err)
+	return alice, bob
+}
+
+func TestSession(t *testing.T) {
+	alice, bob := newSessions(t)
+	ad := []byte("ad")
+
+	_, err := bob.Encrypt([]byte("hi"), ad)
+	require.EqualError(t, err, "no sending chain, waiting for first message")
+
+	for i := 0; i < 3; i++ {
+		msg := fmt.Sprintf("alice %d", i)
+		b, err := alice.Encrypt([]byte(msg), ad)
+		require.NoError(t, err)
+		out, err := bob.Decrypt(b, ad)
+		require.NoError(t, err)
+		require.Equal(t, msg, string(out))
+
+		msg = fmt.Sprintf("bob %d", i)
+		b, err = bob.Encrypt([]byte(msg), ad)
+		require.NoError(t, err)
+		out, err = alice.Decrypt(b, ad)
+		require.NoError(t, err)
+		require.Equal(t, msg, string(out))
+	}
+
+	// Invalid associated data
+	b, err := alice.Encrypt([]byte("hello"), ad)
+	require.NoError(t, err)
+	_, err = bob.Decrypt(b, []byte("other"))
+	require.Equal(t, ratchet.ErrDecryptFailed, err)
+	out, err := bob.Decrypt(b, ad)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(out))
+
+	// Replay
+	_, err = bob.Decrypt(b, ad)
+	require.Equal(t, ratchet.ErrDecryptFailed, err)
+}
+
+func TestOutOfOrder(t *testing.T) {
+	alice, bob := newSessions(t)
+
+	msgs := [][]byte{}
+	for i := 0; i < 5; i++ {
+		b, err := alice.Encrypt([]byte(fmt.Sprintf("a%d", i)), nil)
+		require.NoError(t, err)
+		msgs = append(msgs, b)
+	}
+	out, err := bob.Decrypt(msgs[3], nil)
+	require.NoError(t, err)
+	require.Equal(t, "a3", string(out))
+
+	// Bob replies, alice ratchets, previous chain messages still arrive.
+	b, err := bob.Encrypt([]byte("b0"), nil)
+	require.NoError(t, err)
+	out, err = alice.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "b0", string(out))
+
+	b, err = alice.Encrypt([]byte("a5"), nil)
+	require.NoError(t, err)
+	out, err = bob.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "a5", string(out))
+
+	for _, i := range []int{4, 0, 2, 1} {
+		out, err = bob.Decrypt(msgs[i], nil)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("a%d", i), string(out))
+	}
+}
+
+func TestMaxSkip(t *testing.T) {
+	alice, bob := newSessions(t, ratchet.MaxSkip(2), ratchet.MaxSkipped(3))
+
+	msgs := [][]byte{}
+	for i := 0; i < 8; i++ {
+		b, err := alice.Encrypt([]byte(fmt.Sprintf("a%d", i)), nil)
+		require.NoError(t, err)
+		msgs = append(msgs, b)
+	}
+	_, err := bob.Decrypt(msgs[3], nil)
+	require.EqualError(t, err, "too many skipped messages")
+
+	_, err = bob.Decrypt(msgs[2], nil)
+	require.NoError(t, err)
+	_, err = bob.Decrypt(msgs[5], nil)
+	require.NoError(t, err)
+
+	// Skipped 0, 1, 3, 4; only the last 3 are kept.
+	_, err = bob.Decrypt(msgs[0], nil)
+	require.Equal(t, ratchet.ErrDecryptFailed, err)
+	for _, i := range []int{1, 3, 4} {
+		out, err := bob.Decrypt(msgs[i], nil)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("a%d", i), string(out))
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	alice, bob := newSessions(t)
+	kr := keyring.NewMem()
+
+	save := func(id string, s *ratchet.Session) {
+		b, err := s.MarshalBinary()
+		require.NoError(t, err)
+		err = kr.Set(id, b)
+		require.NoError(t, err)
+	}
+	load := func(id string) *ratchet.Session {
+		b, err := kr.Get(id)
+		require.NoError(t, err)
+		var s ratchet.Session
+		err = s.UnmarshalBinary(b)
+		require.NoError(t, err)
+		return &s
+	}
+
+	skipped, err := alice.Encrypt([]byte("skipped"), nil)
+	require.NoError(t, err)
+	b, err := alice.Encrypt([]byte("hello"), nil)
+	require.NoError(t, err)
+	save("alice", alice)
+	save("bob", bob)
+
+	bob = load("bob")
+	out, err := bob.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(out))
+	save("bob", bob)
+
+	bob = load("bob")
+	out, err = bob.Decrypt(skipped, nil)
+	require.NoError(t, err)
+	require.Equal(t, "skipped", string(out))
+
+	b, err = bob.Encrypt([]byte("reply"), nil)
+	require.NoError(t, err)
+	alice = load("alice")
+	out, err = alice.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "reply", string(out))
+
+	var s ratchet.Session
+	err = s.UnmarshalBinary([]byte{0x01})
+	require.Error(t, err)
+}
+
+func TestSessionFromHandshake(t *testing.T) {
+	alice := keys.GenerateX25519Key()
+	bob := keys.GenerateX25519Key()
+
+	na, err := noise.NewHandshake(alice, bob.PublicKey(), true)
+	require.NoError(t, err)
+	nb, err := noise.NewHandshake(bob, alice.PublicKey(), false)
+	require.NoError(t, err)
+
+	_, err = ratchet.NewSessionFromHandshake(na, alice, bob.PublicKey())
+	require.EqualError(t, err, "handshake not complete")
+
+	b, err := na.Write(nil)
+	require.NoError(t, err)
+	_, err = nb.Read(b)
+	require.NoError(t, err)
+	b, err = nb.Write(nil)
+	require.NoError(t, err)
+	_, err = na.Read(b)
+	require.NoError(t, err)
+
+	sa, err := ratchet.NewSessionFromHandshake(na, alice, bob.PublicKey())
+	require.NoError(t, err)
+	sb, err := ratchet.NewSessionFromHandshake(nb, bob, alice.PublicKey())
+	require.NoError(t, err)
+
+	b, err = sa.Encrypt([]byte("hello"), nil)
+	require.NoError(t, err)
+	out, err := sb.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(out))
+
+	b, err = sb.Encrypt([]byte("hi"), nil)
+	require.NoError(t, err)
+	out, err = sa.Decrypt(b, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(out))
+}
+
+func TestDecryptNoReceivingChain(t *testing.T) {
+	secret := keys.Rand32()
+	bobKey := keys.GenerateX25519Key()
+	alice, err := ratchet.NewInitiator(secret, bobKey.PublicKey())
+	require.NoError(t, err)
+
+	// Header with the current remote ratchet key, before alice has received
+	// anything.
+	b := append(bobKey.PublicKey().Bytes(), make([]byte, 8+32)...)
+	_, err = alice.Decrypt(b, nil)
+	require.EqualError(t, err, "invalid ratchet message")
+
+	// Session is still usable
+	bob, err := ratchet.NewResponder(secret, bobKey)
+	require.NoError(t, err)
+	encrypted, err := alice.Encrypt([]byte("hi"), nil)
+	require.NoError(t, err)
+	out, err := bob.Decrypt(encrypted, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(out))
+}
+
+func TestInvalidLimits(t *testing.T) {
+	secret := keys.Rand32()
+	bobKey := keys.GenerateX25519Key()
+	_, err := ratchet.NewInitiator(secret, bobKey.PublicKey(), ratchet.MaxSkipped(-1))
+	require.EqualError(t, err, "invalid max skipped -1")
+	_, err = ratchet.NewResponder(secret, bobKey, ratchet.MaxSkip(-1))
+	require.EqualError(t, err, "invalid max skip -1")
+
+	// Stored session with a negative limit
+	alice, _ := newSessions(t)
+	b, err := alice.MarshalBinary()
+	require.NoError(t, err)
+	for _, field := range []string{"maxSkip", "maxSkipped"} {
+		var st map[string]interface{}
+		err = msgpack.Unmarshal(b, &st)
+		require.NoError(t, err)
+		st[field] = -1
+		mb, err := msgpack.Marshal(st)
+		require.NoError(t, err)
+		var s ratchet.Session
+		err = s.UnmarshalBinary(mb)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid ratchet session: invalid max skip")
+	}
+}
@@ -0,0 +1,329 @@
+package saltpack
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// ArchiveFile describes a file (or directory) in an archive.
+type ArchiveFile struct {
+	// Path (slash separated) relative to the archive root.
+	Path string
+	// Size in bytes.
+	Size int64
+	// Mode permission bits.
+	Mode os.FileMode
+	// ModTime is the modification time.
+	ModTime time.Time
+	// IsDir if directory.
+	IsDir bool
+}
+
+// ExtractOptions for SigncryptOpenArchive.
+type ExtractOptions struct {
+	// MaxFileSize is the maximum size of a file.
+	MaxFileSize int64
+	// MaxSize is the maximum total size of all files.
+	MaxSize int64
+	// MaxFiles is the maximum number of files (and directories).
+	MaxFiles int
+}
+
+// ExtractOption for SigncryptOpenArchive.
+type ExtractOption func(*ExtractOptions)
+
+func newExtractOptions(opts ...ExtractOption) ExtractOptions {
+	options := ExtractOptions{
+		MaxFileSize: 1 << 30,
+		MaxSize:     4 << 30,
+		MaxFiles:    10000,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// MaxFileSize sets the maximum size of an extracted file.
+func MaxFileSize(n int64) ExtractOption {
+	return func(o *ExtractOptions) {
+		o.MaxFileSize = n
+	}
+}
+
+// MaxSize sets the maximum total size of extracted files.
+func MaxSize(n int64) ExtractOption {
+	return func(o *ExtractOptions) {
+		o.MaxSize = n
+	}
+}
+
+// MaxFiles sets the maximum number of extracted files (and directories).
+func MaxFiles(n int) ExtractOption {
+	return func(o *ExtractOptions) {
+		o.MaxFiles = n
+	}
+}
+
+// SigncryptArchive writes a directory tree as a signcrypted (tar) archive.
+// Only regular files and directories are supported.
+func SigncryptArchive(w io.Writer, dir string, armored bool, sender *keys.EdX25519Key, recipients ...keys.ID) error {
+	if dir == "" {
+		return errors.Errorf("dir not specified")
+	}
+	stream, err := NewSigncryptStream(w, armored, sender, recipients...)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(stream)
+	walkFn := func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		return writeArchiveFile(tw, p, filepath.ToSlash(rel), fi)
+	}
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
+func writeArchiveFile(tw *tar.Writer, p string, name string, fi os.FileInfo) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(fi.Mode().Perm()),
+		ModTime: fi.ModTime(),
+		Format:  tar.FormatPAX,
+	}
+	switch {
+	case fi.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		return tw.WriteHeader(hdr)
+	case fi.Mode().IsRegular():
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = fi.Size()
+	default:
+		return errors.Errorf("unsupported file type %s", name)
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(p) // #nosec
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	n, err := io.Copy(tw, f)
+	if err != nil {
+		return err
+	}
+	if n != fi.Size() {
+		return errors.Errorf("file changed while archiving %s", name)
+	}
+	return nil
+}
+
+// SigncryptOpenArchive extracts a signcrypted archive into dir, returning the
+// sender and the extracted files.
+//
+// Paths that are absolute or outside of dir, links and other special files
+// are rejected. Existing files are not overwritten. Extraction is limited by
+// ExtractOptions (MaxFileSize, MaxSize and MaxFiles).
+// If an error occurs, any extracted files are removed.
+func SigncryptOpenArchive(r io.Reader, dir string, armored bool, kr Keyring, opt ...ExtractOption) (*keys.EdX25519PublicKey, []*ArchiveFile, error) {
+	opts := newExtractOptions(opt...)
+	if dir == "" {
+		return nil, nil, errors.Errorf("dir not specified")
+	}
+	stream, sender, err := NewSigncryptOpenStream(r, armored, kr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	x := &extractor{dir: dir, opts: opts}
+	if err := x.extract(stream); err != nil {
+		x.cleanup()
+		return nil, nil, err
+	}
+	return sender, x.files, nil
+}
+
+type extractor struct {
+	dir     string
+	opts    ExtractOptions
+	files   []*ArchiveFile
+	size    int64
+	created []string
+}
+
+func (x *extractor) extract(stream io.Reader) error {
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(x.files) >= x.opts.MaxFiles {
+			return errors.Errorf("archive has too many files")
+		}
+		if err := x.extractFile(tr, hdr); err != nil {
+			return err
+		}
+	}
+	// Read the rest of the stream so the final (signed) chunk is verified.
+	if _, err := io.Copy(ioutil.Discard, stream); err != nil {
+		return err
+	}
+	// Set directory times after their files are extracted.
+	for _, file := range x.files {
+		if file.IsDir {
+			p := filepath.Join(x.dir, filepath.FromSlash(file.Path))
+			if err := os.Chtimes(p, file.ModTime, file.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractFile(tr *tar.Reader, hdr *tar.Header) error {
+	name, err := archivePath(hdr.Name)
+	if err != nil {
+		return err
+	}
+	if err := x.mkdirs(path.Dir(name)); err != nil {
+		return err
+	}
+	p := filepath.Join(x.dir, filepath.FromSlash(name))
+	mode := os.FileMode(hdr.Mode).Perm()
+	file := &ArchiveFile{Path: name, Mode: mode, ModTime: hdr.ModTime}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		file.IsDir = true
+		if err := x.mkdir(name); err != nil {
+			return err
+		}
+		// Keep owner permissions so we can extract into (and clean up) the
+		// directory.
+		mode |= 0700
+	case tar.TypeReg:
+		if hdr.Size > x.opts.MaxFileSize {
+			return errors.Errorf("file too large %s", name)
+		}
+		if x.size+hdr.Size > x.opts.MaxSize {
+			return errors.Errorf("archive too large")
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // #nosec
+		if err != nil {
+			if os.IsExist(err) {
+				return errors.Errorf("file already exists %s", name)
+			}
+			return err
+		}
+		x.created = append(x.created, p)
+		n, err := io.Copy(f, io.LimitReader(tr, hdr.Size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if n != hdr.Size {
+			return errors.Errorf("file truncated %s", name)
+		}
+		x.size += n
+		file.Size = n
+	default:
+		return errors.Errorf("unsupported file type %s", name)
+	}
+
+	if err := os.Chmod(p, mode); err != nil {
+		return err
+	}
+	if !file.IsDir {
+		if err := os.Chtimes(p, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	x.files = append(x.files, file)
+	return nil
+}
+
+// mkdirs creates parent directories (for a clean relative path), checking that
+// existing ones are directories and not links.
+func (x *extractor) mkdirs(name string) error {
+	if name == "." {
+		return nil
+	}
+	if err := x.mkdirs(path.Dir(name)); err != nil {
+		return err
+	}
+	return x.mkdir(name)
+}
+
+func (x *extractor) mkdir(name string) error {
+	p := filepath.Join(x.dir, filepath.FromSlash(name))
+	fi, err := os.Lstat(p)
+	if err == nil {
+		if !fi.IsDir() {
+			return errors.Errorf("file already exists %s", name)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Mkdir(p, 0700); err != nil {
+		return err
+	}
+	x.created = append(x.created, p)
+	return nil
+}
+
+func (x *extractor) cleanup() {
+	for i := len(x.created) - 1; i >= 0; i-- {
+		_ = os.Remove(x.created[i])
+	}
+}
+
+// archivePath returns a clean relative (slash separated) path, or an error if
+// the path is absolute or outside of the archive root.
+func archivePath(name string) (string, error) {
+	if name == "" || strings.Contains(name, "\\") || strings.Contains(name, "\x00") {
+		return "", errors.Errorf("invalid path %q", name)
+	}
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errors.Errorf("invalid path %q", name)
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", errors.Errorf("invalid path %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,179 @@
+package saltpack_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/stretchr/testify/require"
+)
+
+func testArchiveDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hi"), 0600)
+	require.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), bytes.Repeat([]byte{0x01}, 100), 0640)
+	require.NoError(t, err)
+	return dir
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "extract")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestArchive(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+
+	dir := testArchiveDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, armored := range []bool{false, true} {
+		var buf bytes.Buffer
+		err := saltpack.SigncryptArchive(&buf, dir, armored, alice, bob.ID())
+		require.NoError(t, err)
+
+		out := tempDir(t)
+		defer os.RemoveAll(out)
+		sender, files, err := saltpack.SigncryptOpenArchive(bytes.NewReader(buf.Bytes()), out, armored, saltpack.NewKeyring(bob))
+		require.NoError(t, err)
+		require.Equal(t, alice.ID(), sender.ID())
+
+		paths := []string{}
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		require.Equal(t, []string{"a.txt", "sub", "sub/b.txt", "sub/empty"}, paths)
+		require.Equal(t, int64(100), files[2].Size)
+		require.Equal(t, os.FileMode(0640), files[2].Mode)
+		require.True(t, files[3].IsDir)
+
+		b, err := ioutil.ReadFile(filepath.Join(out, "sub", "b.txt"))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte{0x01}, 100), b)
+		fi, err := os.Stat(filepath.Join(out, "sub", "empty"))
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+
+		// Files exist
+		_, _, err = saltpack.SigncryptOpenArchive(bytes.NewReader(buf.Bytes()), out, armored, saltpack.NewKeyring(bob))
+		require.EqualError(t, err, "file already exists a.txt")
+	}
+
+	// Not a recipient
+	var buf bytes.Buffer
+	err := saltpack.SigncryptArchive(&buf, dir, false, alice, bob.ID())
+	require.NoError(t, err)
+	out := tempDir(t)
+	defer os.RemoveAll(out)
+	_, _, err = saltpack.SigncryptOpenArchive(bytes.NewReader(buf.Bytes()), out, false, saltpack.NewKeyring(alice))
+	require.EqualError(t, err, "no decryption key found for message")
+}
+
+func TestArchiveLimits(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	kr := saltpack.NewKeyring(bob)
+
+	dir := testArchiveDir(t)
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	err := saltpack.SigncryptArchive(&buf, dir, false, alice, bob.ID())
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		opt saltpack.ExtractOption
+		err string
+	}{
+		{saltpack.MaxFileSize(50), "file too large sub/b.txt"},
+		{saltpack.MaxSize(101), "archive too large"},
+		{saltpack.MaxFiles(2), "archive has too many files"},
+	} {
+		out := tempDir(t)
+		defer os.RemoveAll(out)
+		_, _, err = saltpack.SigncryptOpenArchive(bytes.NewReader(buf.Bytes()), out, false, kr, test.opt)
+		require.EqualError(t, err, test.err)
+
+		// Extracted files are removed
+		fis, err := ioutil.ReadDir(out)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(fis))
+	}
+
+	// Truncated
+	out := tempDir(t)
+	defer os.RemoveAll(out)
+	_, _, err = saltpack.SigncryptOpenArchive(bytes.NewReader(buf.Bytes()[:buf.Len()-10]), out, false, kr)
+	require.Error(t, err)
+	fis, err := ioutil.ReadDir(out)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(fis))
+}
+
+func signcryptTar(t *testing.T, sender *keys.EdX25519Key, recipient keys.ID, hdrs ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	stream, err := saltpack.NewSigncryptStream(&buf, false, sender, recipient)
+	require.NoError(t, err)
+	tw := tar.NewWriter(stream)
+	for _, hdr := range hdrs {
+		err = tw.WriteHeader(hdr)
+		require.NoError(t, err)
+		if hdr.Size > 0 {
+			_, err = tw.Write(bytes.Repeat([]byte{0x01}, int(hdr.Size)))
+			require.NoError(t, err)
+		}
+	}
+	err = tw.Close()
+	require.NoError(t, err)
+	err = stream.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestArchiveInvalidPaths(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	kr := saltpack.NewKeyring(bob)
+
+	for _, test := range []struct {
+		hdr *tar.Header
+		err string
+	}{
+		{&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}, `invalid path "../evil.txt"`},
+		{&tar.Header{Name: "a/../../evil.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}, `invalid path "a/../../evil.txt"`},
+		{&tar.Header{Name: "/etc/evil.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}, `invalid path "/etc/evil.txt"`},
+		{&tar.Header{Name: "..\\evil.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}, `invalid path "..\\evil.txt"`},
+		{&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}, "unsupported file type link"},
+		{&tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}, "unsupported file type hard"},
+	} {
+		b := signcryptTar(t, alice, bob.ID(), test.hdr)
+		out := tempDir(t)
+		defer os.RemoveAll(out)
+		_, _, err := saltpack.SigncryptOpenArchive(bytes.NewReader(b), out, false, kr)
+		require.EqualError(t, err, test.err)
+	}
+
+	// Existing symlink in the extract dir
+	outside := tempDir(t)
+	defer os.RemoveAll(outside)
+	out := tempDir(t)
+	defer os.RemoveAll(out)
+	err := os.Symlink(outside, filepath.Join(out, "sub"))
+	require.NoError(t, err)
+	b := signcryptTar(t, alice, bob.ID(), &tar.Header{Name: "sub/evil.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0600})
+	_, _, err = saltpack.SigncryptOpenArchive(bytes.NewReader(b), out, false, kr)
+	require.EqualError(t, err, "file already exists sub")
+	fis, err := ioutil.ReadDir(outside)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(fis))
+}
@@ -61,12 +61,13 @@ func (k boxKey) Precompute(peer ksaltpack.BoxPublicKey) ksaltpack.BoxPrecomputed
 // boxPublicKey is a wrapper for keys.BoxPublicKey to support a ksaltpack.BoxPublicKey.
 type boxPublicKey struct {
 	ksaltpack.BoxPublicKey
-	pk *keys.X25519PublicKey
+	pk   *keys.X25519PublicKey
+	hide bool
 }
 
 // newBoxPublicKey from byte array.
 func newBoxPublicKey(pk *keys.X25519PublicKey) *boxPublicKey {
-	return &boxPublicKey{pk: pk}
+	return &boxPublicKey{pk: pk, hide: true}
 }
 
 // ToKID (for ksaltpack.BoxPublicKey)
@@ -97,8 +98,7 @@ func (p *boxPublicKey) CreateEphemeralKey() (ksaltpack.BoxSecretKey, error) {
 
 // HideIdentity (for ksaltpack.BoxPublicKey)
 func (p *boxPublicKey) HideIdentity() bool {
-	// TODO: Make configurable
-	return true
+	return p.hide
 }
 
 type boxPrecomputedSharedKey [32]byte
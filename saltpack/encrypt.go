@@ -15,15 +15,20 @@ import (
 // Sender can be nil.
 // See https://saltpack.org/encryption-format-v2.
 func Encrypt(b []byte, armored bool, sender *keys.X25519Key, recipients ...keys.ID) ([]byte, error) {
-	recs, err := boxPublicKeys(recipients)
+	return EncryptWithOptions(b, sender, recipients, withArmored(armored))
+}
+
+// EncryptWithOptions encrypts to recipients with options, for example to make
+// recipients visible or the sender anonymous.
+// Sender can be nil.
+func EncryptWithOptions(b []byte, sender *keys.X25519Key, recipients []keys.ID, opt ...EncryptOption) ([]byte, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := boxPublicKeys(recipients, opts.HideRecipients)
 	if err != nil {
 		return nil, err
 	}
-	var sbk ksaltpack.BoxSecretKey
-	if sender != nil {
-		sbk = newBoxKey(sender)
-	}
-	if armored {
+	sbk := boxSenderKey(sender, opts)
+	if opts.Armored {
 		s, err := ksaltpack.EncryptArmor62Seal(ksaltpack.Version2(), b, sbk, recs, "")
 		if err != nil {
 			return nil, err
@@ -33,6 +38,13 @@ func Encrypt(b []byte, armored bool, sender *keys.X25519Key, recipients ...keys.
 	return ksaltpack.Seal(ksaltpack.Version2(), b, sbk, recs)
 }
 
+func boxSenderKey(sender *keys.X25519Key, opts EncryptOptions) ksaltpack.BoxSecretKey {
+	if sender == nil || opts.Anonymous {
+		return nil
+	}
+	return newBoxKey(sender)
+}
+
 func x25519SenderKey(info *ksaltpack.MessageKeyInfo) (*keys.X25519PublicKey, error) {
 	var sender *keys.X25519PublicKey
 	if !info.SenderIsAnon {
@@ -95,15 +107,19 @@ func Decrypt(b []byte, armored bool, kr Keyring) ([]byte, *keys.X25519PublicKey,
 // NewEncryptStream creates an encrypted armored io.WriteCloser.
 // Sender can be nil, if you want it to be anonymous.
 func NewEncryptStream(w io.Writer, armored bool, sender *keys.X25519Key, recipients ...keys.ID) (io.WriteCloser, error) {
-	recs, err := boxPublicKeys(recipients)
+	return NewEncryptStreamWithOptions(w, sender, recipients, withArmored(armored))
+}
+
+// NewEncryptStreamWithOptions creates an encrypt stream with options.
+// See EncryptWithOptions.
+func NewEncryptStreamWithOptions(w io.Writer, sender *keys.X25519Key, recipients []keys.ID, opt ...EncryptOption) (io.WriteCloser, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := boxPublicKeys(recipients, opts.HideRecipients)
 	if err != nil {
 		return nil, err
 	}
-	var sbk ksaltpack.BoxSecretKey
-	if sender != nil {
-		sbk = newBoxKey(sender)
-	}
-	if armored {
+	sbk := boxSenderKey(sender, opts)
+	if opts.Armored {
 		return ksaltpack.NewEncryptArmor62Stream(ksaltpack.Version2(), w, sbk, recs, "")
 	}
 	return ksaltpack.NewEncryptStream(ksaltpack.Version2(), w, sbk, recs)
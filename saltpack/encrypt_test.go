@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/keyring"
 	"github.com/keys-pub/keys/saltpack"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -195,3 +197,59 @@ func TestEncryptWithEdX25519Key(t *testing.T) {
 	require.NotNil(t, sender)
 	require.Equal(t, alice.X25519Key().PublicKey().ID(), sender.ID())
 }
+
+type noItemsKeyring struct {
+	keyring.Keyring
+}
+
+func (k noItemsKeyring) Items(prefix string) ([]*keyring.Item, error) {
+	return nil, errors.Errorf("items not allowed")
+}
+
+func TestEncryptWithOptions(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	message := []byte("hi bob")
+
+	// Hidden (default)
+	encrypted, err := saltpack.EncryptWithOptions(message, alice, []keys.ID{bob.ID()})
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(encrypted, bob.PublicKey().Bytes()))
+	out, sender, err := saltpack.Decrypt(encrypted, false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+	require.Equal(t, alice.ID(), sender.ID())
+
+	// Visible, with key lookup (without listing keyring items)
+	encrypted, err = saltpack.EncryptWithOptions(message, alice, []keys.ID{bob.ID()}, saltpack.VisibleRecipients())
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(encrypted, bob.PublicKey().Bytes()))
+	mem := keyring.NewMem()
+	setKey(t, mem, bob)
+	out, _, err = saltpack.Decrypt(encrypted, false, saltpack.NewKeyringStore(noItemsKeyring{mem}))
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+
+	// Anonymous, armored
+	encrypted, err = saltpack.EncryptWithOptions(message, alice, []keys.ID{bob.ID()}, saltpack.Anonymous(), saltpack.Armored())
+	require.NoError(t, err)
+	out, sender, err = saltpack.Decrypt(encrypted, true, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+	require.Nil(t, sender)
+
+	// Stream
+	var buf bytes.Buffer
+	stream, err := saltpack.NewEncryptStreamWithOptions(&buf, alice, []keys.ID{bob.ID()}, saltpack.VisibleRecipients(), saltpack.Anonymous())
+	require.NoError(t, err)
+	_, err = stream.Write(message)
+	require.NoError(t, err)
+	err = stream.Close()
+	require.NoError(t, err)
+	dstream, sender, err := saltpack.NewDecryptStream(&buf, false, saltpack.NewKeyringStore(noItemsKeyring{mem}))
+	require.NoError(t, err)
+	require.Nil(t, sender)
+	out, err = ioutil.ReadAll(dstream)
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+}
@@ -0,0 +1,128 @@
+package saltpack
+
+import (
+	"math/big"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/api"
+	"github.com/keys-pub/keys/keyring"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// X25519KeyFinder is an optional interface for a Keyring, to find a key by
+// public key instead of iterating over X25519Keys.
+type X25519KeyFinder interface {
+	// FindX25519Key returns key for X25519 public key, or nil if not found.
+	FindX25519Key(pk *keys.X25519PublicKey) (*keys.X25519Key, error)
+}
+
+// NewKeyringStore creates a Keyring backed by a keyring.Keyring with msgpack
+// api.Key items, stored by key ID (kid).
+// X25519 and EdX25519 keys are supported; other items are ignored.
+//
+// Keys are looked up by ID on demand (X25519KeyFinder), so decrypting a message
+// with visible recipients doesn't require loading all keys. Messages with
+// hidden recipients and signcrypted messages still need to try all keys.
+func NewKeyringStore(kr keyring.Keyring) Keyring {
+	return &keyringStore{kr: kr}
+}
+
+type keyringStore struct {
+	kr keyring.Keyring
+}
+
+func (s *keyringStore) X25519Keys() ([]*keys.X25519Key, error) {
+	items, err := s.kr.Items("")
+	if err != nil {
+		return nil, err
+	}
+	out := []*keys.X25519Key{}
+	for _, item := range items {
+		key, err := decodeKeyringKey(item.Data)
+		if err != nil {
+			logger.Debugf("Skipping keyring item %s: %v", item.ID, err)
+			continue
+		}
+		if bk := x25519Key(key); bk != nil {
+			out = append(out, bk)
+		}
+	}
+	return out, nil
+}
+
+// FindX25519Key looks for the X25519 key ID (kbx), and the EdX25519 key IDs
+// (kex) that convert to the public key.
+func (s *keyringStore) FindX25519Key(pk *keys.X25519PublicKey) (*keys.X25519Key, error) {
+	kids := append([]keys.ID{pk.ID()}, edX25519IDs(pk)...)
+	for _, kid := range kids {
+		b, err := s.kr.Get(kid.String())
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			continue
+		}
+		key, err := decodeKeyringKey(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid keyring item %s", kid)
+		}
+		bk := x25519Key(key)
+		if bk != nil && bk.ID() == pk.ID() {
+			return bk, nil
+		}
+	}
+	return nil, nil
+}
+
+func decodeKeyringKey(b []byte) (keys.Key, error) {
+	var k api.Key
+	if err := msgpack.Unmarshal(b, &k); err != nil {
+		return nil, err
+	}
+	key := k.As()
+	if key == nil {
+		return nil, errors.Errorf("unsupported key")
+	}
+	return key, nil
+}
+
+// p is the field prime 2^255 - 19.
+var p = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// edX25519IDs returns the EdX25519 key IDs whose public key converts to the
+// X25519 public key.
+// The Edwards y coordinate is (u - 1) / (u + 1), and the sign of x is
+// unknown, so there are 2 candidates.
+func edX25519IDs(pk *keys.X25519PublicKey) []keys.ID {
+	u := new(big.Int).SetBytes(reverse(pk.Bytes()))
+	den := new(big.Int).Add(u, big.NewInt(1))
+	den.Mod(den, p)
+	if den.Sign() == 0 {
+		return nil
+	}
+	y := new(big.Int).Sub(u, big.NewInt(1))
+	y.Mul(y, den.ModInverse(den, p))
+	y.Mod(y, p)
+
+	b := make([]byte, 32)
+	yb := y.Bytes()
+	copy(b[32-len(yb):], yb)
+	b = reverse(b)
+
+	ids := make([]keys.ID, 0, 2)
+	for _, sign := range []byte{0x00, 0x80} {
+		eb := keys.Bytes32(b)
+		eb[31] |= sign
+		ids = append(ids, keys.NewEdX25519PublicKey(eb).ID())
+	}
+	return ids
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
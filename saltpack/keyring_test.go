@@ -0,0 +1,75 @@
+package saltpack_test
+
+import (
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/api"
+	"github.com/keys-pub/keys/keyring"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func setKey(t *testing.T, kr keyring.Keyring, key keys.Key) {
+	b, err := msgpack.Marshal(api.NewKey(key))
+	require.NoError(t, err)
+	err = kr.Set(key.ID().String(), b)
+	require.NoError(t, err)
+}
+
+func TestKeyringStore(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewX25519KeyFromSeed(testSeed(0x03))
+
+	mem := keyring.NewMem()
+	setKey(t, mem, bob)
+	setKey(t, mem, charlie)
+	err := mem.Set("other", []byte("not a key"))
+	require.NoError(t, err)
+	kr := saltpack.NewKeyringStore(mem)
+
+	// Signcrypt to bob (EdX25519)
+	encrypted, err := saltpack.Signcrypt([]byte("hi bob"), false, alice, bob.ID())
+	require.NoError(t, err)
+	out, sender, err := saltpack.SigncryptOpen(encrypted, false, kr)
+	require.NoError(t, err)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, alice.ID(), sender.ID())
+
+	// Encrypt to charlie (X25519)
+	encrypted, err = saltpack.Encrypt([]byte("hi charlie"), false, alice.X25519Key(), charlie.ID())
+	require.NoError(t, err)
+	out, _, err = saltpack.Decrypt(encrypted, false, kr)
+	require.NoError(t, err)
+	require.Equal(t, "hi charlie", string(out))
+
+	// Encrypt to someone else
+	encrypted, err = saltpack.Encrypt([]byte("hi"), false, alice.X25519Key(), keys.GenerateX25519Key().ID())
+	require.NoError(t, err)
+	_, _, err = saltpack.Decrypt(encrypted, false, kr)
+	require.EqualError(t, err, "no decryption key found for message")
+
+	// All keys
+	xks, err := kr.X25519Keys()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(xks))
+}
+
+func TestKeyringStoreEdX25519(t *testing.T) {
+	// Both candidate EdX25519 IDs (sign bit) are found.
+	mem := keyring.NewMem()
+	kr := saltpack.NewKeyringStore(mem).(saltpack.X25519KeyFinder)
+	for i := 0; i < 20; i++ {
+		key := keys.GenerateEdX25519Key()
+		setKey(t, mem, key)
+		out, err := kr.FindX25519Key(key.X25519Key().PublicKey())
+		require.NoError(t, err)
+		require.NotNil(t, out)
+		require.Equal(t, key.X25519Key().ID(), out.ID())
+	}
+	out, err := kr.FindX25519Key(keys.GenerateX25519Key().PublicKey())
+	require.NoError(t, err)
+	require.Nil(t, out)
+}
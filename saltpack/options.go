@@ -0,0 +1,79 @@
+package saltpack
+
+import "runtime"
+
+// EncryptOptions for EncryptWithOptions, SigncryptWithOptions and their
+// streams.
+type EncryptOptions struct {
+	// Armored encoding.
+	Armored bool
+	// HideRecipients omits recipient key IDs from the encryption header, so
+	// the message doesn't reveal who it was sent to. Recipients then have to
+	// try all their keys to decrypt.
+	// Signcryption recipients are always hidden, so turning this off is an
+	// error there.
+	HideRecipients bool
+	// Anonymous sender, ignores the sender key.
+	Anonymous bool
+	// Concurrency is the number of workers sealing payload chunks, for
+	// NewParallelEncryptStream and NewParallelSigncryptStream.
+	Concurrency int
+}
+
+// EncryptOption for EncryptOptions.
+type EncryptOption func(*EncryptOptions)
+
+func newEncryptOptions(opts ...EncryptOption) EncryptOptions {
+	options := EncryptOptions{
+		HideRecipients: true,
+		Concurrency:    runtime.NumCPU(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// Armored encoding.
+func Armored() EncryptOption {
+	return func(o *EncryptOptions) {
+		o.Armored = true
+	}
+}
+
+func withArmored(armored bool) EncryptOption {
+	return func(o *EncryptOptions) {
+		o.Armored = armored
+	}
+}
+
+// HideRecipients omits recipient key IDs from the encryption header (the
+// default).
+func HideRecipients() EncryptOption {
+	return func(o *EncryptOptions) {
+		o.HideRecipients = true
+	}
+}
+
+// VisibleRecipients includes recipient key IDs in the encryption header, so
+// recipients can look up their key directly instead of trying all keys.
+func VisibleRecipients() EncryptOption {
+	return func(o *EncryptOptions) {
+		o.HideRecipients = false
+	}
+}
+
+// Anonymous sender, so the message doesn't include a sender key.
+func Anonymous() EncryptOption {
+	return func(o *EncryptOptions) {
+		o.Anonymous = true
+	}
+}
+
+// Concurrency sets the number of workers sealing payload chunks, see
+// NewParallelEncryptStream and NewParallelSigncryptStream.
+func Concurrency(n int) EncryptOption {
+	return func(o *EncryptOptions) {
+		o.Concurrency = n
+	}
+}
@@ -0,0 +1,12 @@
+package saltpack
+
+// TestMessage for testing, shared by the internal and external tests.
+var TestMessage = testMessage
+
+func testMessage(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
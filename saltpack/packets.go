@@ -0,0 +1,684 @@
+package saltpack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+
+	ksaltpack "github.com/keybase/saltpack"
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v4"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Saltpack (version 2) payload packets, sealed and opened outside of ksaltpack
+// so they can be processed in parallel.
+// See https://saltpack.org/encryption-format-v2 and
+// https://saltpack.org/signcryption-format.
+
+// chunkSize is the size of a payload chunk (1MB), the same as ksaltpack.
+const chunkSize = 1048576
+
+const (
+	signcryptSignatureString         = "saltpack encrypted signature\x00"
+	signcryptBoxKeyIdentifierContext = "saltpack signcryption box key identifier"
+	signatureSize                    = 64
+)
+
+type headerHash [sha512.Size]byte
+
+type headerVersion struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	Major    int
+	Minor    int
+}
+
+type headerReceiver struct {
+	_msgpack      struct{} `msgpack:",asArray"`
+	ReceiverKID   []byte
+	PayloadKeyBox []byte
+}
+
+// header for encryption and signcryption, see ksaltpack.EncryptionHeader.
+type header struct {
+	_msgpack        struct{} `msgpack:",asArray"`
+	FormatName      string
+	Version         headerVersion
+	Type            int
+	Ephemeral       []byte
+	SenderSecretbox []byte
+	Receivers       []headerReceiver
+}
+
+func (h *header) validate(typ ksaltpack.MessageType) error {
+	if ksaltpack.MessageType(h.Type) != typ {
+		return ksaltpack.ErrWrongMessageType{Wanted: typ, Received: ksaltpack.MessageType(h.Type)}
+	}
+	// Only version 2 is supported (for parallel streams).
+	if h.Version.Major != 2 {
+		return errors.Errorf("unrecognized version %d.%d", h.Version.Major, h.Version.Minor)
+	}
+	return nil
+}
+
+// decodeHeader reads the (double encoded) header.
+func decodeHeader(dec *msgpack.Decoder) (*header, headerHash, error) {
+	b, err := dec.DecodeBytes()
+	if err != nil {
+		return nil, headerHash{}, ksaltpack.ErrFailedToReadHeaderBytes
+	}
+	var hdr header
+	if err := msgpack.Unmarshal(b, &hdr); err != nil {
+		return nil, headerHash{}, err
+	}
+	return &hdr, sha512.Sum512(b), nil
+}
+
+func nonceForSenderKeySecretBox() *[24]byte {
+	var n [24]byte
+	copy(n[:], "saltpack_sender_key_sbox")
+	return &n
+}
+
+func nonceForDerivedSharedKey() ksaltpack.Nonce {
+	var n ksaltpack.Nonce
+	copy(n[:], "saltpack_derived_sboxkey")
+	return n
+}
+
+func nonceForPayloadKeyBox(i uint64) ksaltpack.Nonce {
+	var n ksaltpack.Nonce
+	copy(n[:16], "saltpack_recipsb")
+	binary.BigEndian.PutUint64(n[16:], i)
+	return n
+}
+
+func nonceForMACKeyBox(hh *headerHash, ephemeral bool, i uint64) ksaltpack.Nonce {
+	var n ksaltpack.Nonce
+	copy(n[:16], hh[:16])
+	n[15] &^= 1
+	if ephemeral {
+		n[15] |= 1
+	}
+	binary.BigEndian.PutUint64(n[16:], i)
+	return n
+}
+
+func nonceForChunkSecretBox(i uint64) *[24]byte {
+	var n [24]byte
+	copy(n[:16], "saltpack_ploadsb")
+	binary.BigEndian.PutUint64(n[16:], i)
+	return &n
+}
+
+func nonceForChunkSigncryption(hh *headerHash, final bool, i uint64) *[24]byte {
+	var n [24]byte
+	copy(n[:16], hh[:16])
+	n[15] &^= 1
+	if final {
+		n[15] |= 1
+	}
+	binary.BigEndian.PutUint64(n[16:], i)
+	return &n
+}
+
+func finalByte(final bool) byte {
+	if final {
+		return 1
+	}
+	return 0
+}
+
+// macKey for a receiver (at index) is derived from the sender and ephemeral
+// keys.
+func macKey(secret ksaltpack.BoxSecretKey, public ksaltpack.BoxPublicKey, eSecret ksaltpack.BoxSecretKey, ePublic ksaltpack.BoxPublicKey, hh *headerHash, index uint64) [32]byte {
+	zero := make([]byte, 32)
+	mac := secret.Box(public, nonceForMACKeyBox(hh, false, index), zero)
+	emac := eSecret.Box(ePublic, nonceForMACKeyBox(hh, true, index), zero)
+	sum := sha512.Sum512(append(mac[16:48], emac[16:48]...))
+	return *keys.Bytes32(sum[:32])
+}
+
+func payloadAuthenticator(key *[32]byte, hh *headerHash, nonce *[24]byte, ciphertext []byte, final bool) []byte {
+	h := sha512.New()
+	_, _ = h.Write(hh[:])
+	_, _ = h.Write(nonce[:])
+	_, _ = h.Write([]byte{finalByte(final)})
+	_, _ = h.Write(ciphertext)
+	mac := hmac.New(sha512.New, key[:])
+	_, _ = mac.Write(h.Sum(nil))
+	return mac.Sum(nil)[:32]
+}
+
+func signcryptSignatureInput(hh *headerHash, nonce *[24]byte, final bool, plaintext []byte) []byte {
+	ph := sha512.Sum512(plaintext)
+	b := make([]byte, 0, len(signcryptSignatureString)+len(hh)+len(nonce)+1+len(ph))
+	b = append(b, signcryptSignatureString...)
+	b = append(b, hh[:]...)
+	b = append(b, nonce[:]...)
+	b = append(b, finalByte(final))
+	return append(b, ph[:]...)
+}
+
+func derivedKey(secret ksaltpack.BoxSecretKey, public ksaltpack.BoxPublicKey) *[32]byte {
+	b := secret.Box(public, nonceForDerivedSharedKey(), make([]byte, 32))
+	return keys.Bytes32(b[len(b)-32:])
+}
+
+func receiverIdentifier(derived *[32]byte, index uint64) []byte {
+	mac := hmac.New(sha512.New, []byte(signcryptBoxKeyIdentifierContext))
+	_, _ = mac.Write(derived[:])
+	nonce := nonceForPayloadKeyBox(index)
+	_, _ = mac.Write(nonce[:])
+	return mac.Sum(nil)[:32]
+}
+
+// ephemeralKeyRecorder creates ephemeral keys (for ksaltpack), remembering
+// the key, so we can derive the payload keys from the header ksaltpack
+// writes.
+type ephemeralKeyRecorder struct {
+	ksaltpack.BoxPublicKey
+	key ksaltpack.BoxSecretKey
+}
+
+func (r *ephemeralKeyRecorder) CreateEphemeralKey() (ksaltpack.BoxSecretKey, error) {
+	r.key = generateBoxKey()
+	return r.key, nil
+}
+
+// startStream creates a (serial) ksaltpack stream, returning the stream, the
+// header it wrote and the buffer the stream writes to.
+func startStream(fn func(w io.Writer) (io.WriteCloser, error)) (io.WriteCloser, []byte, *bytes.Buffer, error) {
+	var buf bytes.Buffer
+	stream, err := fn(&buf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hb := make([]byte, buf.Len())
+	copy(hb, buf.Bytes())
+	buf.Reset()
+	return stream, hb, &buf, nil
+}
+
+func decodeHeaderBytes(b []byte) (*header, headerHash, error) {
+	return decodeHeader(msgpack.NewDecoder(bytes.NewReader(b)))
+}
+
+// encryptSealer seals encrypt payload packets.
+type encryptSealer struct {
+	headerHash headerHash
+	payloadKey *[32]byte
+	macKeys    []*[32]byte
+}
+
+// newEncryptSealer starts a ksaltpack encrypt stream (for the header),
+// returning the sealer for payload packets, the header and the serial stream.
+func newEncryptSealer(sender ksaltpack.BoxSecretKey, recipients []ksaltpack.BoxPublicKey) (*encryptSealer, []byte, io.WriteCloser, *bytes.Buffer, error) {
+	if len(recipients) == 0 {
+		return nil, nil, nil, nil, ksaltpack.ErrBadReceivers
+	}
+	recs := make([]ksaltpack.BoxPublicKey, len(recipients))
+	copy(recs, recipients)
+	recorder := &ephemeralKeyRecorder{BoxPublicKey: recs[0]}
+	recs[0] = recorder
+	stream, hb, buf, err := startStream(func(w io.Writer) (io.WriteCloser, error) {
+		return ksaltpack.NewEncryptStream(ksaltpack.Version2(), w, sender, recs)
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	hdr, hh, err := decodeHeaderBytes(hb)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	ephemeral := recorder.key
+	if sender == nil {
+		sender = ephemeral
+	}
+	shared := make([]ksaltpack.BoxPrecomputedSharedKey, len(recipients))
+	for i, r := range recipients {
+		shared[i] = ephemeral.Precompute(r)
+	}
+
+	s := &encryptSealer{headerHash: hh}
+	for i, r := range hdr.Receivers {
+		// Find the recipient for this (shuffled) receiver.
+		found := false
+		for j, sk := range shared {
+			pk, err := sk.Unbox(nonceForPayloadKeyBox(uint64(i)), r.PayloadKeyBox)
+			if err != nil {
+				continue
+			}
+			if s.payloadKey == nil {
+				s.payloadKey = keys.Bytes32(pk)
+			}
+			mk := macKey(sender, recipients[j], ephemeral, recipients[j], &hh, uint64(i))
+			s.macKeys = append(s.macKeys, &mk)
+			found = true
+			break
+		}
+		if !found {
+			return nil, nil, nil, nil, errors.Errorf("failed to find receiver in header")
+		}
+	}
+	return s, hb, stream, buf, nil
+}
+
+func (s *encryptSealer) seal(c *chunk) {
+	nonce := nonceForChunkSecretBox(c.seq)
+	ciphertext := secretbox.Seal(nil, c.in, nonce, s.payloadKey)
+	var buf bytes.Buffer
+	buf.Grow(len(ciphertext) + 64 + 40*len(s.macKeys))
+	enc := msgpack.NewEncoder(&buf)
+	err := enc.EncodeArrayLen(3)
+	if err == nil {
+		err = enc.EncodeBool(c.final)
+	}
+	if err == nil {
+		err = enc.EncodeArrayLen(len(s.macKeys))
+	}
+	for _, mk := range s.macKeys {
+		if err == nil {
+			err = enc.EncodeBytes(payloadAuthenticator(mk, &s.headerHash, nonce, ciphertext, c.final))
+		}
+	}
+	if err == nil {
+		err = enc.EncodeBytes(ciphertext)
+	}
+	c.out, c.err = buf.Bytes(), err
+}
+
+// signcryptSealer seals signcrypt payload packets.
+type signcryptSealer struct {
+	headerHash headerHash
+	payloadKey *[32]byte
+	sender     ksaltpack.SigningSecretKey
+}
+
+// newSigncryptSealer starts a ksaltpack signcrypt stream (for the header),
+// returning the sealer for payload packets, the header and the serial stream.
+func newSigncryptSealer(sender ksaltpack.SigningSecretKey, recipients []ksaltpack.BoxPublicKey) (*signcryptSealer, []byte, io.WriteCloser, *bytes.Buffer, error) {
+	if len(recipients) == 0 {
+		return nil, nil, nil, nil, ksaltpack.ErrBadReceivers
+	}
+	recorder := &ephemeralKeyRecorder{}
+	stream, hb, buf, err := startStream(func(w io.Writer) (io.WriteCloser, error) {
+		return ksaltpack.NewSigncryptSealStream(w, recorder, sender, recipients, nil)
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	hdr, hh, err := decodeHeaderBytes(hb)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	s := &signcryptSealer{headerHash: hh, sender: sender}
+	derived := derivedKey(recorder.key, recipients[0])
+	for i, r := range hdr.Receivers {
+		pk, ok := secretbox.Open(nil, r.PayloadKeyBox, nonceForPayloadKeyBoxPtr(uint64(i)), derived)
+		if ok {
+			s.payloadKey = keys.Bytes32(pk)
+			break
+		}
+	}
+	if s.payloadKey == nil {
+		return nil, nil, nil, nil, errors.Errorf("failed to find receiver in header")
+	}
+	return s, hb, stream, buf, nil
+}
+
+func nonceForPayloadKeyBoxPtr(i uint64) *[24]byte {
+	n := nonceForPayloadKeyBox(i)
+	return (*[24]byte)(&n)
+}
+
+func (s *signcryptSealer) seal(c *chunk) {
+	nonce := nonceForChunkSigncryption(&s.headerHash, c.final, c.seq)
+	sig := make([]byte, signatureSize)
+	if s.sender != nil {
+		b, err := s.sender.Sign(signcryptSignatureInput(&s.headerHash, nonce, c.final, c.in))
+		if err != nil {
+			c.err = err
+			return
+		}
+		sig = b
+	}
+	ciphertext := secretbox.Seal(nil, append(sig, c.in...), nonce, s.payloadKey)
+	var buf bytes.Buffer
+	buf.Grow(len(ciphertext) + 16)
+	enc := msgpack.NewEncoder(&buf)
+	err := enc.EncodeArrayLen(2)
+	if err == nil {
+		err = enc.EncodeBytes(ciphertext)
+	}
+	if err == nil {
+		err = enc.EncodeBool(c.final)
+	}
+	c.out, c.err = buf.Bytes(), err
+}
+
+// packetReader reads payload packets.
+type packetReader struct {
+	br  *bufio.Reader
+	dec *msgpack.Decoder
+}
+
+func newPacketReader(r io.Reader) *packetReader {
+	br := bufio.NewReader(r)
+	return &packetReader{br: br, dec: msgpack.NewDecoder(br)}
+}
+
+// readBytes reads a msgpack bin, at most max bytes.
+func (r *packetReader) readBytes(max int) ([]byte, error) {
+	n, err := r.dec.DecodeBytesLen()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > max {
+		return nil, ErrInvalidData
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.br, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *packetReader) checkArrayLen(n int) error {
+	l, err := r.dec.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if l != n {
+		return ErrInvalidData
+	}
+	return nil
+}
+
+// assertEOF returns nil at the end of the stream (and no trailing packets).
+func (r *packetReader) assertEOF() error {
+	_, err := r.dec.PeekCode()
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil {
+		return ksaltpack.ErrTrailingGarbage
+	}
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// encryptOpener opens encrypt payload packets.
+type encryptOpener struct {
+	headerHash headerHash
+	payloadKey *[32]byte
+	macKey     [32]byte
+	position   int
+}
+
+// newEncryptOpener reads the header, returning the opener for payload
+// packets and the sender (nil if anonymous).
+func newEncryptOpener(r *packetReader, kr Keyring) (*encryptOpener, *keys.X25519PublicKey, error) {
+	hdr, hh, err := decodeHeader(r.dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := hdr.validate(ksaltpack.MessageTypeEncryption); err != nil {
+		return nil, nil, err
+	}
+	ephemeral := boxPublicKeyFromKID(hdr.Ephemeral)
+	if ephemeral == nil {
+		return nil, nil, ksaltpack.ErrBadEphemeralKey
+	}
+	s := newSaltpack(kr)
+	secret, payloadKey, position, err := openVisibleReceivers(s, hdr, ephemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret == nil {
+		secret, payloadKey, position = openHiddenReceivers(s, hdr, ephemeral)
+	}
+	if secret == nil {
+		return nil, nil, ksaltpack.ErrNoDecryptionKey
+	}
+
+	spk, ok := secretbox.Open(nil, hdr.SenderSecretbox, nonceForSenderKeySecretBox(), payloadKey)
+	if !ok {
+		return nil, nil, ksaltpack.ErrBadSenderKeySecretbox
+	}
+	if len(spk) != 32 {
+		return nil, nil, ksaltpack.ErrBadBoxKey
+	}
+	var sender *keys.X25519PublicKey
+	senderKey := ksaltpack.BoxPublicKey(ephemeral)
+	if subtle.ConstantTimeCompare(spk, hdr.Ephemeral) != 1 {
+		sender = keys.NewX25519PublicKey(keys.Bytes32(spk))
+		senderKey = newBoxPublicKey(sender)
+	}
+	mk := macKeyReceiver(secret, senderKey, ephemeral, &hh, uint64(position))
+	return &encryptOpener{
+		headerHash: hh,
+		payloadKey: payloadKey,
+		macKey:     mk,
+		position:   position,
+	}, sender, nil
+}
+
+func macKeyReceiver(secret ksaltpack.BoxSecretKey, sender ksaltpack.BoxPublicKey, ephemeral ksaltpack.BoxPublicKey, hh *headerHash, index uint64) [32]byte {
+	return macKey(secret, sender, secret, ephemeral, hh, index)
+}
+
+func openVisibleReceivers(s *saltpack, hdr *header, ephemeral ksaltpack.BoxPublicKey) (ksaltpack.BoxSecretKey, *[32]byte, int, error) {
+	kids := [][]byte{}
+	positions := []int{}
+	for i, r := range hdr.Receivers {
+		if len(r.ReceiverKID) != 0 {
+			kids = append(kids, r.ReceiverKID)
+			positions = append(positions, i)
+		}
+	}
+	if len(kids) == 0 {
+		return nil, nil, -1, nil
+	}
+	i, sk := s.LookupBoxSecretKey(kids)
+	if i < 0 || sk == nil {
+		return nil, nil, -1, nil
+	}
+	if i >= len(positions) {
+		return nil, nil, -1, ksaltpack.ErrBadLookup
+	}
+	position := positions[i]
+	pk, err := sk.Unbox(ephemeral, nonceForPayloadKeyBox(uint64(position)), hdr.Receivers[position].PayloadKeyBox)
+	if err != nil {
+		return nil, nil, -1, err
+	}
+	if len(pk) != 32 {
+		return nil, nil, -1, ksaltpack.ErrBadSymmetricKey
+	}
+	return sk, keys.Bytes32(pk), position, nil
+}
+
+func openHiddenReceivers(s *saltpack, hdr *header, ephemeral ksaltpack.BoxPublicKey) (ksaltpack.BoxSecretKey, *[32]byte, int) {
+	for _, sk := range s.GetAllBoxSecretKeys() {
+		shared := sk.Precompute(ephemeral)
+		for i, r := range hdr.Receivers {
+			if len(r.ReceiverKID) != 0 {
+				continue
+			}
+			pk, err := shared.Unbox(nonceForPayloadKeyBox(uint64(i)), r.PayloadKeyBox)
+			if err != nil || len(pk) != 32 {
+				continue
+			}
+			return sk, keys.Bytes32(pk), i
+		}
+	}
+	return nil, nil, -1
+}
+
+// read an encrypt payload packet.
+func (o *encryptOpener) read(r *packetReader, c *chunk) error {
+	if err := r.checkArrayLen(3); err != nil {
+		return err
+	}
+	final, err := r.dec.DecodeBool()
+	if err != nil {
+		return err
+	}
+	n, err := r.dec.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if n <= o.position {
+		return ksaltpack.ErrBadTag(c.seq + 1)
+	}
+	for i := 0; i < n; i++ {
+		auth, err := r.readBytes(32)
+		if err != nil {
+			return err
+		}
+		if i == o.position {
+			c.auth = auth
+		}
+	}
+	ciphertext, err := r.readBytes(chunkSize + secretbox.Overhead)
+	if err != nil {
+		return err
+	}
+	c.in, c.final = ciphertext, final
+	return nil
+}
+
+func (o *encryptOpener) open(c *chunk) {
+	nonce := nonceForChunkSecretBox(c.seq)
+	auth := payloadAuthenticator(&o.macKey, &o.headerHash, nonce, c.in, c.final)
+	if !hmac.Equal(auth, c.auth) {
+		c.err = ksaltpack.ErrBadTag(c.seq + 1)
+		return
+	}
+	out, ok := secretbox.Open(nil, c.in, nonce, o.payloadKey)
+	if !ok {
+		c.err = ksaltpack.ErrBadCiphertext(c.seq + 1)
+		return
+	}
+	if len(out) == 0 && (c.seq != 0 || !c.final) {
+		c.err = ksaltpack.ErrUnexpectedEmptyBlock
+		return
+	}
+	c.out = out
+}
+
+// signcryptOpener opens signcrypt payload packets.
+type signcryptOpener struct {
+	headerHash headerHash
+	payloadKey *[32]byte
+	sender     *keys.EdX25519PublicKey
+}
+
+// newSigncryptOpener reads the header, returning the opener for payload
+// packets and the sender (nil if anonymous).
+func newSigncryptOpener(r *packetReader, kr Keyring) (*signcryptOpener, *keys.EdX25519PublicKey, error) {
+	hdr, hh, err := decodeHeader(r.dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := hdr.validate(ksaltpack.MessageTypeSigncryption); err != nil {
+		return nil, nil, err
+	}
+	ephemeral := boxPublicKeyFromKID(hdr.Ephemeral)
+	if ephemeral == nil {
+		return nil, nil, ksaltpack.ErrBadEphemeralKey
+	}
+	s := newSaltpack(kr)
+	derived := []*[32]byte{}
+	for _, sk := range s.GetAllBoxSecretKeys() {
+		derived = append(derived, derivedKey(sk, ephemeral))
+	}
+	var payloadKey *[32]byte
+	for i, r := range hdr.Receivers {
+		for _, dk := range derived {
+			if !hmac.Equal(receiverIdentifier(dk, uint64(i)), r.ReceiverKID) {
+				continue
+			}
+			pk, ok := secretbox.Open(nil, r.PayloadKeyBox, nonceForPayloadKeyBoxPtr(uint64(i)), dk)
+			if !ok || len(pk) != 32 {
+				return nil, nil, ksaltpack.ErrDecryptionFailed
+			}
+			payloadKey = keys.Bytes32(pk)
+			break
+		}
+		if payloadKey != nil {
+			break
+		}
+	}
+	if payloadKey == nil {
+		return nil, nil, ksaltpack.ErrNoDecryptionKey
+	}
+
+	spk, ok := secretbox.Open(nil, hdr.SenderSecretbox, nonceForSenderKeySecretBox(), payloadKey)
+	if !ok {
+		return nil, nil, ksaltpack.ErrBadSenderKeySecretbox
+	}
+	if len(spk) != 32 {
+		return nil, nil, ksaltpack.ErrBadBoxKey
+	}
+	var sender *keys.EdX25519PublicKey
+	if !bytes.Equal(spk, make([]byte, 32)) {
+		sender = keys.NewEdX25519PublicKey(keys.Bytes32(spk))
+	}
+	return &signcryptOpener{
+		headerHash: hh,
+		payloadKey: payloadKey,
+		sender:     sender,
+	}, sender, nil
+}
+
+// read a signcrypt payload packet.
+func (o *signcryptOpener) read(r *packetReader, c *chunk) error {
+	if err := r.checkArrayLen(2); err != nil {
+		return err
+	}
+	ciphertext, err := r.readBytes(chunkSize + signatureSize + secretbox.Overhead)
+	if err != nil {
+		return err
+	}
+	final, err := r.dec.DecodeBool()
+	if err != nil {
+		return err
+	}
+	c.in, c.final = ciphertext, final
+	return nil
+}
+
+func (o *signcryptOpener) open(c *chunk) {
+	nonce := nonceForChunkSigncryption(&o.headerHash, c.final, c.seq)
+	b, ok := secretbox.Open(nil, c.in, nonce, o.payloadKey)
+	if !ok || len(b) < signatureSize {
+		c.err = ksaltpack.ErrBadCiphertext(c.seq + 1)
+		return
+	}
+	sig, out := b[:signatureSize], b[signatureSize:]
+	// Anonymous senders don't sign.
+	if o.sender != nil {
+		if !ed25519.Verify(o.sender.Bytes(), signcryptSignatureInput(&o.headerHash, nonce, c.final, out), sig) {
+			c.err = ksaltpack.ErrBadSignature
+			return
+		}
+	}
+	if len(out) == 0 && (c.seq != 0 || !c.final) {
+		c.err = ksaltpack.ErrUnexpectedEmptyBlock
+		return
+	}
+	c.out = out
+}
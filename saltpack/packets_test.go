@@ -0,0 +1,76 @@
+package saltpack
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+)
+
+// writeChunks writes in uneven pieces.
+func writeChunks(t *testing.T, w io.Writer, b []byte) {
+	for len(b) > 0 {
+		n := 100003
+		if n > len(b) {
+			n = len(b)
+		}
+		_, err := w.Write(b[:n])
+		require.NoError(t, err)
+		b = b[n:]
+	}
+}
+
+var testSizes = []int{0, 10, chunkSize, chunkSize + 1, 3*chunkSize + 100}
+
+func TestParallelEncryptSameAsSerial(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewX25519KeyFromSeed(testSeed(0x03))
+
+	for _, size := range testSizes {
+		for _, hide := range []bool{true, false} {
+			recs, err := boxPublicKeys([]keys.ID{bob.ID(), charlie.ID()}, hide)
+			require.NoError(t, err)
+			sealer, hdr, serial, serialOut, err := newEncryptSealer(newBoxKey(alice), recs)
+			require.NoError(t, err)
+
+			b := testMessage(size)
+			writeChunks(t, serial, b)
+			require.NoError(t, serial.Close())
+
+			var out bytes.Buffer
+			w, err := newParallelWriter(&out, hdr, false, 4, sealer.seal)
+			require.NoError(t, err)
+			writeChunks(t, w, b)
+			require.NoError(t, w.Close())
+
+			require.Equal(t, append(hdr, serialOut.Bytes()...), out.Bytes())
+		}
+	}
+}
+
+func TestParallelSigncryptSameAsSerial(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+
+	for _, size := range testSizes {
+		recs, err := boxPublicKeys([]keys.ID{bob.ID()}, true)
+		require.NoError(t, err)
+		sealer, hdr, serial, serialOut, err := newSigncryptSealer(newSignKey(alice), recs)
+		require.NoError(t, err)
+
+		b := testMessage(size)
+		writeChunks(t, serial, b)
+		require.NoError(t, serial.Close())
+
+		var out bytes.Buffer
+		w, err := newParallelWriter(&out, hdr, false, 4, sealer.seal)
+		require.NoError(t, err)
+		writeChunks(t, w, b)
+		require.NoError(t, w.Close())
+
+		require.Equal(t, append(hdr, serialOut.Bytes()...), out.Bytes())
+	}
+}
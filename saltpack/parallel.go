@@ -0,0 +1,384 @@
+package saltpack
+
+import (
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	ksaltpack "github.com/keybase/saltpack"
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// DecryptOptions for NewParallelDecryptStream and
+// NewParallelSigncryptOpenStream.
+type DecryptOptions struct {
+	// Concurrency is the number of workers opening payload packets.
+	Concurrency int
+}
+
+// DecryptOption for DecryptOptions.
+type DecryptOption func(*DecryptOptions)
+
+func newDecryptOptions(opts ...DecryptOption) DecryptOptions {
+	options := DecryptOptions{
+		Concurrency: runtime.NumCPU(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// DecryptConcurrency sets the number of workers opening payload packets.
+func DecryptConcurrency(n int) DecryptOption {
+	return func(o *DecryptOptions) {
+		o.Concurrency = n
+	}
+}
+
+// chunk is a payload chunk (and packet) processed by a worker.
+type chunk struct {
+	seq   uint64
+	in    []byte
+	auth  []byte
+	final bool
+	out   []byte
+	err   error
+	done  chan struct{}
+}
+
+// pipeline processes chunks on a pool of workers, returning the results in
+// order.
+// At most 2*concurrency chunks are queued, so memory use is bounded.
+type pipeline struct {
+	jobs    chan *chunk
+	ordered chan *chunk
+	stop    chan struct{}
+}
+
+func newPipeline(concurrency int, fn func(c *chunk)) *pipeline {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p := &pipeline{
+		jobs:    make(chan *chunk),
+		ordered: make(chan *chunk, concurrency*2),
+		stop:    make(chan struct{}),
+	}
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for c := range p.jobs {
+				fn(c)
+				close(c.done)
+			}
+		}()
+	}
+	return p
+}
+
+// submit a chunk for processing, returns false if the pipeline was stopped.
+func (p *pipeline) submit(c *chunk) bool {
+	c.done = make(chan struct{})
+	select {
+	case p.ordered <- c:
+	case <-p.stop:
+		return false
+	}
+	select {
+	case p.jobs <- c:
+	case <-p.stop:
+		// Queued, but never processed.
+		c.err = errors.Errorf("stream closed")
+		close(c.done)
+		return false
+	}
+	return true
+}
+
+// fail queues an error (without processing).
+func (p *pipeline) fail(seq uint64, err error) {
+	c := &chunk{seq: seq, err: err, done: make(chan struct{})}
+	close(c.done)
+	select {
+	case p.ordered <- c:
+	case <-p.stop:
+	}
+}
+
+// finish after the last submit.
+func (p *pipeline) finish() {
+	close(p.jobs)
+	close(p.ordered)
+}
+
+// parallelWriter seals payload chunks in parallel, writing the packets in
+// order.
+type parallelWriter struct {
+	w      io.Writer
+	closer io.Closer
+	p      *pipeline
+	buf    []byte
+	seq    uint64
+	done   chan struct{}
+	err    error
+	closed bool
+
+	mtx  sync.Mutex
+	werr error
+}
+
+func newParallelWriter(w io.Writer, hdr []byte, armored bool, concurrency int, seal func(c *chunk)) (*parallelWriter, error) {
+	var closer io.Closer
+	if armored {
+		// Signcryption has the same armor frame as encryption.
+		enc, err := ksaltpack.NewArmor62EncoderStream(w, ksaltpack.MessageTypeEncryption, "")
+		if err != nil {
+			return nil, err
+		}
+		w, closer = enc, enc
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	pw := &parallelWriter{
+		w:      w,
+		closer: closer,
+		p:      newPipeline(concurrency, seal),
+		buf:    make([]byte, 0, chunkSize),
+		done:   make(chan struct{}),
+	}
+	go pw.writeLoop()
+	return pw, nil
+}
+
+func (w *parallelWriter) writeLoop() {
+	defer close(w.done)
+	for c := range w.p.ordered {
+		<-c.done
+		if w.writeErr() != nil {
+			continue
+		}
+		err := c.err
+		if err == nil {
+			_, err = w.w.Write(c.out)
+		}
+		if err != nil {
+			w.mtx.Lock()
+			w.werr = err
+			w.mtx.Unlock()
+		}
+	}
+}
+
+func (w *parallelWriter) writeErr() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.werr
+}
+
+func (w *parallelWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, errors.Errorf("stream closed")
+	}
+	if w.err == nil {
+		w.err = w.writeErr()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(b)
+	for len(b) > 0 {
+		// A full chunk is only sealed when there is more data, since the last
+		// chunk is marked final (and may be full).
+		if len(w.buf) == chunkSize {
+			w.p.submit(&chunk{seq: w.seq, in: w.buf})
+			w.seq++
+			w.buf = make([]byte, 0, chunkSize)
+		}
+		k := chunkSize - len(w.buf)
+		if k > len(b) {
+			k = len(b)
+		}
+		w.buf = append(w.buf, b[:k]...)
+		b = b[k:]
+	}
+	return n, nil
+}
+
+func (w *parallelWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.p.submit(&chunk{seq: w.seq, in: w.buf, final: true})
+	w.buf = nil
+	w.p.finish()
+	<-w.done
+	if err := w.writeErr(); err != nil {
+		return err
+	}
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+// parallelReader opens payload packets in parallel, returning the plaintext
+// in order.
+type parallelReader struct {
+	p    *pipeline
+	cur  []byte
+	err  error
+	once sync.Once
+}
+
+func newParallelReader(r *packetReader, concurrency int, read func(r *packetReader, c *chunk) error, open func(c *chunk)) *parallelReader {
+	pr := &parallelReader{p: newPipeline(concurrency, open)}
+	go pr.readLoop(r, read)
+	return pr
+}
+
+func (r *parallelReader) readLoop(pr *packetReader, read func(r *packetReader, c *chunk) error) {
+	defer r.p.finish()
+	for seq := uint64(0); ; seq++ {
+		c := &chunk{seq: seq}
+		if err := read(pr, c); err != nil {
+			r.p.fail(seq, unexpectedEOF(err))
+			return
+		}
+		if !r.p.submit(c) {
+			return
+		}
+		if c.final {
+			if err := pr.assertEOF(); err != nil {
+				r.p.fail(seq+1, err)
+			}
+			return
+		}
+	}
+}
+
+func (r *parallelReader) Read(b []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		c, ok := <-r.p.ordered
+		if !ok {
+			r.err = io.EOF
+			continue
+		}
+		<-c.done
+		if c.err != nil {
+			r.err = c.err
+			_ = r.Close()
+			continue
+		}
+		r.cur = c.out
+	}
+	n := copy(b, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close stops reading (and the workers).
+func (r *parallelReader) Close() error {
+	r.cur = nil
+	r.once.Do(func() {
+		close(r.p.stop)
+		if r.err == nil {
+			r.err = errors.Errorf("stream closed")
+		}
+	})
+	return nil
+}
+
+// NewParallelEncryptStream creates an encrypt stream that seals payload
+// chunks on a pool of workers (see EncryptOptions.Concurrency).
+// The output is the same as NewEncryptStreamWithOptions.
+// Memory use is bounded by the number of workers (about 4MB per worker).
+// Close must be called to write the final chunk and stop the workers.
+func NewParallelEncryptStream(w io.Writer, sender *keys.X25519Key, recipients []keys.ID, opt ...EncryptOption) (io.WriteCloser, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := boxPublicKeys(recipients, opts.HideRecipients)
+	if err != nil {
+		return nil, err
+	}
+	sealer, hdr, _, _, err := newEncryptSealer(boxSenderKey(sender, opts), recs)
+	if err != nil {
+		return nil, err
+	}
+	return newParallelWriter(w, hdr, opts.Armored, opts.Concurrency, sealer.seal)
+}
+
+// NewParallelSigncryptStream creates a signcrypt stream that signs and seals
+// payload chunks on a pool of workers (see EncryptOptions.Concurrency).
+// The output is the same as NewSigncryptStreamWithOptions.
+// Memory use is bounded by the number of workers (about 4MB per worker).
+// Close must be called to write the final chunk and stop the workers.
+func NewParallelSigncryptStream(w io.Writer, sender *keys.EdX25519Key, recipients []keys.ID, opt ...EncryptOption) (io.WriteCloser, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := signcryptBoxPublicKeys(recipients, opts)
+	if err != nil {
+		return nil, err
+	}
+	sealer, hdr, _, _, err := newSigncryptSealer(signSenderKey(sender, opts), recs)
+	if err != nil {
+		return nil, err
+	}
+	return newParallelWriter(w, hdr, opts.Armored, opts.Concurrency, sealer.seal)
+}
+
+// NewParallelDecryptStream creates a decrypt stream that opens payload
+// packets on a pool of workers (see DecryptOptions.Concurrency).
+// Only version 2 messages are supported.
+// If there was a sender, will return the X25519 public key.
+// Close the reader if you stop reading before the end of the stream.
+func NewParallelDecryptStream(r io.Reader, armored bool, kr Keyring, opt ...DecryptOption) (io.ReadCloser, *keys.X25519PublicKey, error) {
+	opts := newDecryptOptions(opt...)
+	r, err := dearmorStream(r, armored)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr := newPacketReader(r)
+	opener, sender, err := newEncryptOpener(pr, kr)
+	if err != nil {
+		return nil, nil, convertBoxKeyErr(err)
+	}
+	return newParallelReader(pr, opts.Concurrency, opener.read, opener.open), sender, nil
+}
+
+// NewParallelSigncryptOpenStream creates a signcrypt open stream that opens
+// and verifies payload packets on a pool of workers (see
+// DecryptOptions.Concurrency).
+// Close the reader if you stop reading before the end of the stream.
+func NewParallelSigncryptOpenStream(r io.Reader, armored bool, kr Keyring, opt ...DecryptOption) (io.ReadCloser, *keys.EdX25519PublicKey, error) {
+	opts := newDecryptOptions(opt...)
+	r, err := dearmorStream(r, armored)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr := newPacketReader(r)
+	opener, sender, err := newSigncryptOpener(pr, kr)
+	if err != nil {
+		return nil, nil, convertSignKeyErr(err)
+	}
+	return newParallelReader(pr, opts.Concurrency, opener.read, opener.open), sender, nil
+}
+
+func dearmorStream(r io.Reader, armored bool) (io.Reader, error) {
+	if !armored {
+		return r, nil
+	}
+	// Encryption and signcryption use the same armor frame.
+	headerChecker := func(hdr string) (string, error) {
+		return ksaltpack.CheckArmor62(hdr, strings.Replace(hdr, "BEGIN", "END", 1), ksaltpack.MessageTypeEncryption)
+	}
+	frameChecker := func(hdr string, ftr string) (string, error) {
+		return ksaltpack.CheckArmor62(hdr, ftr, ksaltpack.MessageTypeEncryption)
+	}
+	dr, _, err := ksaltpack.NewArmor62DecoderStream(r, headerChecker, frameChecker)
+	return dr, err
+}
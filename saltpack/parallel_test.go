@@ -0,0 +1,293 @@
+package saltpack_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelEncrypt(t *testing.T) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	message := saltpack.TestMessage(3*1024*1024 + 100)
+
+	for _, armored := range []bool{false, true} {
+		for _, opts := range [][]saltpack.EncryptOption{
+			{},
+			{saltpack.VisibleRecipients()},
+			{saltpack.Anonymous()},
+		} {
+			opts = append(opts, saltpack.Concurrency(3))
+			if armored {
+				opts = append(opts, saltpack.Armored())
+			}
+
+			// Parallel encrypt, serial decrypt
+			var buf bytes.Buffer
+			w, err := saltpack.NewParallelEncryptStream(&buf, alice, []keys.ID{bob.ID()}, opts...)
+			require.NoError(t, err)
+			_, err = w.Write(message)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			out, _, err := saltpack.Decrypt(buf.Bytes(), armored, saltpack.NewKeyring(bob))
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+
+			// Parallel decrypt
+			r, sender, err := saltpack.NewParallelDecryptStream(bytes.NewReader(buf.Bytes()), armored, saltpack.NewKeyring(bob), saltpack.DecryptConcurrency(3))
+			require.NoError(t, err)
+			out, err = ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+			if sender != nil {
+				require.Equal(t, alice.ID(), sender.ID())
+			}
+
+			// Serial encrypt, parallel decrypt
+			encrypted, err := saltpack.EncryptWithOptions(message, alice, []keys.ID{bob.ID()}, opts...)
+			require.NoError(t, err)
+			r, _, err = saltpack.NewParallelDecryptStream(bytes.NewReader(encrypted), armored, saltpack.NewKeyring(bob))
+			require.NoError(t, err)
+			out, err = ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+		}
+	}
+
+	// Anonymous
+	var buf bytes.Buffer
+	w, err := saltpack.NewParallelEncryptStream(&buf, alice, []keys.ID{bob.ID()}, saltpack.Anonymous())
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	r, sender, err := saltpack.NewParallelDecryptStream(bytes.NewReader(buf.Bytes()), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Nil(t, sender)
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(out))
+}
+
+func TestParallelSigncrypt(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	message := saltpack.TestMessage(2*1024*1024 + 1)
+
+	for _, armored := range []bool{false, true} {
+		for _, opts := range [][]saltpack.EncryptOption{
+			{},
+			{saltpack.Anonymous()},
+		} {
+			opts = append(opts, saltpack.Concurrency(3))
+			if armored {
+				opts = append(opts, saltpack.Armored())
+			}
+
+			// Parallel signcrypt, serial open
+			var buf bytes.Buffer
+			w, err := saltpack.NewParallelSigncryptStream(&buf, alice, []keys.ID{bob.ID()}, opts...)
+			require.NoError(t, err)
+			_, err = w.Write(message)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			out, _, err := saltpack.SigncryptOpen(buf.Bytes(), armored, saltpack.NewKeyring(bob))
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+
+			// Parallel open
+			r, sender, err := saltpack.NewParallelSigncryptOpenStream(bytes.NewReader(buf.Bytes()), armored, saltpack.NewKeyring(bob))
+			require.NoError(t, err)
+			out, err = ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+			if sender != nil {
+				require.Equal(t, alice.ID(), sender.ID())
+			}
+
+			// Serial signcrypt, parallel open
+			encrypted, err := saltpack.SigncryptWithOptions(message, alice, []keys.ID{bob.ID()}, opts...)
+			require.NoError(t, err)
+			r, _, err = saltpack.NewParallelSigncryptOpenStream(bytes.NewReader(encrypted), armored, saltpack.NewKeyring(bob))
+			require.NoError(t, err)
+			out, err = ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, message, out)
+		}
+	}
+}
+
+func TestParallelDecryptErrors(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	message := saltpack.TestMessage(2*1024*1024 + 1)
+
+	encrypted, err := saltpack.Encrypt(message, false, alice.X25519Key(), bob.ID())
+	require.NoError(t, err)
+
+	// Not a recipient
+	_, _, err = saltpack.NewParallelDecryptStream(bytes.NewReader(encrypted), false, saltpack.NewKeyring(alice))
+	require.EqualError(t, err, "no decryption key found for message")
+
+	// Not signcrypted
+	_, _, err = saltpack.NewParallelSigncryptOpenStream(bytes.NewReader(encrypted), false, saltpack.NewKeyring(bob))
+	require.EqualError(t, err, "Wrong saltpack message type: wanted a signed and encrypted message, but got an encrypted message instead")
+
+	// Truncated
+	r, _, err := saltpack.NewParallelDecryptStream(bytes.NewReader(encrypted[:len(encrypted)-10]), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "unexpected EOF")
+
+	// Trailing garbage
+	r, _, err = saltpack.NewParallelDecryptStream(bytes.NewReader(append(encrypted, 0x01)), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "trailing garbage found at end of message")
+
+	// Modified ciphertext
+	modified := append([]byte{}, encrypted...)
+	modified[len(modified)-100] ^= 0x01
+	r, _, err = saltpack.NewParallelDecryptStream(bytes.NewReader(modified), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "In packet 2: bad Poly1305 tag; data was corrupted in transit")
+
+	// Modified signcrypt
+	signcrypted, err := saltpack.Signcrypt(message, false, alice, bob.ID())
+	require.NoError(t, err)
+	signcrypted[len(signcrypted)-100] ^= 0x01
+	r, _, err = saltpack.NewParallelSigncryptOpenStream(bytes.NewReader(signcrypted), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "In packet 2: bad ciphertext; failed Poly1305")
+
+	// Close before the end
+	r, _, err = saltpack.NewParallelDecryptStream(bytes.NewReader(encrypted), false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	b := make([]byte, 10)
+	_, err = r.Read(b)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	_, err = r.Read(b)
+	require.EqualError(t, err, "stream closed")
+}
+
+const benchmarkSize = 16 * 1024 * 1024
+
+func benchmarkEncrypt(b *testing.B, parallel bool) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	message := saltpack.TestMessage(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var w interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+		var err error
+		if parallel {
+			w, err = saltpack.NewParallelEncryptStream(ioutil.Discard, alice, []keys.ID{bob.ID()})
+		} else {
+			w, err = saltpack.NewEncryptStreamWithOptions(ioutil.Discard, alice, []keys.ID{bob.ID()})
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(message); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptStream(b *testing.B) {
+	benchmarkEncrypt(b, false)
+}
+
+func BenchmarkParallelEncryptStream(b *testing.B) {
+	benchmarkEncrypt(b, true)
+}
+
+func benchmarkSigncrypt(b *testing.B, parallel bool) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	message := saltpack.TestMessage(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var w interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+		var err error
+		if parallel {
+			w, err = saltpack.NewParallelSigncryptStream(ioutil.Discard, alice, []keys.ID{bob.ID()})
+		} else {
+			w, err = saltpack.NewSigncryptStreamWithOptions(ioutil.Discard, alice, []keys.ID{bob.ID()})
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(message); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSigncryptStream(b *testing.B) {
+	benchmarkSigncrypt(b, false)
+}
+
+func BenchmarkParallelSigncryptStream(b *testing.B) {
+	benchmarkSigncrypt(b, true)
+}
+
+func benchmarkDecrypt(b *testing.B, parallel bool) {
+	alice := keys.NewX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewX25519KeyFromSeed(testSeed(0x02))
+	kr := saltpack.NewKeyring(bob)
+	encrypted, err := saltpack.Encrypt(saltpack.TestMessage(benchmarkSize), false, alice, bob.ID())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if parallel {
+			r, _, err := saltpack.NewParallelDecryptStream(bytes.NewReader(encrypted), false, kr)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := ioutil.ReadAll(r); err != nil {
+				b.Fatal(err)
+			}
+		} else {
+			r, _, err := saltpack.NewDecryptStream(bytes.NewReader(encrypted), false, kr)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := ioutil.ReadAll(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecryptStream(b *testing.B) {
+	benchmarkDecrypt(b, false)
+}
+
+func BenchmarkParallelDecryptStream(b *testing.B) {
+	benchmarkDecrypt(b, true)
+}
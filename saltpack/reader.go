@@ -0,0 +1,103 @@
+package saltpack
+
+import (
+	"bufio"
+	"io"
+
+	ksaltpack "github.com/keybase/saltpack"
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// ReadResult describes a message read by NewAutoReader.
+type ReadResult struct {
+	// Encoding is the message type (encrypt, signcrypt or sign).
+	Encoding Encoding
+	// Armored if the message was armored.
+	Armored bool
+	// Brand from the armor header (for example "KEYBASE"), if any.
+	Brand string
+	// Sender is the sender (encrypt, signcrypt) or signer (sign) key.
+	// For encrypt this is a X25519 public key, for signcrypt and sign an
+	// EdX25519 public key.
+	// If the sender is anonymous, this is nil.
+	Sender keys.Key
+}
+
+// NewAutoReader peeks at the start of the stream to detect the message type
+// and encoding, and returns a reader for the plaintext.
+// It supports encrypted, signcrypted and (attached) signed messages, binary or
+// armored (the armored form of a signed message is the saltpack equivalent of
+// a clearsigned message).
+// Detached signatures are not supported, use VerifyDetachedReader.
+//
+// For signed and signcrypted messages, the signature of each block is
+// verified as it is read, so a reader error should be treated as a failure to
+// verify.
+func NewAutoReader(r io.Reader, kr Keyring) (io.Reader, *ReadResult, error) {
+	buf := bufio.NewReader(r)
+	armored, brand, typ, _, err := ksaltpack.ClassifyStream(buf)
+	if err != nil {
+		if err == ksaltpack.ErrShortSliceOrBuffer || err == ksaltpack.ErrNotASaltpackMessage || err == io.EOF {
+			return nil, nil, errors.Errorf("invalid data")
+		}
+		return nil, nil, err
+	}
+
+	res := &ReadResult{
+		Armored: armored,
+		Brand:   brand,
+	}
+	var out io.Reader
+	switch typ {
+	case ksaltpack.MessageTypeEncryption:
+		res.Encoding = EncryptEncoding
+		var sender *keys.X25519PublicKey
+		out, sender, err = NewDecryptStream(buf, armored, kr)
+		if sender != nil {
+			res.Sender = sender
+		}
+	case ksaltpack.MessageTypeSigncryption:
+		res.Encoding = SigncryptEncoding
+		var sender *keys.EdX25519PublicKey
+		out, sender, err = NewSigncryptOpenStream(buf, armored, kr)
+		if sender != nil {
+			res.Sender = sender
+		}
+	case ksaltpack.MessageTypeAttachedSignature:
+		res.Encoding = SignEncoding
+		var signer keys.ID
+		out, signer, err = newVerifyStream(buf, armored)
+		if err == nil {
+			res.Sender, err = keys.NewEdX25519PublicKeyFromID(signer)
+		}
+	case ksaltpack.MessageTypeDetachedSignature:
+		return nil, nil, errors.Errorf("detached signature has no message, use VerifyDetachedReader")
+	default:
+		return nil, nil, errors.Errorf("invalid data")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, res, nil
+}
+
+func newVerifyStream(r io.Reader, armored bool) (io.Reader, keys.ID, error) {
+	s := &saltpack{}
+	var spk ksaltpack.SigningPublicKey
+	var reader io.Reader
+	var err error
+	if armored {
+		spk, reader, _, err = ksaltpack.NewDearmor62VerifyStream(signVersionValidator, r, s)
+	} else {
+		spk, reader, err = ksaltpack.NewVerifyStream(signVersionValidator, r, s)
+	}
+	if err != nil {
+		return nil, "", convertSignKeyErr(err)
+	}
+	signer, err := edX25519KeyID(spk.ToKID())
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to verify")
+	}
+	return reader, signer, nil
+}
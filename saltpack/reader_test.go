@@ -0,0 +1,98 @@
+package saltpack_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	ksaltpack "github.com/keybase/saltpack"
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAutoReader(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	kr := saltpack.NewKeyring(bob)
+	message := saltpack.TestMessage(1024)
+
+	for _, armored := range []bool{false, true} {
+		// Encrypt
+		encrypted, err := saltpack.Encrypt(message, armored, alice.X25519Key(), bob.ID())
+		require.NoError(t, err)
+		r, res, err := saltpack.NewAutoReader(bytes.NewReader(encrypted), kr)
+		require.NoError(t, err)
+		out, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+		require.Equal(t, saltpack.EncryptEncoding, res.Encoding)
+		require.Equal(t, armored, res.Armored)
+		require.Equal(t, alice.X25519Key().ID(), res.Sender.ID())
+
+		// Encrypt (anonymous)
+		encrypted, err = saltpack.EncryptWithOptions(message, alice.X25519Key(), []keys.ID{bob.ID()}, saltpack.Anonymous())
+		require.NoError(t, err)
+		r, res, err = saltpack.NewAutoReader(bytes.NewReader(encrypted), kr)
+		require.NoError(t, err)
+		out, err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+		require.Nil(t, res.Sender)
+
+		// Signcrypt
+		signcrypted, err := saltpack.Signcrypt(message, armored, alice, bob.ID())
+		require.NoError(t, err)
+		r, res, err = saltpack.NewAutoReader(bytes.NewReader(signcrypted), kr)
+		require.NoError(t, err)
+		out, err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+		require.Equal(t, saltpack.SigncryptEncoding, res.Encoding)
+		require.Equal(t, armored, res.Armored)
+		require.Equal(t, alice.ID(), res.Sender.ID())
+
+		// Sign
+		sig, err := saltpack.Sign(message, armored, alice)
+		require.NoError(t, err)
+		r, res, err = saltpack.NewAutoReader(bytes.NewReader(sig), nil)
+		require.NoError(t, err)
+		out, err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+		require.Equal(t, saltpack.SignEncoding, res.Encoding)
+		require.Equal(t, armored, res.Armored)
+		require.Equal(t, alice.ID(), res.Sender.ID())
+
+		// Sign (detached)
+		sig, err = saltpack.SignDetached(message, armored, alice)
+		require.NoError(t, err)
+		_, _, err = saltpack.NewAutoReader(bytes.NewReader(sig), nil)
+		require.EqualError(t, err, "detached signature has no message, use VerifyDetachedReader")
+	}
+
+	// Brand
+	encrypted, err := saltpack.Encrypt(message, false, alice.X25519Key(), bob.ID())
+	require.NoError(t, err)
+	branded, err := ksaltpack.Armor62Seal(encrypted, ksaltpack.MessageTypeEncryption, "TEST")
+	require.NoError(t, err)
+	r, res, err := saltpack.NewAutoReader(bytes.NewReader([]byte(branded)), kr)
+	require.NoError(t, err)
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+	require.True(t, res.Armored)
+	require.Equal(t, "TEST", res.Brand)
+
+	// Not a recipient
+	encrypted, err = saltpack.Encrypt(message, true, alice.X25519Key(), bob.ID())
+	require.NoError(t, err)
+	_, _, err = saltpack.NewAutoReader(bytes.NewReader(encrypted), saltpack.NewKeyring(alice))
+	require.EqualError(t, err, "no decryption key found for message")
+
+	// Invalid
+	_, _, err = saltpack.NewAutoReader(bytes.NewReader([]byte("???")), kr)
+	require.EqualError(t, err, "invalid data")
+	_, _, err = saltpack.NewAutoReader(bytes.NewReader([]byte{}), kr)
+	require.EqualError(t, err, "invalid data")
+}
@@ -79,6 +79,9 @@ func (s *saltpack) LookupBoxSecretKey(kids [][]byte) (int, ksaltpack.BoxSecretKe
 	if s.kr == nil {
 		return -1, nil
 	}
+	if finder, ok := s.kr.(X25519KeyFinder); ok {
+		return findBoxSecretKey(finder, kids)
+	}
 	keys, err := s.kr.X25519Keys()
 	if err != nil {
 		logger.Warningf("Failed to get x25519 keys: %v", err)
@@ -94,6 +97,23 @@ func (s *saltpack) LookupBoxSecretKey(kids [][]byte) (int, ksaltpack.BoxSecretKe
 	return -1, nil
 }
 
+func findBoxSecretKey(finder X25519KeyFinder, kids [][]byte) (int, ksaltpack.BoxSecretKey) {
+	for i, kid := range kids {
+		if len(kid) != 32 {
+			continue
+		}
+		key, err := finder.FindX25519Key(keys.NewX25519PublicKey(keys.Bytes32(kid)))
+		if err != nil {
+			logger.Warningf("Failed to find x25519 key: %v", err)
+			return -1, nil
+		}
+		if key != nil {
+			return i, newBoxKey(key)
+		}
+	}
+	return -1, nil
+}
+
 // LookupBoxPublicKey returns a public key given the specified key ID.
 // For most cases, the key ID will be the key itself.
 func (s *saltpack) LookupBoxPublicKey(kid []byte) ksaltpack.BoxPublicKey {
@@ -115,8 +135,16 @@ func (s *saltpack) GetAllBoxSecretKeys() []ksaltpack.BoxSecretKey {
 		logger.Warningf("Failed to get x25519 keys: %v", err)
 		return []ksaltpack.BoxSecretKey{}
 	}
+	// Skip duplicates (for example, an EdX25519 key and its X25519 key), since
+	// each candidate key is tried against each hidden recipient.
+	seen := make(map[[32]byte]bool, len(keys))
 	boxSecretKeys := make([]ksaltpack.BoxSecretKey, 0, len(keys))
 	for _, k := range keys {
+		pk := *k.PublicKey().Bytes32()
+		if seen[pk] {
+			continue
+		}
+		seen[pk] = true
 		boxSecretKeys = append(boxSecretKeys, newBoxKey(k))
 	}
 	return boxSecretKeys
@@ -147,7 +175,7 @@ func containsBoxPublicKey(pk ksaltpack.BoxPublicKey, pks []ksaltpack.BoxPublicKe
 	return false
 }
 
-func boxPublicKeys(recipients []keys.ID) ([]ksaltpack.BoxPublicKey, error) {
+func boxPublicKeys(recipients []keys.ID, hide bool) ([]ksaltpack.BoxPublicKey, error) {
 	publicKeys := make([]ksaltpack.BoxPublicKey, 0, len(recipients))
 	for _, r := range recipients {
 		pk, err := keys.NewX25519PublicKeyFromID(r)
@@ -158,6 +186,7 @@ func boxPublicKeys(recipients []keys.ID) ([]ksaltpack.BoxPublicKey, error) {
 			return nil, errors.Wrapf(err, "recipient not found %s", r)
 		}
 		bpk := newBoxPublicKey(pk)
+		bpk.hide = hide
 		if !containsBoxPublicKey(bpk, publicKeys) {
 			publicKeys = append(publicKeys, bpk)
 		}
@@ -127,7 +127,6 @@ func NewSignStream(w io.Writer, armored bool, detached bool, key *keys.EdX25519K
 
 // NewVerifyStream ...
 func NewVerifyStream(r io.Reader) (io.Reader, keys.ID, error) {
-	s := &saltpack{}
 	buf := bufio.NewReader(r)
 	peek, err := buf.Peek(512)
 	if err != nil {
@@ -135,27 +134,13 @@ func NewVerifyStream(r io.Reader) (io.Reader, keys.ID, error) {
 			return nil, "", err
 		}
 	}
-	var spk ksaltpack.SigningPublicKey
-	var reader io.Reader
 	enc, armored := detectSign(peek)
 	switch enc {
 	case SignEncoding:
-		if armored {
-			spk, reader, _, err = ksaltpack.NewDearmor62VerifyStream(signVersionValidator, buf, s)
-		} else {
-			spk, reader, err = ksaltpack.NewVerifyStream(signVersionValidator, buf, s)
-		}
+		return newVerifyStream(buf, armored)
 	default:
-		err = errors.Errorf("invalid data")
-	}
-	if err != nil {
-		return nil, "", convertSignKeyErr(err)
-	}
-	signer, err := edX25519KeyID(spk.ToKID())
-	if err != nil {
-		return nil, "", errors.Wrapf(err, "failed to verify")
+		return nil, "", errors.Errorf("invalid data")
 	}
-	return reader, signer, nil
 }
 
 // VerifyDetachedReader ...
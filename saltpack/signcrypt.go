@@ -12,15 +12,21 @@ import (
 // Signcrypt to recipients.
 // https://saltpack.org/signcryption-format
 func Signcrypt(b []byte, armored bool, sender *keys.EdX25519Key, recipients ...keys.ID) ([]byte, error) {
-	recs, err := boxPublicKeys(recipients)
+	return SigncryptWithOptions(b, sender, recipients, withArmored(armored))
+}
+
+// SigncryptWithOptions signcrypts to recipients with options, for example to
+// make the sender anonymous.
+// Signcryption recipients are always hidden, VisibleRecipients is an error.
+// Sender can be nil.
+func SigncryptWithOptions(b []byte, sender *keys.EdX25519Key, recipients []keys.ID, opt ...EncryptOption) ([]byte, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := signcryptBoxPublicKeys(recipients, opts)
 	if err != nil {
 		return nil, err
 	}
-	var sk ksaltpack.SigningSecretKey
-	if sender != nil {
-		sk = newSignKey(sender)
-	}
-	if armored {
+	sk := signSenderKey(sender, opts)
+	if opts.Armored {
 		s, err := ksaltpack.SigncryptArmor62Seal(b, ephemeralKeyCreator{}, sk, recs, nil, "")
 		if err != nil {
 			return nil, err
@@ -30,6 +36,20 @@ func Signcrypt(b []byte, armored bool, sender *keys.EdX25519Key, recipients ...k
 	return ksaltpack.SigncryptSeal(b, ephemeralKeyCreator{}, sk, recs, nil)
 }
 
+func signcryptBoxPublicKeys(recipients []keys.ID, opts EncryptOptions) ([]ksaltpack.BoxPublicKey, error) {
+	if !opts.HideRecipients {
+		return nil, errors.Errorf("signcrypt recipients can't be visible")
+	}
+	return boxPublicKeys(recipients, true)
+}
+
+func signSenderKey(sender *keys.EdX25519Key, opts EncryptOptions) ksaltpack.SigningSecretKey {
+	if sender == nil || opts.Anonymous {
+		return nil
+	}
+	return newSignKey(sender)
+}
+
 func edx25519SenderKey(senderPub ksaltpack.SigningPublicKey) (*keys.EdX25519PublicKey, error) {
 	if senderPub == nil {
 		return nil, nil
@@ -72,14 +92,22 @@ func SigncryptOpen(b []byte, armored bool, kr Keyring) ([]byte, *keys.EdX25519Pu
 
 // NewSigncryptStream creates a signcrypt stream.
 func NewSigncryptStream(w io.Writer, armored bool, sender *keys.EdX25519Key, recipients ...keys.ID) (io.WriteCloser, error) {
-	recs, err := boxPublicKeys(recipients)
+	return NewSigncryptStreamWithOptions(w, sender, recipients, withArmored(armored))
+}
+
+// NewSigncryptStreamWithOptions creates a signcrypt stream with options.
+// See SigncryptWithOptions.
+func NewSigncryptStreamWithOptions(w io.Writer, sender *keys.EdX25519Key, recipients []keys.ID, opt ...EncryptOption) (io.WriteCloser, error) {
+	opts := newEncryptOptions(opt...)
+	recs, err := signcryptBoxPublicKeys(recipients, opts)
 	if err != nil {
 		return nil, err
 	}
-	if armored {
-		return ksaltpack.NewSigncryptArmor62SealStream(w, ephemeralKeyCreator{}, newSignKey(sender), recs, nil, "")
+	sk := signSenderKey(sender, opts)
+	if opts.Armored {
+		return ksaltpack.NewSigncryptArmor62SealStream(w, ephemeralKeyCreator{}, sk, recs, nil, "")
 	}
-	return ksaltpack.NewSigncryptSealStream(w, ephemeralKeyCreator{}, newSignKey(sender), recs, nil)
+	return ksaltpack.NewSigncryptSealStream(w, ephemeralKeyCreator{}, sk, recs, nil)
 }
 
 // NewSigncryptOpenStream creates a signcrypt open stream.
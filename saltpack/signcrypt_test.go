@@ -133,3 +133,45 @@ func TestSigncryptOpenError(t *testing.T) {
 	_, _, err = saltpack.SigncryptOpen(encrypted, true, saltpack.NewKeyring(bob))
 	require.Equal(t, err, saltpack.ErrInvalidData)
 }
+
+func TestSigncryptWithOptions(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	message := []byte("hi bob")
+
+	encrypted, err := saltpack.SigncryptWithOptions(message, alice, []keys.ID{bob.ID()}, saltpack.Anonymous(), saltpack.Armored())
+	require.NoError(t, err)
+	out, sender, err := saltpack.SigncryptOpen(encrypted, true, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+	require.Nil(t, sender)
+
+	var buf bytes.Buffer
+	stream, err := saltpack.NewSigncryptStreamWithOptions(&buf, nil, []keys.ID{bob.ID()})
+	require.NoError(t, err)
+	_, err = stream.Write(message)
+	require.NoError(t, err)
+	err = stream.Close()
+	require.NoError(t, err)
+	dstream, sender, err := saltpack.NewSigncryptOpenStream(&buf, false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Nil(t, sender)
+	out, err = ioutil.ReadAll(dstream)
+	require.NoError(t, err)
+	require.Equal(t, message, out)
+}
+
+func TestSigncryptVisibleRecipients(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+
+	_, err := saltpack.SigncryptWithOptions([]byte("hi bob"), alice, []keys.ID{bob.ID()}, saltpack.VisibleRecipients())
+	require.EqualError(t, err, "signcrypt recipients can't be visible")
+
+	var buf bytes.Buffer
+	_, err = saltpack.NewSigncryptStreamWithOptions(&buf, alice, []keys.ID{bob.ID()}, saltpack.VisibleRecipients())
+	require.EqualError(t, err, "signcrypt recipients can't be visible")
+
+	_, err = saltpack.NewParallelSigncryptStream(&buf, alice, []keys.ID{bob.ID()}, saltpack.VisibleRecipients())
+	require.EqualError(t, err, "signcrypt recipients can't be visible")
+}
@@ -0,0 +1,266 @@
+package saltpack
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// signMetadataContext prefixes signed metadata, so these signatures can't be
+// confused with signatures over raw bytes.
+const signMetadataContext = "keys.pub/saltpack/signmeta/v1\x00"
+
+// ErrSignatureExpired if a signature has expired.
+var ErrSignatureExpired = errors.New("signature expired")
+
+// SignMetadata is signed along with the message.
+type SignMetadata struct {
+	// Timestamp when signed.
+	Timestamp time.Time
+	// Purpose (context) the signature is for.
+	Purpose string
+	// Expire is when the signature expires, or zero if it doesn't expire.
+	Expire time.Time
+}
+
+// IsExpired returns true if expired at time t.
+func (m *SignMetadata) IsExpired(t time.Time) bool {
+	return !m.Expire.IsZero() && !t.Before(m.Expire)
+}
+
+type signMetadata struct {
+	Timestamp int64  `msgpack:"ts"`
+	Purpose   string `msgpack:"p,omitempty"`
+	Expire    int64  `msgpack:"exp,omitempty"`
+	// Detached if signing a message digest (SHA-512).
+	Detached bool `msgpack:"d,omitempty"`
+}
+
+// SignOptions for SignWithMetadata and SignDetachedWithMetadata.
+type SignOptions struct {
+	// Clock for the signature timestamp.
+	Clock tsutil.Clock
+	// Purpose (context) the signature is for.
+	Purpose string
+	// ExpireIn is how long the signature is valid for, or 0 if it doesn't
+	// expire.
+	ExpireIn time.Duration
+}
+
+// SignOption for SignOptions.
+type SignOption func(*SignOptions)
+
+func newSignOptions(opts ...SignOption) SignOptions {
+	options := SignOptions{
+		Clock: tsutil.NewClock(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// SignClock sets the clock for the signature timestamp.
+func SignClock(clock tsutil.Clock) SignOption {
+	return func(o *SignOptions) {
+		o.Clock = clock
+	}
+}
+
+// Purpose sets the purpose (context) the signature is for.
+func Purpose(purpose string) SignOption {
+	return func(o *SignOptions) {
+		o.Purpose = purpose
+	}
+}
+
+// ExpireIn sets how long the signature is valid for.
+func ExpireIn(dt time.Duration) SignOption {
+	return func(o *SignOptions) {
+		o.ExpireIn = dt
+	}
+}
+
+// VerifyOptions for VerifyWithMetadata and VerifyDetachedWithMetadata.
+type VerifyOptions struct {
+	// Clock to check expiry.
+	Clock tsutil.Clock
+	// Purpose, if set, the signature must be for.
+	Purpose string
+}
+
+// VerifyOption for VerifyOptions.
+type VerifyOption func(*VerifyOptions)
+
+func newVerifyOptions(opts ...VerifyOption) VerifyOptions {
+	options := VerifyOptions{
+		Clock: tsutil.NewClock(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// VerifyClock sets the clock to check expiry.
+func VerifyClock(clock tsutil.Clock) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Clock = clock
+	}
+}
+
+// ExpectPurpose requires the signature to be for purpose.
+func ExpectPurpose(purpose string) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Purpose = purpose
+	}
+}
+
+// SignWithMetadata signs bytes with a timestamp, purpose and (optional)
+// expiry, see VerifyWithMetadata.
+func SignWithMetadata(b []byte, armored bool, key *keys.EdX25519Key, opt ...SignOption) ([]byte, error) {
+	opts := newSignOptions(opt...)
+	header, err := signMetadataHeader(opts, false)
+	if err != nil {
+		return nil, err
+	}
+	return Sign(append(header, b...), armored, key)
+}
+
+// SignDetachedWithMetadata creates a detached signature with a timestamp,
+// purpose and (optional) expiry, see VerifyDetachedWithMetadata.
+//
+// The signature includes the metadata and is a saltpack (attached) signature
+// over the metadata and the message digest (SHA-512).
+func SignDetachedWithMetadata(b []byte, armored bool, key *keys.EdX25519Key, opt ...SignOption) ([]byte, error) {
+	opts := newSignOptions(opt...)
+	header, err := signMetadataHeader(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha512.Sum512(b)
+	return Sign(append(header, digest[:]...), armored, key)
+}
+
+// VerifyWithMetadata verifies a signature from SignWithMetadata, returning
+// the message, signer and metadata.
+//
+// Returns ErrSignatureExpired if expired, or an error if ExpectPurpose is set
+// and the signature is for a different purpose.
+func VerifyWithMetadata(b []byte, opt ...VerifyOption) ([]byte, keys.ID, *SignMetadata, error) {
+	opts := newVerifyOptions(opt...)
+	out, signer, err := Verify(b)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	md, msg, err := parseSignMetadata(out, false)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := checkSignMetadata(md, opts); err != nil {
+		return nil, "", nil, err
+	}
+	return msg, signer, md, nil
+}
+
+// VerifyDetachedWithMetadata verifies a detached signature from
+// SignDetachedWithMetadata, returning the signer and metadata.
+//
+// Returns ErrSignatureExpired if expired, or an error if ExpectPurpose is set
+// and the signature is for a different purpose.
+func VerifyDetachedWithMetadata(sig []byte, b []byte, opt ...VerifyOption) (keys.ID, *SignMetadata, error) {
+	opts := newVerifyOptions(opt...)
+	out, signer, err := Verify(sig)
+	if err != nil {
+		return "", nil, err
+	}
+	md, digest, err := parseSignMetadata(out, true)
+	if err != nil {
+		return "", nil, err
+	}
+	expected := sha512.Sum512(b)
+	if subtle.ConstantTimeCompare(digest, expected[:]) != 1 {
+		return "", nil, errors.Errorf("failed to verify: message digest mismatch")
+	}
+	if err := checkSignMetadata(md, opts); err != nil {
+		return "", nil, err
+	}
+	return signer, md, nil
+}
+
+func signMetadataHeader(opts SignOptions, detached bool) ([]byte, error) {
+	now := opts.Clock.Now()
+	md := &signMetadata{
+		Timestamp: tsutil.Millis(now),
+		Purpose:   opts.Purpose,
+		Detached:  detached,
+	}
+	if opts.ExpireIn != 0 {
+		if opts.ExpireIn < 0 {
+			return nil, errors.Errorf("invalid expiry")
+		}
+		md.Expire = tsutil.Millis(now.Add(opts.ExpireIn))
+	}
+	mb, err := msgpack.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(mb)))
+	out := append([]byte(signMetadataContext), length...)
+	return append(out, mb...), nil
+}
+
+func parseSignMetadata(b []byte, detached bool) (*SignMetadata, []byte, error) {
+	if !bytes.HasPrefix(b, []byte(signMetadataContext)) {
+		return nil, nil, errors.Errorf("invalid signature metadata")
+	}
+	b = b[len(signMetadataContext):]
+	if len(b) < 4 {
+		return nil, nil, errors.Errorf("invalid signature metadata")
+	}
+	length := binary.BigEndian.Uint32(b[:4])
+	b = b[4:]
+	if uint64(length) > uint64(len(b)) {
+		return nil, nil, errors.Errorf("invalid signature metadata")
+	}
+	var md signMetadata
+	if err := msgpack.Unmarshal(b[:length], &md); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid signature metadata")
+	}
+	msg := b[length:]
+	if md.Detached != detached {
+		if detached {
+			return nil, nil, errors.Errorf("not a detached signature")
+		}
+		return nil, nil, errors.Errorf("signature is detached")
+	}
+	if detached && len(msg) != sha512.Size {
+		return nil, nil, errors.Errorf("invalid signature metadata")
+	}
+	out := &SignMetadata{
+		Timestamp: tsutil.ParseMillis(md.Timestamp),
+		Purpose:   md.Purpose,
+	}
+	if md.Expire != 0 {
+		out.Expire = tsutil.ParseMillis(md.Expire)
+	}
+	return out, msg, nil
+}
+
+func checkSignMetadata(md *SignMetadata, opts VerifyOptions) error {
+	if md.IsExpired(opts.Clock.Now()) {
+		return ErrSignatureExpired
+	}
+	if opts.Purpose != "" && md.Purpose != opts.Purpose {
+		return errors.Errorf("signature purpose mismatch %q", md.Purpose)
+	}
+	return nil
+}
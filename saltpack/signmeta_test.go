@@ -0,0 +1,95 @@
+package saltpack_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignWithMetadata(t *testing.T) {
+	clock := tsutil.NewTestClock()
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	message := []byte("hi bob")
+
+	for _, armored := range []bool{false, true} {
+		ts := clock.Now()
+		sig, err := saltpack.SignWithMetadata(message, armored, alice, saltpack.SignClock(clock), saltpack.Purpose("test"), saltpack.ExpireIn(time.Hour))
+		require.NoError(t, err)
+
+		out, signer, md, err := saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock), saltpack.ExpectPurpose("test"))
+		require.NoError(t, err)
+		require.Equal(t, message, out)
+		require.Equal(t, alice.ID(), signer)
+		require.Equal(t, tsutil.Millis(ts)+1, tsutil.Millis(md.Timestamp))
+		require.Equal(t, "test", md.Purpose)
+		require.Equal(t, md.Timestamp.Add(time.Hour), md.Expire)
+
+		// Wrong purpose
+		_, _, _, err = saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock), saltpack.ExpectPurpose("other"))
+		require.EqualError(t, err, `signature purpose mismatch "test"`)
+
+		// Not a detached signature
+		_, _, err = saltpack.VerifyDetachedWithMetadata(sig, message, saltpack.VerifyClock(clock))
+		require.EqualError(t, err, "not a detached signature")
+
+		// Plain signature (without metadata)
+		sig, err = saltpack.Sign(message, armored, alice)
+		require.NoError(t, err)
+		_, _, _, err = saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock))
+		require.EqualError(t, err, "invalid signature metadata")
+	}
+
+	// No expiry or purpose
+	sig, err := saltpack.SignWithMetadata(message, false, alice, saltpack.SignClock(clock))
+	require.NoError(t, err)
+	clock.Add(time.Hour * 24 * 365)
+	_, _, md, err := saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock))
+	require.NoError(t, err)
+	require.Equal(t, "", md.Purpose)
+	require.True(t, md.Expire.IsZero())
+	_, _, _, err = saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock), saltpack.ExpectPurpose("test"))
+	require.EqualError(t, err, `signature purpose mismatch ""`)
+
+	// Expired
+	sig, err = saltpack.SignWithMetadata(message, false, alice, saltpack.SignClock(clock), saltpack.ExpireIn(time.Minute))
+	require.NoError(t, err)
+	clock.Add(time.Minute)
+	_, _, _, err = saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock))
+	require.Equal(t, saltpack.ErrSignatureExpired, err)
+
+	_, err = saltpack.SignWithMetadata(message, false, alice, saltpack.ExpireIn(-time.Minute))
+	require.EqualError(t, err, "invalid expiry")
+}
+
+func TestSignDetachedWithMetadata(t *testing.T) {
+	clock := tsutil.NewTestClock()
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	message := []byte("hi bob")
+
+	for _, armored := range []bool{false, true} {
+		sig, err := saltpack.SignDetachedWithMetadata(message, armored, alice, saltpack.SignClock(clock), saltpack.Purpose("test"), saltpack.ExpireIn(time.Hour))
+		require.NoError(t, err)
+
+		signer, md, err := saltpack.VerifyDetachedWithMetadata(sig, message, saltpack.VerifyClock(clock), saltpack.ExpectPurpose("test"))
+		require.NoError(t, err)
+		require.Equal(t, alice.ID(), signer)
+		require.Equal(t, "test", md.Purpose)
+
+		// Different message
+		_, _, err = saltpack.VerifyDetachedWithMetadata(sig, []byte("hi alice"), saltpack.VerifyClock(clock))
+		require.EqualError(t, err, "failed to verify: message digest mismatch")
+
+		// Not an attached signature
+		_, _, _, err = saltpack.VerifyWithMetadata(sig, saltpack.VerifyClock(clock))
+		require.EqualError(t, err, "signature is detached")
+
+		// Expired
+		clock.Add(time.Hour)
+		_, _, err = saltpack.VerifyDetachedWithMetadata(sig, message, saltpack.VerifyClock(clock))
+		require.Equal(t, saltpack.ErrSignatureExpired, err)
+	}
+}
@@ -0,0 +1,210 @@
+package saltpack
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/keys-pub/keys/user"
+	"github.com/pkg/errors"
+)
+
+// DefaultVerifyMaxAge is the default maximum age of a user verification.
+const DefaultVerifyMaxAge = time.Hour * 24 * 7
+
+// Users finds user results, see users.Users.
+type Users interface {
+	// User result for name@service.
+	User(ctx context.Context, user string) (*user.Result, error)
+	// Find user result for a key ID (including related X25519 key IDs).
+	Find(ctx context.Context, kid keys.ID) (*user.Result, error)
+}
+
+// ResolverOptions for Resolver.
+type ResolverOptions struct {
+	// Clock for verify expiry.
+	Clock tsutil.Clock
+	// VerifyMaxAge is the maximum age of a user verification.
+	VerifyMaxAge time.Duration
+}
+
+// ResolverOption for Resolver.
+type ResolverOption func(*ResolverOptions)
+
+func newResolverOptions(opts ...ResolverOption) ResolverOptions {
+	options := ResolverOptions{
+		Clock:        tsutil.NewClock(),
+		VerifyMaxAge: DefaultVerifyMaxAge,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// ResolverClock sets the clock.
+func ResolverClock(clock tsutil.Clock) ResolverOption {
+	return func(o *ResolverOptions) {
+		o.Clock = clock
+	}
+}
+
+// VerifyMaxAge sets the maximum age of a user verification.
+func VerifyMaxAge(dt time.Duration) ResolverOption {
+	return func(o *ResolverOptions) {
+		o.VerifyMaxAge = dt
+	}
+}
+
+// Resolver resolves user identities (name@service) for recipients and
+// senders.
+//
+// Users are only resolved if their status is user.StatusOK and their
+// verification isn't older than VerifyMaxAge.
+type Resolver struct {
+	users   Users
+	options ResolverOptions
+}
+
+// NewResolver creates a Resolver.
+func NewResolver(users Users, opt ...ResolverOption) *Resolver {
+	return &Resolver{
+		users:   users,
+		options: newResolverOptions(opt...),
+	}
+}
+
+// Sender of a message, with a verified user (if found).
+type Sender struct {
+	// Key is a *keys.X25519PublicKey (Encrypt) or *keys.EdX25519PublicKey
+	// (Signcrypt).
+	Key keys.Key
+	// User if verified, or nil.
+	User *user.User
+}
+
+// Recipients resolves recipients, which can be key IDs or user identities
+// (name@service), to X25519 key IDs.
+func (r *Resolver) Recipients(ctx context.Context, recipients ...string) ([]keys.ID, error) {
+	out := make([]keys.ID, 0, len(recipients))
+	for _, recipient := range recipients {
+		kid, err := r.recipient(ctx, recipient)
+		if err != nil {
+			return nil, err
+		}
+		pk, err := keys.NewX25519PublicKeyFromID(kid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid recipient %s", recipient)
+		}
+		out = append(out, pk.ID())
+	}
+	return out, nil
+}
+
+func (r *Resolver) recipient(ctx context.Context, recipient string) (keys.ID, error) {
+	if !strings.Contains(recipient, "@") {
+		return keys.ParseID(recipient)
+	}
+	res, err := r.users.User(ctx, recipient)
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", errors.Errorf("user %s not found", recipient)
+	}
+	if err := r.check(res); err != nil {
+		return "", errors.Wrapf(err, "user %s", recipient)
+	}
+	return res.User.KID, nil
+}
+
+func (r *Resolver) check(res *user.Result) error {
+	if res.Status != user.StatusOK {
+		return errors.Errorf("status is %s", res.Status)
+	}
+	if res.IsVerifyExpired(r.options.Clock.Now(), r.options.VerifyMaxAge) {
+		return errors.Errorf("verify expired")
+	}
+	return nil
+}
+
+// Sender returns the sender with verified user, if found.
+// Returns nil if key is nil (anonymous sender).
+func (r *Resolver) Sender(ctx context.Context, key keys.Key) (*Sender, error) {
+	if isNil(key) {
+		return nil, nil
+	}
+	sender := &Sender{Key: key}
+	res, err := r.users.Find(ctx, key.ID())
+	if err != nil {
+		return nil, err
+	}
+	if res != nil && res.User != nil && r.check(res) == nil {
+		sender.User = res.User
+	}
+	return sender, nil
+}
+
+// Encrypt to recipients (key IDs or name@service).
+// See Encrypt.
+func (r *Resolver) Encrypt(ctx context.Context, b []byte, armored bool, sender *keys.X25519Key, recipients ...string) ([]byte, error) {
+	kids, err := r.Recipients(ctx, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(b, armored, sender, kids...)
+}
+
+// Signcrypt to recipients (key IDs or name@service).
+// See Signcrypt.
+func (r *Resolver) Signcrypt(ctx context.Context, b []byte, armored bool, sender *keys.EdX25519Key, recipients ...string) ([]byte, error) {
+	kids, err := r.Recipients(ctx, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	return Signcrypt(b, armored, sender, kids...)
+}
+
+// Decrypt and resolve the sender.
+// See Decrypt.
+func (r *Resolver) Decrypt(ctx context.Context, b []byte, armored bool, kr Keyring) ([]byte, *Sender, error) {
+	out, key, err := Decrypt(b, armored, kr)
+	if err != nil {
+		return nil, nil, err
+	}
+	sender, err := r.Sender(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, sender, nil
+}
+
+// SigncryptOpen and resolve the sender.
+// See SigncryptOpen.
+func (r *Resolver) SigncryptOpen(ctx context.Context, b []byte, armored bool, kr Keyring) ([]byte, *Sender, error) {
+	out, key, err := SigncryptOpen(b, armored, kr)
+	if err != nil {
+		return nil, nil, err
+	}
+	sender, err := r.Sender(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, sender, nil
+}
+
+// Open (auto detecting the encoding) and resolve the sender.
+// See Open.
+func (r *Resolver) Open(ctx context.Context, b []byte, kr Keyring) ([]byte, *Sender, Encoding, error) {
+	out, key, enc, err := Open(b, kr)
+	if err != nil {
+		return nil, nil, enc, err
+	}
+	sender, err := r.Sender(ctx, key)
+	if err != nil {
+		return nil, nil, enc, err
+	}
+	return out, sender, enc, nil
+}
@@ -0,0 +1,116 @@
+package saltpack_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/saltpack"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/keys-pub/keys/user"
+	"github.com/keys-pub/keys/users"
+	"github.com/stretchr/testify/require"
+)
+
+var _ saltpack.Users = &users.Users{}
+
+type testUsers struct {
+	results []*user.Result
+}
+
+func (u *testUsers) User(ctx context.Context, usr string) (*user.Result, error) {
+	for _, res := range u.results {
+		if res.User.ID() == usr {
+			return res, nil
+		}
+	}
+	return nil, nil
+}
+
+func (u *testUsers) Find(ctx context.Context, kid keys.ID) (*user.Result, error) {
+	for _, res := range u.results {
+		pk, err := keys.NewEdX25519PublicKeyFromID(res.User.KID)
+		if err != nil {
+			return nil, err
+		}
+		if res.User.KID == kid || pk.X25519PublicKey().ID() == kid {
+			return res, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.TODO()
+	clock := tsutil.NewTestClock()
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewEdX25519KeyFromSeed(testSeed(0x03))
+	frank := keys.NewEdX25519KeyFromSeed(testSeed(0x04))
+
+	verified := tsutil.Millis(clock.Now())
+	usrs := &testUsers{results: []*user.Result{
+		{Status: user.StatusOK, VerifiedAt: verified, User: &user.User{Name: "alice", Service: "github", KID: alice.ID()}},
+		{Status: user.StatusOK, VerifiedAt: verified, User: &user.User{Name: "bob", Service: "github", KID: bob.ID()}},
+		{Status: user.StatusFailure, VerifiedAt: verified, User: &user.User{Name: "charlie", Service: "github", KID: charlie.ID()}},
+		{Status: user.StatusOK, User: &user.User{Name: "frank", Service: "github", KID: frank.ID()}},
+	}}
+	resolver := saltpack.NewResolver(usrs, saltpack.ResolverClock(clock))
+
+	kids, err := resolver.Recipients(ctx, "bob@github", charlie.X25519Key().ID().String(), alice.ID().String())
+	require.NoError(t, err)
+	require.Equal(t, []keys.ID{bob.X25519Key().ID(), charlie.X25519Key().ID(), alice.X25519Key().ID()}, kids)
+
+	_, err = resolver.Recipients(ctx, "dan@github")
+	require.EqualError(t, err, "user dan@github not found")
+	_, err = resolver.Recipients(ctx, "charlie@github")
+	require.EqualError(t, err, "user charlie@github: status is fail")
+	_, err = resolver.Recipients(ctx, "frank@github")
+	require.EqualError(t, err, "user frank@github: verify expired")
+
+	// Encrypt
+	encrypted, err := resolver.Encrypt(ctx, []byte("hi bob"), false, alice.X25519Key(), "bob@github")
+	require.NoError(t, err)
+	out, sender, err := resolver.Decrypt(ctx, encrypted, false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, alice.X25519Key().ID(), sender.Key.ID())
+	require.Equal(t, "alice@github", sender.User.ID())
+
+	// Signcrypt
+	encrypted, err = resolver.Signcrypt(ctx, []byte("hi bob"), true, alice, "bob@github")
+	require.NoError(t, err)
+	out, sender, err = resolver.SigncryptOpen(ctx, encrypted, true, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, alice.ID(), sender.Key.ID())
+	require.Equal(t, "alice@github", sender.User.ID())
+
+	// Open
+	out, sender, enc, err := resolver.Open(ctx, encrypted, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, saltpack.SigncryptEncoding, enc)
+	require.Equal(t, "hi bob", string(out))
+	require.Equal(t, "alice@github", sender.User.ID())
+
+	// Sender without verified user
+	encrypted, err = saltpack.Signcrypt([]byte("hi bob"), false, charlie, bob.ID())
+	require.NoError(t, err)
+	_, sender, err = resolver.SigncryptOpen(ctx, encrypted, false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Equal(t, charlie.ID(), sender.Key.ID())
+	require.Nil(t, sender.User)
+
+	// Anonymous sender
+	encrypted, err = saltpack.Encrypt([]byte("hi bob"), false, nil, bob.ID())
+	require.NoError(t, err)
+	_, sender, err = resolver.Decrypt(ctx, encrypted, false, saltpack.NewKeyring(bob))
+	require.NoError(t, err)
+	require.Nil(t, sender)
+
+	// Verification expired
+	clock.Add(saltpack.DefaultVerifyMaxAge + time.Hour)
+	_, err = resolver.Recipients(ctx, "bob@github")
+	require.EqualError(t, err, "user bob@github: verify expired")
+}
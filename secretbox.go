@@ -2,9 +2,9 @@ package keys
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/nacl/secretbox"
 )
 
@@ -42,35 +42,125 @@ func secretBoxOpen(encrypted []byte, secretKey *[32]byte) ([]byte, error) {
 	return b, nil
 }
 
+// passwordMagic prefixes versioned password encrypted payloads.
+var passwordMagic = []byte("KPWE")
+
+const (
+	passwordVersion1 byte = 0x01
+	kdfArgon2id      byte = 0x01
+)
+
+// kdfHeaderLength is kdf (1), time (4), memory (4), threads (1) and salt (16).
+const kdfHeaderLength = 26
+
+// passwordHeaderLength is magic (4), version (1) and the kdf header.
+const passwordHeaderLength = 5 + kdfHeaderLength
+
 // EncryptWithPassword encrypts bytes with a password.
-// Uses argon2.IDKey(password, salt, 1, 64*1024, 4, 32) with 16 byte salt.
-// The salt bytes are prepended to the encrypted bytes.
+// The key is derived with argon2id (DefaultArgon2idParams) and a random 16
+// byte salt.
+// The output starts with a versioned header containing the KDF algorithm,
+// parameters and salt, so that parameters can change without breaking
+// decryption.
 // This uses nacl.secretbox, so the bytes/message should be small.
 // If you need to encrypt large amounts of data, use Saltpack instead
 // (TODO: More details here).
 func EncryptWithPassword(b []byte, password string) []byte {
+	return encryptWithPassword(b, password, DefaultArgon2idParams)
+}
+
+// EncryptWithPasswordKDF is EncryptWithPassword with KDF options, for example
+// WithArgon2id.
+// Returns an error if the KDF parameters are invalid.
+func EncryptWithPasswordKDF(b []byte, password string, opt ...KDFOption) ([]byte, error) {
+	opts := newKDFOptions(opt...)
+	if err := opts.Argon2id.check(); err != nil {
+		return nil, err
+	}
+	return encryptWithPassword(b, password, opts.Argon2id), nil
+}
+
+func encryptWithPassword(b []byte, password string, params Argon2idParams) []byte {
 	salt := Rand16()
-	key := argon2.IDKey([]byte(password), salt[:], 1, 64*1024, 4, 32)
-	encrypted := SecretBoxSeal(b, Bytes32(key))
-	return bytesJoin(salt[:], encrypted)
+	header := bytesJoin(passwordMagic, []byte{passwordVersion1}, kdfHeader(params, salt[:]))
+	key := params.key(password, salt[:])
+	encrypted := SecretBoxSeal(b, key)
+	return bytesJoin(header, encrypted)
 }
 
 // DecryptWithPassword decrypts bytes using a password.
-// It assumes a 16 byte salt before the encrypted bytes.
-func DecryptWithPassword(encrypted []byte, password string) ([]byte, error) {
-	if len(encrypted) < 16 {
-		return nil, errors.Errorf("failed to decrypt with a password: not enough bytes")
+// It reads the KDF parameters from the versioned header, which must be within
+// DefaultArgon2idLimits unless WithArgon2idLimits is specified.
+// Payloads without a header (v0) are a 16 byte salt before the encrypted
+// bytes, using DefaultArgon2idParams.
+func DecryptWithPassword(encrypted []byte, password string, opt ...KDFOption) ([]byte, error) {
+	opts := newKDFOptions(opt...)
+	params, salt, b, err := parsePasswordHeader(encrypted, opts.Argon2idLimits)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt with a password")
 	}
-	salt := encrypted[0:16]
-	b := encrypted[16:]
-	key := argon2.IDKey([]byte(password), salt[:], 1, 64*1024, 4, 32)
-	out, err := SecretBoxOpen(b, Bytes32(key))
+	key := params.key(password, salt)
+	out, err := SecretBoxOpen(b, key)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to decrypt with a password")
 	}
 	return out, nil
 }
 
+func parsePasswordHeader(encrypted []byte, limits Argon2idParams) (Argon2idParams, []byte, []byte, error) {
+	if len(encrypted) >= passwordHeaderLength && bytes.Equal(encrypted[:4], passwordMagic) {
+		if encrypted[4] != passwordVersion1 {
+			return Argon2idParams{}, nil, nil, errors.Errorf("unsupported password encryption version %d", encrypted[4])
+		}
+		params, salt, err := parseKDFHeader(encrypted[5:passwordHeaderLength], limits)
+		if err != nil {
+			return Argon2idParams{}, nil, nil, err
+		}
+		return params, salt, encrypted[passwordHeaderLength:], nil
+	}
+	// v0
+	if len(encrypted) < 16 {
+		return Argon2idParams{}, nil, nil, errors.Errorf("not enough bytes")
+	}
+	return DefaultArgon2idParams, encrypted[0:16], encrypted[16:], nil
+}
+
+func kdfHeader(params Argon2idParams, salt []byte) []byte {
+	return bytesJoin(
+		[]byte{kdfArgon2id},
+		uint32Bytes(params.Time),
+		uint32Bytes(params.Memory),
+		[]byte{params.Threads},
+		salt)
+}
+
+func parseKDFHeader(b []byte, limits Argon2idParams) (Argon2idParams, []byte, error) {
+	if len(b) != kdfHeaderLength {
+		return Argon2idParams{}, nil, errors.Errorf("invalid kdf header")
+	}
+	if b[0] != kdfArgon2id {
+		return Argon2idParams{}, nil, errors.Errorf("unsupported kdf %d", b[0])
+	}
+	params := Argon2idParams{
+		Time:    binary.BigEndian.Uint32(b[1:5]),
+		Memory:  binary.BigEndian.Uint32(b[5:9]),
+		Threads: b[9],
+	}
+	if err := params.check(); err != nil {
+		return Argon2idParams{}, nil, err
+	}
+	if err := params.checkLimits(limits); err != nil {
+		return Argon2idParams{}, nil, err
+	}
+	return params, b[10:26], nil
+}
+
+func uint32Bytes(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
 func bytesJoin(b ...[]byte) []byte {
 	return bytes.Join(b, []byte{})
 }
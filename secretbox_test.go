@@ -2,6 +2,7 @@ package keys_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 
 	"github.com/keys-pub/keys"
@@ -73,3 +74,64 @@ func TestEncryptWithPassword(t *testing.T) {
 	require.Nil(t, out)
 	require.EqualError(t, err, "failed to decrypt with a password: secretbox open failed")
 }
+
+func TestEncryptWithPasswordParams(t *testing.T) {
+	b := []byte("hello")
+	params := keys.Argon2idParams{Time: 2, Memory: 1024, Threads: 1}
+	encrypted, err := keys.EncryptWithPasswordKDF(b, "password123", keys.WithArgon2id(params))
+	require.NoError(t, err)
+	require.Equal(t, []byte("KPWE"), encrypted[:4])
+	require.Equal(t, []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x04, 0x00, 0x01}, encrypted[4:15])
+
+	out, err := keys.DecryptWithPassword(encrypted, "password123")
+	require.NoError(t, err)
+	require.Equal(t, b, out)
+
+	// Changing params in the header fails
+	encrypted[9] = 0x01
+	_, err = keys.DecryptWithPassword(encrypted, "password123")
+	require.EqualError(t, err, "failed to decrypt with a password: secretbox open failed")
+
+	// Key for password with params
+	salt := bytes.Repeat([]byte{0x01}, 16)
+	k1, err := keys.KeyForPassword("password123", salt)
+	require.NoError(t, err)
+	k2, err := keys.KeyForPassword("password123", salt, keys.WithArgon2id(params))
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+	_, err = keys.KeyForPassword("password123", salt, keys.WithArgon2id(keys.Argon2idParams{}))
+	require.EqualError(t, err, "invalid argon2id time 0")
+
+	// Invalid params
+	_, err = keys.EncryptWithPasswordKDF(b, "password123", keys.WithArgon2id(keys.Argon2idParams{Time: 1, Memory: 1024}))
+	require.EqualError(t, err, "invalid argon2id threads 0")
+
+	// Stronger params than the (default) decrypt limits
+	strong := keys.Argon2idParams{Time: 9, Memory: 1024, Threads: 1}
+	encrypted, err = keys.EncryptWithPasswordKDF(b, "password123", keys.WithArgon2id(strong))
+	require.NoError(t, err)
+	_, err = keys.DecryptWithPassword(encrypted, "password123")
+	require.EqualError(t, err, "failed to decrypt with a password: kdf params exceed limits")
+	out, err = keys.DecryptWithPassword(encrypted, "password123", keys.WithArgon2idLimits(strong))
+	require.NoError(t, err)
+	require.Equal(t, b, out)
+
+	// Invalid params in the header
+	encrypted[9] = 0x00
+	_, err = keys.DecryptWithPassword(encrypted, "password123")
+	require.EqualError(t, err, "failed to decrypt with a password: invalid argon2id time 0")
+
+	// Unsupported version
+	encrypted[4] = 0x02
+	_, err = keys.DecryptWithPassword(encrypted, "password123")
+	require.EqualError(t, err, "failed to decrypt with a password: unsupported password encryption version 2")
+}
+
+func TestDecryptWithPasswordV0(t *testing.T) {
+	// Encrypted before the versioned header (16 byte salt, 1 pass, 64 MiB, 4 threads)
+	encrypted, err := hex.DecodeString("e12d4b97e94e44a147857f2027d449fc54b05c862e3491184c37651bb024853f46483d8b061f0b4a2601db06e2c456082c0f3a72d36d7baab4ae00b3ac")
+	require.NoError(t, err)
+	out, err := keys.DecryptWithPassword(encrypted, "password123")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), out)
+}
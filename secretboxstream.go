@@ -0,0 +1,433 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Secretbox stream format:
+//
+//   header: magic (4) | version (1) | mode (1) | kdf header (26, if password) |
+//     chunk size (4) | nonce prefix (15)
+//   chunks: secretbox(chunk, nonce prefix | counter (8) | final (1))
+//
+// All chunks except the last are chunk size bytes (before encryption).
+// The last chunk is marked final (and may be empty), so a truncated stream
+// fails to decrypt.
+
+var secretBoxStreamMagic = []byte("KSBS")
+
+const (
+	secretBoxStreamVersion1 byte = 0x01
+	secretBoxStreamKey      byte = 0x00
+	secretBoxStreamPassword byte = 0x01
+	noncePrefixLength            = 15
+	// DefaultChunkSize for secretbox streams.
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+)
+
+// ErrStreamTruncated if secretbox stream is missing the final chunk.
+var ErrStreamTruncated = errors.New("secretbox stream truncated")
+
+// SecretBoxStreamOptions are options for secretbox streams.
+type SecretBoxStreamOptions struct {
+	// ChunkSize is the size of each chunk before encryption.
+	ChunkSize int
+	// KDF options for password streams.
+	KDF []KDFOption
+}
+
+// SecretBoxStreamOption ...
+type SecretBoxStreamOption func(*SecretBoxStreamOptions)
+
+func newSecretBoxStreamOptions(opts ...SecretBoxStreamOption) SecretBoxStreamOptions {
+	options := SecretBoxStreamOptions{ChunkSize: DefaultChunkSize}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// ChunkSize option.
+func ChunkSize(n int) SecretBoxStreamOption {
+	return func(o *SecretBoxStreamOptions) {
+		o.ChunkSize = n
+	}
+}
+
+// StreamKDF option for password derived keys.
+func StreamKDF(opt ...KDFOption) SecretBoxStreamOption {
+	return func(o *SecretBoxStreamOptions) {
+		o.KDF = opt
+	}
+}
+
+// NewSecretBoxWriter returns an io.WriteCloser that encrypts to w using
+// chunked secretbox.
+// You must call Close to write the final chunk.
+func NewSecretBoxWriter(w io.Writer, key *[32]byte, opt ...SecretBoxStreamOption) (io.WriteCloser, error) {
+	opts := newSecretBoxStreamOptions(opt...)
+	return newSecretBoxWriter(w, key, []byte{secretBoxStreamKey}, opts.ChunkSize)
+}
+
+// NewPasswordWriter returns an io.WriteCloser that encrypts to w using
+// chunked secretbox with a key derived from password (argon2id).
+// The KDF parameters and salt are stored in the stream header.
+// You must call Close to write the final chunk.
+func NewPasswordWriter(w io.Writer, password string, opt ...SecretBoxStreamOption) (io.WriteCloser, error) {
+	opts := newSecretBoxStreamOptions(opt...)
+	salt := Rand16()
+	kdf := newKDFOptions(opts.KDF...)
+	key, err := KeyForPassword(password, salt[:], opts.KDF...)
+	if err != nil {
+		return nil, err
+	}
+	mode := bytesJoin([]byte{secretBoxStreamPassword}, kdfHeader(kdf.Argon2id, salt[:]))
+	return newSecretBoxWriter(w, key, mode, opts.ChunkSize)
+}
+
+// NewSecretBoxReader returns an io.Reader that decrypts a stream from
+// NewSecretBoxWriter.
+// Returns ErrStreamTruncated if the stream ends before the final chunk.
+func NewSecretBoxReader(r io.Reader, key *[32]byte) (io.Reader, error) {
+	return newSecretBoxReader(r, func(mode byte, br *bufio.Reader) (*[32]byte, error) {
+		if mode != secretBoxStreamKey {
+			return nil, errors.Errorf("secretbox stream requires a password")
+		}
+		return key, nil
+	})
+}
+
+// NewPasswordReader returns an io.Reader that decrypts a stream from
+// NewPasswordWriter.
+// The KDF parameters in the stream header must be within
+// DefaultArgon2idLimits unless WithArgon2idLimits is specified.
+// Returns ErrStreamTruncated if the stream ends before the final chunk.
+func NewPasswordReader(r io.Reader, password string, opt ...KDFOption) (io.Reader, error) {
+	opts := newKDFOptions(opt...)
+	return newSecretBoxReader(r, func(mode byte, br *bufio.Reader) (*[32]byte, error) {
+		if mode != secretBoxStreamPassword {
+			return nil, errors.Errorf("secretbox stream requires a key")
+		}
+		b := make([]byte, kdfHeaderLength)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, errors.Errorf("invalid secretbox stream header")
+		}
+		params, salt, err := parseKDFHeader(b, opts.Argon2idLimits)
+		if err != nil {
+			return nil, err
+		}
+		return KeyForPassword(password, salt, WithArgon2id(params))
+	})
+}
+
+type secretBoxWriter struct {
+	w         io.Writer
+	key       *[32]byte
+	nonce     [24]byte
+	counter   uint64
+	chunkSize int
+	buf       []byte
+	closed    bool
+}
+
+func newSecretBoxWriter(w io.Writer, key *[32]byte, mode []byte, chunkSize int) (*secretBoxWriter, error) {
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		return nil, errors.Errorf("invalid chunk size")
+	}
+	sw := &secretBoxWriter{
+		w:         w,
+		key:       key,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}
+	copy(sw.nonce[:noncePrefixLength], RandBytes(noncePrefixLength))
+	header := bytesJoin(
+		secretBoxStreamMagic,
+		[]byte{secretBoxStreamVersion1},
+		mode,
+		uint32Bytes(uint32(chunkSize)),
+		sw.nonce[:noncePrefixLength])
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (w *secretBoxWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.Errorf("secretbox stream closed")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		// Only write a chunk when there is more data, since we don't know if
+		// the chunk is final until Close.
+		if len(w.buf) == w.chunkSize {
+			if err := w.writeChunk(false); err != nil {
+				return 0, err
+			}
+		}
+		i := w.chunkSize - len(w.buf)
+		if i > len(p) {
+			i = len(p)
+		}
+		w.buf = append(w.buf, p[:i]...)
+		p = p[i:]
+	}
+	return n, nil
+}
+
+func (w *secretBoxWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.writeChunk(true)
+}
+
+func (w *secretBoxWriter) writeChunk(final bool) error {
+	nonce := chunkNonce(w.nonce, w.counter, final)
+	encrypted := secretbox.Seal(nil, w.buf, nonce, w.key)
+	if _, err := w.w.Write(encrypted); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func chunkNonce(nonce [24]byte, counter uint64, final bool) *[24]byte {
+	binary.BigEndian.PutUint64(nonce[noncePrefixLength:23], counter)
+	if final {
+		nonce[23] = 0x01
+	}
+	return &nonce
+}
+
+type secretBoxReader struct {
+	r       *bufio.Reader
+	key     *[32]byte
+	nonce   [24]byte
+	counter uint64
+	chunk   []byte
+	buf     []byte
+	final   bool
+}
+
+func newSecretBoxReader(r io.Reader, keyFn func(mode byte, br *bufio.Reader) (*[32]byte, error)) (*secretBoxReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header[:4], secretBoxStreamMagic) {
+		return nil, errors.Errorf("invalid secretbox stream header")
+	}
+	if header[4] != secretBoxStreamVersion1 {
+		return nil, errors.Errorf("unsupported secretbox stream version %d", header[4])
+	}
+	key, err := keyFn(header[5], br)
+	if err != nil {
+		return nil, err
+	}
+	rest := make([]byte, 4+noncePrefixLength)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return nil, errors.Errorf("invalid secretbox stream header")
+	}
+	chunkSize := int(binary.BigEndian.Uint32(rest[:4]))
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		return nil, errors.Errorf("invalid chunk size")
+	}
+	sr := &secretBoxReader{
+		r:     br,
+		key:   key,
+		chunk: make([]byte, chunkSize+secretbox.Overhead),
+	}
+	copy(sr.nonce[:noncePrefixLength], rest[4:])
+	return sr, nil
+}
+
+func (r *secretBoxReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.final {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *secretBoxReader) readChunk() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	final := false
+	switch err {
+	case nil:
+		// Full chunk is final if there is no more data.
+		if _, err := r.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		return ErrStreamTruncated
+	default:
+		return err
+	}
+	if n < secretbox.Overhead {
+		return ErrStreamTruncated
+	}
+
+	nonce := chunkNonce(r.nonce, r.counter, final)
+	out, ok := secretbox.Open(nil, r.chunk[:n], nonce, r.key)
+	if !ok {
+		if final {
+			// Either truncated or the key is wrong.
+			if _, ok := secretbox.Open(nil, r.chunk[:n], chunkNonce(r.nonce, r.counter, false), r.key); ok {
+				return ErrStreamTruncated
+			}
+		}
+		return errors.Errorf("secretbox open failed")
+	}
+	r.counter++
+	r.buf = out
+	r.final = final
+	return nil
+}
+
+// EncryptFile encrypts a file with a key using chunked secretbox.
+func EncryptFile(in string, out string, key *[32]byte, opt ...SecretBoxStreamOption) error {
+	return encryptFile(in, out, func(w io.Writer) (io.WriteCloser, error) {
+		return NewSecretBoxWriter(w, key, opt...)
+	})
+}
+
+// DecryptFile decrypts a file from EncryptFile.
+func DecryptFile(in string, out string, key *[32]byte) error {
+	return decryptFile(in, out, func(r io.Reader) (io.Reader, error) {
+		return NewSecretBoxReader(r, key)
+	})
+}
+
+// EncryptFileWithPassword encrypts a file with a password using chunked
+// secretbox.
+func EncryptFileWithPassword(in string, out string, password string, opt ...SecretBoxStreamOption) error {
+	return encryptFile(in, out, func(w io.Writer) (io.WriteCloser, error) {
+		return NewPasswordWriter(w, password, opt...)
+	})
+}
+
+// DecryptFileWithPassword decrypts a file from EncryptFileWithPassword.
+func DecryptFileWithPassword(in string, out string, password string) error {
+	return decryptFile(in, out, func(r io.Reader) (io.Reader, error) {
+		return NewPasswordReader(r, password)
+	})
+}
+
+func encryptFile(in string, out string, fn func(w io.Writer) (io.WriteCloser, error)) error {
+	logger.Infof("Encrypting %s to %s", in, out)
+	if in == "" {
+		return errors.Errorf("in not specified")
+	}
+	if out == "" {
+		return errors.Errorf("out not specified")
+	}
+
+	inFile, err := os.Open(in) // #nosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = inFile.Close()
+	}()
+
+	outTmp := out + ".tmp"
+	outFile, err := os.Create(outTmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = outFile.Close()
+		_ = os.Remove(outTmp)
+	}()
+	writer := bufio.NewWriter(outFile)
+
+	stream, err := fn(writer)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(inFile)
+	if _, err := reader.WriteTo(stream); err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := inFile.Close(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(outTmp, out)
+}
+
+func decryptFile(in string, out string, fn func(r io.Reader) (io.Reader, error)) error {
+	logger.Infof("Decrypting %s to %s", in, out)
+	if in == "" {
+		return errors.Errorf("in not specified")
+	}
+	if out == "" {
+		return errors.Errorf("out not specified")
+	}
+
+	inFile, err := os.Open(in) // #nosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = inFile.Close()
+	}()
+
+	stream, err := fn(bufio.NewReader(inFile))
+	if err != nil {
+		return errors.Wrapf(err, "failed to decrypt file")
+	}
+
+	outTmp := out + ".tmp"
+	outFile, err := os.Create(outTmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = outFile.Close()
+		_ = os.Remove(outTmp)
+	}()
+	writer := bufio.NewWriter(outFile)
+
+	if _, err := writer.ReadFrom(stream); err != nil {
+		return errors.Wrapf(err, "failed to decrypt file")
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := inFile.Close(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(outTmp, out)
+}
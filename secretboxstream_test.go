@@ -0,0 +1,156 @@
+package keys_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretBoxStream(t *testing.T) {
+	key := keys.Rand32()
+	for _, n := range []int{0, 1, 15, 16, 17, 32, 100} {
+		data := bytes.Repeat([]byte{0x01}, n)
+
+		var buf bytes.Buffer
+		w, err := keys.NewSecretBoxWriter(&buf, key, keys.ChunkSize(16))
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		err = w.Close()
+		require.NoError(t, err)
+
+		r, err := keys.NewSecretBoxReader(bytes.NewReader(buf.Bytes()), key)
+		require.NoError(t, err)
+		out, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, data, out)
+
+		// Invalid key
+		r, err = keys.NewSecretBoxReader(bytes.NewReader(buf.Bytes()), keys.Rand32())
+		require.NoError(t, err)
+		_, err = ioutil.ReadAll(r)
+		require.EqualError(t, err, "secretbox open failed")
+	}
+}
+
+func TestSecretBoxStreamTruncated(t *testing.T) {
+	key := keys.Rand32()
+	data := bytes.Repeat([]byte{0x01}, 64)
+
+	var buf bytes.Buffer
+	w, err := keys.NewSecretBoxWriter(&buf, key, keys.ChunkSize(16))
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	err = w.Close()
+	require.NoError(t, err)
+	b := buf.Bytes()
+
+	// Header (25) + 3 chunks (32) + final chunk (32)
+	require.Equal(t, 25+4*32, len(b))
+
+	// Remove final chunk
+	r, err := keys.NewSecretBoxReader(bytes.NewReader(b[:len(b)-32]), key)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.Equal(t, keys.ErrStreamTruncated, err)
+
+	// Remove last 2 chunks
+	r, err = keys.NewSecretBoxReader(bytes.NewReader(b[:len(b)-64]), key)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.Equal(t, keys.ErrStreamTruncated, err)
+
+	// Header only
+	r, err = keys.NewSecretBoxReader(bytes.NewReader(b[:25]), key)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.Equal(t, keys.ErrStreamTruncated, err)
+
+	// Partial chunk
+	r, err = keys.NewSecretBoxReader(bytes.NewReader(b[:len(b)-10]), key)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "secretbox open failed")
+
+	_, err = keys.NewSecretBoxReader(bytes.NewReader(b[:10]), key)
+	require.EqualError(t, err, "invalid secretbox stream header")
+}
+
+func TestPasswordStream(t *testing.T) {
+	data := bytes.Repeat([]byte{0x01}, 100)
+	kdf := keys.StreamKDF(keys.WithArgon2id(keys.Argon2idParams{Time: 1, Memory: 1024, Threads: 1}))
+
+	var buf bytes.Buffer
+	w, err := keys.NewPasswordWriter(&buf, "password123", keys.ChunkSize(32), kdf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	err = w.Close()
+	require.NoError(t, err)
+
+	r, err := keys.NewPasswordReader(bytes.NewReader(buf.Bytes()), "password123")
+	require.NoError(t, err)
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, out)
+
+	r, err = keys.NewPasswordReader(bytes.NewReader(buf.Bytes()), "invalid")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "secretbox open failed")
+
+	_, err = keys.NewSecretBoxReader(bytes.NewReader(buf.Bytes()), keys.Rand32())
+	require.EqualError(t, err, "secretbox stream requires a password")
+
+	// Params over the decrypt limits
+	limits := keys.WithArgon2idLimits(keys.Argon2idParams{Time: 1, Memory: 512, Threads: 1})
+	_, err = keys.NewPasswordReader(bytes.NewReader(buf.Bytes()), "password123", limits)
+	require.EqualError(t, err, "kdf params exceed limits")
+
+	_, err = keys.NewPasswordWriter(&buf, "")
+	require.EqualError(t, err, "empty password")
+}
+
+func TestEncryptFile(t *testing.T) {
+	var err error
+	in := keys.RandTempPath()
+	data := bytes.Repeat([]byte{0x01}, 200*1024)
+	err = ioutil.WriteFile(in, data, 0600)
+	require.NoError(t, err)
+	out := in + ".enc"
+	outDecrypted := in + ".dec"
+	defer func() {
+		_ = os.Remove(in)
+		_ = os.Remove(out)
+		_ = os.Remove(outDecrypted)
+	}()
+
+	key := keys.Rand32()
+	err = keys.EncryptFile(in, out, key)
+	require.NoError(t, err)
+	err = keys.DecryptFile(out, outDecrypted, key)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(outDecrypted)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+
+	err = keys.DecryptFile(out, outDecrypted, keys.Rand32())
+	require.EqualError(t, err, "failed to decrypt file: secretbox open failed")
+
+	kdf := keys.StreamKDF(keys.WithArgon2id(keys.Argon2idParams{Time: 1, Memory: 1024, Threads: 1}))
+	err = keys.EncryptFileWithPassword(in, out, "password123", kdf)
+	require.NoError(t, err)
+	err = keys.DecryptFileWithPassword(out, outDecrypted, "password123")
+	require.NoError(t, err)
+	b, err = ioutil.ReadFile(outDecrypted)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+
+	err = keys.EncryptFile("", out, key)
+	require.EqualError(t, err, "in not specified")
+}
@@ -0,0 +1,123 @@
+package keys
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/pkg/errors"
+)
+
+// MutualTLSConfig returns a tls.Config for mutual TLS with a EdX25519
+// certificate, where the peer must present a certificate for one of the
+// expected key IDs.
+// The peer is authenticated by its key ID (see CertificateKeyID), instead of a
+// certificate chain, so self-signed certificates can be used.
+func MutualTLSConfig(cert *CertificateKey, expected []ID) *tls.Config {
+	return mutualTLSConfig(expected, tsutil.NewClock(), func() (*tls.Certificate, error) {
+		tlsCert := cert.TLSCertificate()
+		return &tlsCert, nil
+	})
+}
+
+func mutualTLSConfig(expected []ID, clock tsutil.Clock, getCert func() (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return getCert()
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return getCert()
+		},
+		// Skip chain verification, we check the peer key ID instead.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyPeerKeyID(expected, clock),
+	}
+}
+
+func verifyPeerKeyID(expected []ID, clock tsutil.Clock) func([][]byte, [][]*x509.Certificate) error {
+	set := NewIDSet(expected...)
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.Errorf("no peer certificate")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		now := clock.Now()
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return errors.Errorf("peer certificate expired or not yet valid")
+		}
+		kid, err := CertificateKeyID(cert)
+		if err != nil {
+			return err
+		}
+		if !set.Contains(kid) {
+			return errors.Errorf("unexpected peer %s", kid)
+		}
+		return nil
+	}
+}
+
+// CertificateRenewer generates a EdX25519 certificate and renews it before it
+// expires.
+type CertificateRenewer struct {
+	sync.Mutex
+	key         *EdX25519Key
+	opts        []CertificateOption
+	clock       tsutil.Clock
+	renewBefore time.Duration
+	cert        *CertificateKey
+}
+
+// NewCertificateRenewer creates a CertificateRenewer, which generates a new
+// certificate if the current one expires within renewBefore.
+func NewCertificateRenewer(key *EdX25519Key, renewBefore time.Duration, opt ...CertificateOption) (*CertificateRenewer, error) {
+	opts := newCertificateOptions(opt...)
+	if renewBefore >= opts.ValidFor {
+		return nil, errors.Errorf("renew before is longer than the certificate is valid")
+	}
+	r := &CertificateRenewer{
+		key:         key,
+		opts:        opt,
+		clock:       opts.Clock,
+		renewBefore: renewBefore,
+	}
+	if _, err := r.Certificate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Certificate returns the current certificate, renewing it if needed.
+func (r *CertificateRenewer) Certificate() (*CertificateKey, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.cert != nil && !r.cert.NeedsRenewal(r.clock.Now(), r.renewBefore) {
+		return r.cert, nil
+	}
+	logger.Infof("Generating certificate for %s...", r.key.ID())
+	cert, err := GenerateEdX25519Certificate(r.key, r.opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.cert = cert
+	return cert, nil
+}
+
+// MutualTLSConfig returns a tls.Config for mutual TLS that uses the renewed
+// certificate. See MutualTLSConfig.
+func (r *CertificateRenewer) MutualTLSConfig(expected []ID) *tls.Config {
+	return mutualTLSConfig(expected, r.clock, func() (*tls.Certificate, error) {
+		cert, err := r.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsCert := cert.TLSCertificate()
+		return &tlsCert, nil
+	})
+}
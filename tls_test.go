@@ -0,0 +1,98 @@
+package keys_test
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testTLSHandshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) (error, error) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		return <-serverErr, err
+	}
+	defer conn.Close()
+	// Read to wait for the server to verify the client certificate.
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _ = conn.Read(make([]byte, 1))
+	return <-serverErr, nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	charlie := keys.NewEdX25519KeyFromSeed(testSeed(0x03))
+
+	aliceCert, err := keys.GenerateEdX25519Certificate(alice, keys.CertCommonName("alice"))
+	require.NoError(t, err)
+	bobCert, err := keys.GenerateEdX25519Certificate(bob, keys.CertCommonName("bob"))
+	require.NoError(t, err)
+
+	serverErr, clientErr := testTLSHandshake(t,
+		keys.MutualTLSConfig(aliceCert, []keys.ID{bob.ID()}),
+		keys.MutualTLSConfig(bobCert, []keys.ID{alice.ID()}))
+	require.NoError(t, serverErr)
+	require.NoError(t, clientErr)
+
+	// Client expects charlie
+	serverErr, clientErr = testTLSHandshake(t,
+		keys.MutualTLSConfig(aliceCert, []keys.ID{bob.ID()}),
+		keys.MutualTLSConfig(bobCert, []keys.ID{charlie.ID()}))
+	require.Error(t, serverErr)
+	require.EqualError(t, clientErr, "unexpected peer "+alice.ID().String())
+
+	// Server expects charlie
+	serverErr, _ = testTLSHandshake(t,
+		keys.MutualTLSConfig(aliceCert, []keys.ID{charlie.ID()}),
+		keys.MutualTLSConfig(bobCert, []keys.ID{alice.ID()}))
+	require.EqualError(t, serverErr, "unexpected peer "+bob.ID().String())
+}
+
+func TestCertificateRenewer(t *testing.T) {
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	clock := tsutil.NewClock()
+
+	_, err := keys.NewCertificateRenewer(alice, time.Hour, keys.CertCommonName("alice"), keys.CertValidFor(time.Hour))
+	require.EqualError(t, err, "renew before is longer than the certificate is valid")
+
+	renewer, err := keys.NewCertificateRenewer(alice, 10*time.Minute, keys.CertCommonName("alice"), keys.CertValidFor(time.Hour), keys.CertClock(clock))
+	require.NoError(t, err)
+	cert1, err := renewer.Certificate()
+	require.NoError(t, err)
+	cert2, err := renewer.Certificate()
+	require.NoError(t, err)
+	require.Equal(t, cert1, cert2)
+
+	bobCert, err := keys.GenerateEdX25519Certificate(bob, keys.CertCommonName("bob"))
+	require.NoError(t, err)
+	serverErr, clientErr := testTLSHandshake(t,
+		keys.MutualTLSConfig(bobCert, []keys.ID{alice.ID()}),
+		renewer.MutualTLSConfig([]keys.ID{bob.ID()}))
+	require.NoError(t, serverErr)
+	require.NoError(t, clientErr)
+
+	clock.Add(55 * time.Minute)
+	cert3, err := renewer.Certificate()
+	require.NoError(t, err)
+	require.NotEqual(t, cert1.Public(), cert3.Public())
+}
@@ -0,0 +1,162 @@
+package users
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/user"
+	"github.com/pkg/errors"
+)
+
+// SSHEntry is an authorized_keys or known_hosts line for a verified user.
+type SSHEntry struct {
+	// User is the user identity, e.g. alice@github.
+	User string
+	// KID is the user's sigchain (EdX25519) key.
+	KID keys.ID
+	// Line is the authorized_keys or known_hosts line.
+	Line string
+}
+
+// KnownHost maps a host (or host pattern) to a user identity.
+type KnownHost struct {
+	// Host name or pattern, e.g. "example.com" or "*.example.com".
+	Host string
+	// User identity, e.g. alice@github.
+	User string
+}
+
+// AuthorizedKeys returns authorized_keys entries for users, such as
+// "alice@github".
+// Users that aren't found or whose status isn't user.StatusOK are skipped.
+func (u *Users) AuthorizedKeys(ctx context.Context, users []string) ([]*SSHEntry, error) {
+	entries := make([]*SSHEntry, 0, len(users))
+	for _, usr := range users {
+		pk, err := u.verifiedKey(ctx, usr)
+		if err != nil {
+			return nil, err
+		}
+		if pk == nil {
+			continue
+		}
+		line := string(pk.EncodeToSSHAuthorized()) + " " + usr
+		entries = append(entries, &SSHEntry{User: usr, KID: pk.ID(), Line: line})
+	}
+	return entries, nil
+}
+
+// KnownHosts returns known_hosts entries for hosts.
+// Hosts whose user isn't found or whose status isn't user.StatusOK are skipped.
+func (u *Users) KnownHosts(ctx context.Context, hosts []*KnownHost) ([]*SSHEntry, error) {
+	entries := make([]*SSHEntry, 0, len(hosts))
+	for _, host := range hosts {
+		if host.Host == "" || strings.ContainsAny(host.Host, " \t\n") {
+			return nil, errors.Errorf("invalid known host %q", host.Host)
+		}
+		pk, err := u.verifiedKey(ctx, host.User)
+		if err != nil {
+			return nil, err
+		}
+		if pk == nil {
+			continue
+		}
+		line := host.Host + " " + string(pk.EncodeToSSHAuthorized()) + " " + host.User
+		entries = append(entries, &SSHEntry{User: host.User, KID: pk.ID(), Line: line})
+	}
+	return entries, nil
+}
+
+func (u *Users) verifiedKey(ctx context.Context, usr string) (*keys.EdX25519PublicKey, error) {
+	res, err := u.User(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		logger.Warningf("User %s not found", usr)
+		return nil, nil
+	}
+	if res.Status != user.StatusOK {
+		logger.Warningf("User %s status is %s", usr, res.Status)
+		return nil, nil
+	}
+	pk, err := keys.NewEdX25519PublicKeyFromID(res.User.KID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid key for user %s", usr)
+	}
+	return pk, nil
+}
+
+// EncodeSSHEntries returns entries as authorized_keys or known_hosts file
+// contents.
+func EncodeSSHEntries(entries []*SSHEntry) []byte {
+	var b bytes.Buffer
+	for _, e := range entries {
+		b.WriteString(e.Line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// SSHDiff describes changes between authorized_keys or known_hosts files.
+type SSHDiff struct {
+	// Added lines.
+	Added []string
+	// Removed lines.
+	Removed []string
+}
+
+// IsEmpty returns true if nothing changed.
+func (d SSHDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffSSHEntries compares entries with the previous file contents (from the
+// last run).
+// Blank lines and comments in the previous file are ignored.
+// A changed key for a user shows up as a removed and an added line.
+func DiffSSHEntries(previous []byte, entries []*SSHEntry) (*SSHDiff, error) {
+	prev, err := sshLines(previous)
+	if err != nil {
+		return nil, err
+	}
+	prevSet := make(map[string]bool, len(prev))
+	for _, l := range prev {
+		prevSet[l] = true
+	}
+	nextSet := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		nextSet[e.Line] = true
+	}
+
+	diff := &SSHDiff{}
+	for _, e := range entries {
+		if !prevSet[e.Line] {
+			diff.Added = append(diff.Added, e.Line)
+		}
+	}
+	for _, l := range prev {
+		if !nextSet[l] {
+			diff.Removed = append(diff.Removed, l)
+		}
+	}
+	return diff, nil
+}
+
+func sshLines(b []byte) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
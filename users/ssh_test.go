@@ -0,0 +1,79 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/dstore"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/keys-pub/keys/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizedKeys(t *testing.T) {
+	var err error
+	clock := tsutil.NewTestClock()
+	ds := dstore.NewMem()
+	scs := keys.NewSigchains(ds)
+	usrs := users.New(ds, scs, users.Clock(clock))
+
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	sc := keys.NewSigchain(alice.ID())
+	_, err = mockStatement(alice, sc, "alice", "echo", usrs.Client(), clock)
+	require.NoError(t, err)
+	err = scs.Save(sc)
+	require.NoError(t, err)
+	_, err = usrs.Update(context.TODO(), alice.ID())
+	require.NoError(t, err)
+
+	entries, err := usrs.AuthorizedKeys(context.TODO(), []string{"alice@echo", "bob@echo"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "alice@echo", entries[0].User)
+	require.Equal(t, alice.ID(), entries[0].KID)
+	expected := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c alice@echo\n"
+	require.Equal(t, expected, string(users.EncodeSSHEntries(entries)))
+
+	hosts, err := usrs.KnownHosts(context.TODO(), []*users.KnownHost{
+		{Host: "alice.example.com", User: "alice@echo"},
+		{Host: "bob.example.com", User: "bob@echo"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(hosts))
+	expected = "alice.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c alice@echo\n"
+	require.Equal(t, expected, string(users.EncodeSSHEntries(hosts)))
+
+	_, err = usrs.KnownHosts(context.TODO(), []*users.KnownHost{{Host: "", User: "alice@echo"}})
+	require.EqualError(t, err, `invalid known host ""`)
+
+	// Bob is added
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	sc2 := keys.NewSigchain(bob.ID())
+	_, err = mockStatement(bob, sc2, "bob", "echo", usrs.Client(), clock)
+	require.NoError(t, err)
+	err = scs.Save(sc2)
+	require.NoError(t, err)
+	_, err = usrs.Update(context.TODO(), bob.ID())
+	require.NoError(t, err)
+
+	previous := users.EncodeSSHEntries(entries)
+	entries, err = usrs.AuthorizedKeys(context.TODO(), []string{"alice@echo", "bob@echo"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+
+	diff, err := users.DiffSSHEntries(previous, entries)
+	require.NoError(t, err)
+	require.Equal(t, []string{entries[1].Line}, diff.Added)
+	require.Empty(t, diff.Removed)
+
+	// Alice is removed
+	diff, err = users.DiffSSHEntries(append([]byte("# comment\n\n"), users.EncodeSSHEntries(entries)...), entries[1:])
+	require.NoError(t, err)
+	require.Empty(t, diff.Added)
+	require.Equal(t, []string{entries[0].Line}, diff.Removed)
+
+	diff, err = users.DiffSSHEntries(users.EncodeSSHEntries(entries), entries)
+	require.NoError(t, err)
+	require.True(t, diff.IsEmpty())
+}
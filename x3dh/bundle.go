@@ -0,0 +1,109 @@
+package x3dh
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+)
+
+// StatementType is the sigchain statement type for prekey bundles.
+const StatementType = "x3dh"
+
+const signedPreKeyContext = "keys.pub/x3dh/spk/v1\x00"
+
+// Bundle is a published prekey bundle.
+type Bundle struct {
+	// Identity key.
+	Identity keys.ID `json:"kid"`
+	// SignedPreKey is a X25519 public key.
+	SignedPreKey keys.ID `json:"spk"`
+	// SignedPreKeySig is the signature of the signed prekey by the identity
+	// key, see signedPreKeyMessage.
+	SignedPreKeySig []byte `json:"spksig"`
+	// OneTimePreKeys are X25519 public keys (optional).
+	OneTimePreKeys []keys.ID `json:"opks,omitempty"`
+}
+
+// NewBundle creates a bundle for prekeys, signing the signed prekey with the
+// identity key.
+func NewBundle(identity *keys.EdX25519Key, prekeys *PreKeys) (*Bundle, error) {
+	if prekeys == nil || prekeys.SignedPreKey == nil {
+		return nil, errors.Errorf("no signed prekey")
+	}
+	b := &Bundle{
+		Identity:        identity.ID(),
+		SignedPreKey:    prekeys.SignedPreKey.ID(),
+		SignedPreKeySig: identity.SignDetached(signedPreKeyMessage(prekeys.SignedPreKey.PublicKey())),
+	}
+	for _, k := range prekeys.OneTimePreKeys {
+		b.OneTimePreKeys = append(b.OneTimePreKeys, k.ID())
+	}
+	return b, nil
+}
+
+// Verify the bundle signed prekey signature and key IDs.
+func (b *Bundle) Verify() error {
+	ik, err := keys.NewEdX25519PublicKeyFromID(b.Identity)
+	if err != nil {
+		return errors.Wrapf(err, "invalid bundle identity")
+	}
+	spk, err := keys.NewX25519PublicKeyFromID(b.SignedPreKey)
+	if err != nil {
+		return errors.Wrapf(err, "invalid bundle signed prekey")
+	}
+	if err := ik.VerifyDetached(b.SignedPreKeySig, signedPreKeyMessage(spk)); err != nil {
+		return errors.Wrapf(err, "invalid bundle signed prekey signature")
+	}
+	for _, id := range b.OneTimePreKeys {
+		if _, err := keys.NewX25519PublicKeyFromID(id); err != nil {
+			return errors.Wrapf(err, "invalid bundle one-time prekey")
+		}
+	}
+	return nil
+}
+
+// signedPreKeyMessage is the (domain separated) message signed for a signed
+// prekey.
+func signedPreKeyMessage(spk *keys.X25519PublicKey) []byte {
+	return append([]byte(signedPreKeyContext), spk.Bytes()...)
+}
+
+// NewSigchainStatement creates a sigchain statement for a prekey bundle.
+func NewSigchainStatement(sc *keys.Sigchain, bundle *Bundle, sk *keys.EdX25519Key, ts time.Time) (*keys.Statement, error) {
+	if bundle == nil {
+		return nil, errors.Errorf("no bundle specified")
+	}
+	if bundle.Identity != sk.ID() {
+		return nil, errors.Errorf("bundle identity mismatch")
+	}
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	return keys.NewSigchainStatement(sc, b, sk, StatementType, ts)
+}
+
+// FindInSigchain returns the last (unrevoked) prekey bundle from a Sigchain.
+// Returns nil if not found.
+func FindInSigchain(sc *keys.Sigchain) (*Bundle, error) {
+	st := sc.FindLast(StatementType)
+	if st == nil {
+		return nil, nil
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(st.Data, &bundle); err != nil {
+		return nil, errors.Wrapf(err, "invalid bundle")
+	}
+	if bundle.Identity != sc.KID() {
+		return nil, errors.Errorf("bundle identity mismatch")
+	}
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
@@ -0,0 +1,81 @@
+package x3dh_test
+
+import (
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/keys-pub/keys/x3dh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	_, bundle, err := x3dh.GeneratePreKeys(bob, 1)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Verify())
+
+	// Invalid signature
+	spk := bundle.SignedPreKey
+	bundle.SignedPreKey = keys.GenerateX25519Key().ID()
+	require.EqualError(t, bundle.Verify(), "invalid bundle signed prekey signature: verify failed")
+	_, _, _, err = x3dh.Initiate(keys.GenerateEdX25519Key(), bundle)
+	require.EqualError(t, err, "invalid bundle signed prekey signature: verify failed")
+	bundle.SignedPreKey = spk
+
+	// Signature of the bare public key (without context)
+	spkKey, err := keys.NewX25519PublicKeyFromID(spk)
+	require.NoError(t, err)
+	sig := bundle.SignedPreKeySig
+	bundle.SignedPreKeySig = bob.SignDetached(spkKey.Bytes())
+	require.EqualError(t, bundle.Verify(), "invalid bundle signed prekey signature: verify failed")
+	bundle.SignedPreKeySig = sig
+	require.NoError(t, bundle.Verify())
+
+	bundle.OneTimePreKeys = []keys.ID{"invalid"}
+	require.Error(t, bundle.Verify())
+}
+
+func TestBundleSigchain(t *testing.T) {
+	clock := tsutil.NewTestClock()
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	sc := keys.NewSigchain(bob.ID())
+
+	out, err := x3dh.FindInSigchain(sc)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	_, bundle, err := x3dh.GeneratePreKeys(bob, 2)
+	require.NoError(t, err)
+	st, err := x3dh.NewSigchainStatement(sc, bundle, bob, clock.Now())
+	require.NoError(t, err)
+	require.Equal(t, x3dh.StatementType, st.Type)
+	err = sc.Add(st)
+	require.NoError(t, err)
+
+	out, err = x3dh.FindInSigchain(sc)
+	require.NoError(t, err)
+	require.Equal(t, bundle, out)
+
+	// Rotate
+	_, bundle2, err := x3dh.GeneratePreKeys(bob, 2)
+	require.NoError(t, err)
+	st, err = x3dh.NewSigchainStatement(sc, bundle2, bob, clock.Now())
+	require.NoError(t, err)
+	err = sc.Add(st)
+	require.NoError(t, err)
+	out, err = x3dh.FindInSigchain(sc)
+	require.NoError(t, err)
+	require.Equal(t, bundle2, out)
+
+	// Revoke
+	_, err = sc.Revoke(2, bob)
+	require.NoError(t, err)
+	out, err = x3dh.FindInSigchain(sc)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	alice := keys.GenerateEdX25519Key()
+	_, err = x3dh.NewSigchainStatement(sc, bundle, alice, clock.Now())
+	require.EqualError(t, err, "bundle identity mismatch")
+}
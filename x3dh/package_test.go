@@ -0,0 +1,4 @@
+package x3dh
+
+// InitiateWithEphemeral for testing.
+var InitiateWithEphemeral = initiate
@@ -0,0 +1,206 @@
+// Package x3dh implements the X3DH (Extended Triple Diffie-Hellman) key
+// agreement protocol with EdX25519 identity keys and X25519 prekeys.
+// See https://signal.org/docs/specifications/x3dh/.
+package x3dh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+
+	"github.com/keys-pub/keys"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+// info for HKDF.
+const info = "keys.pub/x3dh/v1"
+
+// ErrOneTimePreKeyNotFound if the one-time prekey in an initial message isn't
+// available, for example if it was already used by another initiator.
+// The initiator can retry with a new bundle (or without a one-time prekey).
+var ErrOneTimePreKeyNotFound = errors.New("one-time prekey not found")
+
+// PreKeys are the private prekeys, kept by the bundle owner.
+type PreKeys struct {
+	SignedPreKey   *keys.X25519Key
+	OneTimePreKeys []*keys.X25519Key
+}
+
+// GeneratePreKeys generates a signed prekey and n one-time prekeys, returning
+// the private prekeys and the (signed) bundle to publish.
+func GeneratePreKeys(identity *keys.EdX25519Key, n int) (*PreKeys, *Bundle, error) {
+	pk := &PreKeys{SignedPreKey: keys.GenerateX25519Key()}
+	for i := 0; i < n; i++ {
+		pk.OneTimePreKeys = append(pk.OneTimePreKeys, keys.GenerateX25519Key())
+	}
+	bundle, err := NewBundle(identity, pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pk, bundle, nil
+}
+
+// RemoveOneTimePreKey removes a used one-time prekey, see Respond.
+// Returns false if it wasn't found.
+func (p *PreKeys) RemoveOneTimePreKey(id keys.ID) bool {
+	for i, k := range p.OneTimePreKeys {
+		if k.ID() == id {
+			p.OneTimePreKeys = append(p.OneTimePreKeys[:i:i], p.OneTimePreKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PreKeys) findOneTimePreKey(id keys.ID) *keys.X25519Key {
+	for _, k := range p.OneTimePreKeys {
+		if k.ID() == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// InitialMessage is sent by the initiator so the responder can compute the
+// shared secret.
+type InitialMessage struct {
+	// Sender identity key.
+	Sender keys.ID `json:"sender"`
+	// Ephemeral key.
+	Ephemeral keys.ID `json:"ephemeral"`
+	// SignedPreKey used.
+	SignedPreKey keys.ID `json:"spk"`
+	// OneTimePreKey used (optional).
+	OneTimePreKey keys.ID `json:"opk,omitempty"`
+}
+
+// Initiate computes a shared secret with the owner of a bundle.
+// The bundle is verified first.
+// If the bundle has one-time prekeys, one is picked at random, so initiators
+// using the same bundle are less likely to use the same one-time prekey.
+// Returns the shared secret, associated data (sender and recipient identity
+// keys) and the initial message for the responder.
+func Initiate(sender *keys.EdX25519Key, bundle *Bundle) (*[32]byte, []byte, *InitialMessage, error) {
+	if err := bundle.Verify(); err != nil {
+		return nil, nil, nil, err
+	}
+	rid, err := keys.NewEdX25519PublicKeyFromID(bundle.Identity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	spk, err := keys.NewX25519PublicKeyFromID(bundle.SignedPreKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var opk *keys.X25519PublicKey
+	if len(bundle.OneTimePreKeys) > 0 {
+		i, err := rand.Int(rand.Reader, big.NewInt(int64(len(bundle.OneTimePreKeys))))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		opk, err = keys.NewX25519PublicKeyFromID(bundle.OneTimePreKeys[i.Int64()])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	ek := keys.GenerateX25519Key()
+	return initiate(sender, ek, rid, spk, opk)
+}
+
+func initiate(sender *keys.EdX25519Key, ek *keys.X25519Key, rid *keys.EdX25519PublicKey, spk *keys.X25519PublicKey, opk *keys.X25519PublicKey) (*[32]byte, []byte, *InitialMessage, error) {
+	dhs := [][]byte{}
+	for _, dh := range []struct {
+		priv *keys.X25519Key
+		pub  *keys.X25519PublicKey
+	}{
+		{sender.X25519Key(), spk},
+		{ek, rid.X25519PublicKey()},
+		{ek, spk},
+		{ek, opk},
+	} {
+		if dh.pub == nil {
+			continue
+		}
+		b, err := curve25519.X25519(dh.priv.Private(), dh.pub.Bytes())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		dhs = append(dhs, b)
+	}
+
+	msg := &InitialMessage{
+		Sender:       sender.ID(),
+		Ephemeral:    ek.ID(),
+		SignedPreKey: spk.ID(),
+	}
+	if opk != nil {
+		msg.OneTimePreKey = opk.ID()
+	}
+	return kdf(dhs), ad(sender.ID(), rid.ID()), msg, nil
+}
+
+// Respond computes the shared secret from an initial message.
+// The one-time prekey (if used) isn't removed from prekeys, since the initial
+// message isn't authenticated yet. After the first message from the initiator
+// decrypts, remove it with PreKeys.RemoveOneTimePreKey, persist the updated
+// prekeys and publish a new bundle when they run low.
+// If the one-time prekey was already used (or is unknown), returns
+// ErrOneTimePreKeyNotFound.
+// Returns the shared secret and associated data (sender and recipient identity
+// keys).
+func Respond(recipient *keys.EdX25519Key, prekeys *PreKeys, msg *InitialMessage) (*[32]byte, []byte, error) {
+	sid, err := keys.NewEdX25519PublicKeyFromID(msg.Sender)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid sender")
+	}
+	ek, err := keys.NewX25519PublicKeyFromID(msg.Ephemeral)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid ephemeral key")
+	}
+	if prekeys.SignedPreKey == nil || msg.SignedPreKey != prekeys.SignedPreKey.ID() {
+		return nil, nil, errors.Errorf("signed prekey not found")
+	}
+	spk := prekeys.SignedPreKey
+
+	var opk *keys.X25519Key
+	if msg.OneTimePreKey != "" {
+		opk = prekeys.findOneTimePreKey(msg.OneTimePreKey)
+		if opk == nil {
+			return nil, nil, ErrOneTimePreKeyNotFound
+		}
+	}
+
+	dhs := [][]byte{}
+	for _, dh := range []struct {
+		priv *keys.X25519Key
+		pub  *keys.X25519PublicKey
+	}{
+		{spk, sid.X25519PublicKey()},
+		{recipient.X25519Key(), ek},
+		{spk, ek},
+		{opk, ek},
+	} {
+		if dh.priv == nil {
+			continue
+		}
+		b, err := curve25519.X25519(dh.priv.Private(), dh.pub.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+		dhs = append(dhs, b)
+	}
+	return kdf(dhs), ad(sid.ID(), recipient.ID()), nil
+}
+
+// kdf is HKDF-SHA256 over F || DH1 || DH2 || DH3 || DH4, where F is 32 0xFF
+// bytes, with a zero salt.
+func kdf(dhs [][]byte) *[32]byte {
+	ikm := append(bytes.Repeat([]byte{0xFF}, 32), bytes.Join(dhs, nil)...)
+	return keys.Bytes32(keys.HKDFSHA256(ikm, 32, make([]byte, 32), []byte(info)))
+}
+
+// ad is associated data, the sender and recipient identity keys.
+func ad(sender keys.ID, recipient keys.ID) []byte {
+	return []byte(sender.String() + recipient.String())
+}
@@ -0,0 +1,159 @@
+package x3dh_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/x3dh"
+	"github.com/stretchr/testify/require"
+)
+
+func testSeed(b byte) *[32]byte {
+	return keys.Bytes32(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestX3DH(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateEdX25519Key()
+
+	prekeys, bundle, err := x3dh.GeneratePreKeys(bob, 2)
+	require.NoError(t, err)
+
+	sk, ad, msg, err := x3dh.Initiate(alice, bundle)
+	require.NoError(t, err)
+	require.Equal(t, alice.ID(), msg.Sender)
+	require.Contains(t, bundle.OneTimePreKeys, msg.OneTimePreKey)
+
+	sk2, ad2, err := x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, sk, sk2)
+	require.Equal(t, ad, ad2)
+	// Removed after the initial message is authenticated
+	require.Equal(t, 2, len(prekeys.OneTimePreKeys))
+	require.True(t, prekeys.RemoveOneTimePreKey(msg.OneTimePreKey))
+	require.False(t, prekeys.RemoveOneTimePreKey(msg.OneTimePreKey))
+	require.Equal(t, 1, len(prekeys.OneTimePreKeys))
+
+	// One-time prekey was used
+	_, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.Equal(t, x3dh.ErrOneTimePreKeyNotFound, err)
+
+	// Without one-time prekeys
+	bundle.OneTimePreKeys = nil
+	sk, _, msg, err = x3dh.Initiate(alice, bundle)
+	require.NoError(t, err)
+	require.Empty(t, msg.OneTimePreKey)
+	sk2, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, sk, sk2)
+
+	// Different sender claimed
+	charlie := keys.GenerateEdX25519Key()
+	msg.Sender = charlie.ID()
+	sk2, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.NotEqual(t, sk, sk2)
+
+	// Unknown signed prekey
+	msg.SignedPreKey = keys.GenerateX25519Key().ID()
+	_, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.EqualError(t, err, "signed prekey not found")
+}
+
+func TestX3DHSameBundle(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	charlie := keys.GenerateEdX25519Key()
+	bob := keys.GenerateEdX25519Key()
+
+	// Bundle with a single one-time prekey, used by both initiators
+	prekeys, bundle, err := x3dh.GeneratePreKeys(bob, 1)
+	require.NoError(t, err)
+
+	sk, _, msg, err := x3dh.Initiate(alice, bundle)
+	require.NoError(t, err)
+	sk2, _, msg2, err := x3dh.Initiate(charlie, bundle)
+	require.NoError(t, err)
+	require.Equal(t, msg.OneTimePreKey, msg2.OneTimePreKey)
+
+	out, _, err := x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, sk, out)
+	prekeys.RemoveOneTimePreKey(msg.OneTimePreKey)
+
+	_, _, err = x3dh.Respond(bob, prekeys, msg2)
+	require.Equal(t, x3dh.ErrOneTimePreKeyNotFound, err)
+
+	// Charlie retries with the updated bundle (no one-time prekeys left)
+	bundle, err = x3dh.NewBundle(bob, prekeys)
+	require.NoError(t, err)
+	sk2, _, msg2, err = x3dh.Initiate(charlie, bundle)
+	require.NoError(t, err)
+	require.Empty(t, msg2.OneTimePreKey)
+	out, _, err = x3dh.Respond(bob, prekeys, msg2)
+	require.NoError(t, err)
+	require.Equal(t, sk2, out)
+
+	// Random one-time prekey
+	_, bundle, err = x3dh.GeneratePreKeys(bob, 10)
+	require.NoError(t, err)
+	used := map[keys.ID]bool{}
+	for i := 0; i < 20; i++ {
+		_, _, msg, err := x3dh.Initiate(alice, bundle)
+		require.NoError(t, err)
+		used[msg.OneTimePreKey] = true
+	}
+	require.True(t, len(used) > 1)
+}
+
+func TestX3DHRespondFailed(t *testing.T) {
+	alice := keys.GenerateEdX25519Key()
+	bob := keys.GenerateEdX25519Key()
+	prekeys, bundle, err := x3dh.GeneratePreKeys(bob, 1)
+	require.NoError(t, err)
+
+	// Forged message with a low order ephemeral key
+	msg := &x3dh.InitialMessage{
+		Sender:        alice.ID(),
+		Ephemeral:     keys.NewX25519PublicKey(&[32]byte{}).ID(),
+		SignedPreKey:  bundle.SignedPreKey,
+		OneTimePreKey: bundle.OneTimePreKeys[0],
+	}
+	_, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.Error(t, err)
+	require.Equal(t, 1, len(prekeys.OneTimePreKeys))
+
+	// Forged message (that the caller can't authenticate) doesn't use the
+	// one-time prekey either
+	msg.Ephemeral = keys.GenerateX25519Key().ID()
+	_, _, err = x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(prekeys.OneTimePreKeys))
+
+	sk, _, msg, err := x3dh.Initiate(alice, bundle)
+	require.NoError(t, err)
+	out, _, err := x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, sk, out)
+}
+
+func TestX3DHVector(t *testing.T) {
+	// Shared secret checked with an independent (RFC 7748, RFC 5869)
+	// implementation.
+	alice := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	bob := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+	ek := keys.NewX25519KeyFromSeed(testSeed(0x03))
+	prekeys := &x3dh.PreKeys{
+		SignedPreKey:   keys.NewX25519KeyFromSeed(testSeed(0x04)),
+		OneTimePreKeys: []*keys.X25519Key{keys.NewX25519KeyFromSeed(testSeed(0x05))},
+	}
+
+	sk, _, msg, err := x3dh.InitiateWithEphemeral(alice, ek, bob.PublicKey(), prekeys.SignedPreKey.PublicKey(), prekeys.OneTimePreKeys[0].PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, "0de9aa9d0e79361c794182cd1ba19527bf40e5ca280ade55f233947e22b6b5d6", hex.EncodeToString(sk[:]))
+
+	sk2, _, err := x3dh.Respond(bob, prekeys, msg)
+	require.NoError(t, err)
+	require.Equal(t, sk, sk2)
+}
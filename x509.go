@@ -0,0 +1,275 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/pkg/errors"
+)
+
+// CertificateURIScheme is the URI scheme for key IDs in certificate subject
+// alternative names (SAN), for example, "keys:kex1...".
+const CertificateURIScheme = "keys"
+
+// CertificateOptions are options for EdX25519 certificates and certificate
+// requests.
+type CertificateOptions struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	IsCA        bool
+	// ValidFor is how long the certificate is valid (defaults to 1 year).
+	ValidFor time.Duration
+	// Clock for certificate validity (defaults to tsutil.NewClock()).
+	Clock tsutil.Clock
+	// Parent certificate and key to sign with (defaults to self-signed).
+	Parent    *x509.Certificate
+	ParentKey *EdX25519Key
+}
+
+// CertificateOption ...
+type CertificateOption func(*CertificateOptions)
+
+func newCertificateOptions(opts ...CertificateOption) CertificateOptions {
+	var options CertificateOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.ValidFor == 0 {
+		options.ValidFor = 365 * 24 * time.Hour
+	}
+	if options.Clock == nil {
+		options.Clock = tsutil.NewClock()
+	}
+	return options
+}
+
+// CertCommonName option.
+func CertCommonName(cn string) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.CommonName = cn
+	}
+}
+
+// CertDNSNames option.
+func CertDNSNames(names ...string) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.DNSNames = names
+	}
+}
+
+// CertIPAddresses option.
+func CertIPAddresses(ips ...net.IP) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.IPAddresses = ips
+	}
+}
+
+// CertIsCA option.
+func CertIsCA() CertificateOption {
+	return func(o *CertificateOptions) {
+		o.IsCA = true
+	}
+}
+
+// CertValidFor option.
+func CertValidFor(dt time.Duration) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.ValidFor = dt
+	}
+}
+
+// CertClock option.
+func CertClock(clock tsutil.Clock) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.Clock = clock
+	}
+}
+
+// CertParent option, to sign with a parent (CA) certificate and key.
+func CertParent(parent *x509.Certificate, parentKey *EdX25519Key) CertificateOption {
+	return func(o *CertificateOptions) {
+		o.Parent = parent
+		o.ParentKey = parentKey
+	}
+}
+
+// GenerateEdX25519Certificate creates a certificate for a EdX25519Key, with
+// the key ID as a URI SAN.
+// The certificate is self-signed unless the CertParent option is specified.
+func GenerateEdX25519Certificate(key *EdX25519Key, opt ...CertificateOption) (*CertificateKey, error) {
+	opts := newCertificateOptions(opt...)
+	template, err := certificateTemplate(key.ID(), opts)
+	if err != nil {
+		return nil, err
+	}
+	parent, signer := template, key
+	if opts.Parent != nil {
+		if opts.ParentKey == nil {
+			return nil, errors.Errorf("failed to generate certificate: no parent key specified")
+		}
+		parent, signer = opts.Parent, opts.ParentKey
+	}
+	certBytes, err := createCertificate(template, key.PublicKey(), parent, signer)
+	if err != nil {
+		return nil, err
+	}
+	certData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	return NewEdX25519CertificateKey(key, string(certData))
+}
+
+// NewEdX25519CertificateKey creates a CertificateKey from a EdX25519Key and a
+// PEM encoded certificate for it.
+func NewEdX25519CertificateKey(key *EdX25519Key, cert string) (*CertificateKey, error) {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(key.Private()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal private key")
+	}
+	priv := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	return NewCertificateKey(string(priv), cert)
+}
+
+// NewEdX25519CertificateRequest creates a PEM encoded certificate signing
+// request (CSR) for a EdX25519Key, with the key ID as a URI SAN.
+func NewEdX25519CertificateRequest(key *EdX25519Key, opt ...CertificateOption) ([]byte, error) {
+	opts := newCertificateOptions(opt...)
+	if opts.CommonName == "" {
+		return nil, errors.Errorf("failed to create certificate request: no common name specified")
+	}
+	template := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: opts.CommonName},
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+		URIs:        []*url.URL{certificateURI(key.ID())},
+	}
+	b, err := x509.CreateCertificateRequest(rand.Reader, template, key.Signer())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create certificate request")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: b}), nil
+}
+
+// SignCertificateRequest signs a PEM encoded certificate signing request (CSR)
+// for a EdX25519 key, returning a PEM encoded certificate.
+// The CertParent option is required.
+// The subject and SANs come from the request, other options are ignored.
+func SignCertificateRequest(csr []byte, opt ...CertificateOption) ([]byte, error) {
+	opts := newCertificateOptions(opt...)
+	if opts.Parent == nil || opts.ParentKey == nil {
+		return nil, errors.Errorf("failed to sign certificate request: no parent specified")
+	}
+	block, _ := pem.Decode(csr)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.Errorf("failed to parse certificate request PEM")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, errors.Wrapf(err, "invalid certificate request")
+	}
+	kid, err := certificateKeyID(req.URIs, req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := NewEdX25519PublicKeyFromID(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.CommonName = req.Subject.CommonName
+	opts.DNSNames = req.DNSNames
+	opts.IPAddresses = req.IPAddresses
+	opts.IsCA = false
+	template, err := certificateTemplate(kid, opts)
+	if err != nil {
+		return nil, err
+	}
+	certBytes, err := createCertificate(template, pk, opts.Parent, opts.ParentKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), nil
+}
+
+// CertificateKeyID returns the EdX25519 key ID from the certificate URI SAN.
+// Returns an error if the ID doesn't match the certificate public key.
+func CertificateKeyID(cert *x509.Certificate) (ID, error) {
+	return certificateKeyID(cert.URIs, cert.PublicKey)
+}
+
+func certificateKeyID(uris []*url.URL, publicKey interface{}) (ID, error) {
+	edpk, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", errors.Errorf("certificate public key is not ed25519")
+	}
+	if len(edpk) != ed25519.PublicKeySize {
+		return "", errors.Errorf("invalid certificate public key")
+	}
+	expected := NewEdX25519PublicKey(Bytes32(edpk)).ID()
+	for _, u := range uris {
+		if u.Scheme != CertificateURIScheme {
+			continue
+		}
+		if ID(u.Opaque) != expected {
+			return "", errors.Errorf("certificate key id mismatch")
+		}
+		return expected, nil
+	}
+	return "", errors.Errorf("certificate has no key id")
+}
+
+func certificateURI(kid ID) *url.URL {
+	return &url.URL{Scheme: CertificateURIScheme, Opaque: kid.String()}
+}
+
+func certificateTemplate(kid ID, opts CertificateOptions) (*x509.Certificate, error) {
+	if opts.CommonName == "" {
+		return nil, errors.Errorf("failed to generate certificate: no common name specified")
+	}
+	notBefore := opts.Clock.Now()
+	notAfter := notBefore.Add(opts.ValidFor)
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate serial number")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: opts.CommonName,
+		},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+		URIs:        []*url.URL{certificateURI(kid)},
+	}
+	if opts.IsCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.BasicConstraintsValid = true
+	}
+	return template, nil
+}
+
+func createCertificate(template *x509.Certificate, pk *EdX25519PublicKey, parent *x509.Certificate, signer *EdX25519Key) ([]byte, error) {
+	b, err := x509.CreateCertificate(rand.Reader, template, parent, ed25519.PublicKey(pk.Bytes()), signer.Signer())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create x509 certificate")
+	}
+	return b, nil
+}
@@ -0,0 +1,89 @@
+package keys_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/keys-pub/keys"
+	"github.com/keys-pub/keys/tsutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateEdX25519Certificate(t *testing.T) {
+	key := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+
+	cert, err := keys.GenerateEdX25519Certificate(key, keys.CertCommonName("localhost"), keys.CertDNSNames("localhost"))
+	require.NoError(t, err)
+
+	xcert, err := cert.X509Certificate()
+	require.NoError(t, err)
+	require.Equal(t, "keys:kex132yw8ht5p8cetl2jmvknewjawt9xwzdlrk2pyxlnwjyqrdq0dawqqph077", xcert.URIs[0].String())
+	kid, err := keys.CertificateKeyID(xcert)
+	require.NoError(t, err)
+	require.Equal(t, key.ID(), kid)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(xcert)
+	_, err = xcert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: certPool})
+	require.NoError(t, err)
+
+	_, err = keys.GenerateEdX25519Certificate(key)
+	require.EqualError(t, err, "failed to generate certificate: no common name specified")
+}
+
+func TestCertificateRequest(t *testing.T) {
+	caKey := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	key := keys.NewEdX25519KeyFromSeed(testSeed(0x02))
+
+	ca, err := keys.GenerateEdX25519Certificate(caKey, keys.CertCommonName("Test CA"), keys.CertIsCA())
+	require.NoError(t, err)
+	caCert, err := ca.X509Certificate()
+	require.NoError(t, err)
+
+	csr, err := keys.NewEdX25519CertificateRequest(key, keys.CertCommonName("alice"), keys.CertDNSNames("alice.local"))
+	require.NoError(t, err)
+
+	_, err = keys.SignCertificateRequest(csr)
+	require.EqualError(t, err, "failed to sign certificate request: no parent specified")
+
+	certPEM, err := keys.SignCertificateRequest(csr, keys.CertParent(caCert, caKey), keys.CertValidFor(time.Hour))
+	require.NoError(t, err)
+
+	cert, err := keys.NewEdX25519CertificateKey(key, string(certPEM))
+	require.NoError(t, err)
+	xcert, err := cert.X509Certificate()
+	require.NoError(t, err)
+	require.Equal(t, "alice", xcert.Subject.CommonName)
+	require.Equal(t, time.Hour, xcert.NotAfter.Sub(xcert.NotBefore))
+	kid, err := keys.CertificateKeyID(xcert)
+	require.NoError(t, err)
+	require.Equal(t, key.ID(), kid)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = xcert.Verify(x509.VerifyOptions{DNSName: "alice.local", Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+
+	// Key mismatch
+	_, err = keys.NewEdX25519CertificateKey(caKey, string(certPEM))
+	require.Error(t, err)
+
+	// Invalid request
+	block, _ := pem.Decode(csr)
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	_, err = keys.SignCertificateRequest(pem.EncodeToMemory(block), keys.CertParent(caCert, caKey))
+	require.Error(t, err)
+}
+
+func TestCertificateNeedsRenewal(t *testing.T) {
+	key := keys.NewEdX25519KeyFromSeed(testSeed(0x01))
+	clock := tsutil.NewTestClock()
+
+	cert, err := keys.GenerateEdX25519Certificate(key, keys.CertCommonName("localhost"), keys.CertValidFor(time.Hour), keys.CertClock(clock))
+	require.NoError(t, err)
+	require.False(t, cert.NeedsRenewal(clock.Now(), 10*time.Minute))
+	clock.Add(50 * time.Minute)
+	require.True(t, cert.NeedsRenewal(clock.Now(), 10*time.Minute))
+}